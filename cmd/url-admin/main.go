@@ -0,0 +1,391 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"url-shoter/internal/config"
+	"url-shoter/internal/lib/audit"
+	"url-shoter/internal/lib/linkio"
+	"url-shoter/internal/storage"
+	"url-shoter/internal/storage/pgsql"
+)
+
+/*
+url-admin офлайн выгрузка, загрузка и перенос ссылок между хранилищами.
+
+	url-admin export  [-config cfg.yaml] [-format ndjson] [-out urls.ndjson]
+	url-admin import  [-config cfg.yaml] [-format ndjson] [-in urls.ndjson] [-conflict skip] [-dry-run]
+	url-admin migrate -from <cfg.yaml|file> -to <cfg.yaml|file> [-conflict skip] [-dry-run]
+	url-admin alias-collisions [-config cfg.yaml] [-json]
+
+Хранилище задаётся либо конфигом (*.yaml, *.yml) с настройками pgsql, либо файлом,
+формат файла определяется по расширению (.csv, .json, .ndjson, .sql - дамп YOURLS) или флагом.
+Выгрузки bit.ly и YOURLS (bitly-csv, bitly-json, yourls-csv, yourls-json, yourls-sql) доступны только как источник.
+"-" означает stdin/stdout.
+
+alias-collisions выводит алиасы, различающиеся только регистром, их нужно переименовать
+до включения alias_filter.case_insensitive. Код выхода 1, если совпадения есть.
+*/
+
+type source interface {
+	IterateUrls(fn func(storage.URLData) error) error
+}
+
+type target interface {
+	ImportUrls(next func() (storage.URLData, error), mode storage.ConflictMode, dryRun bool, trail *audit.Trail) (storage.ImportReport, error)
+}
+
+type backend interface {
+	source
+	target
+}
+
+var errStopped = errors.New("приём записей остановлен")
+
+// cliTrail журнал аудита загрузки в базу: заменённые ссылки и итог записываются от имени url-admin, как из API
+var cliTrail = audit.New(nil).TrailFrom(audit.Source{Actor: "cli:url-admin"})
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "export":
+		err = runExport(os.Args[2:])
+	case "import":
+		err = runImport(os.Args[2:])
+	case "migrate":
+		err = runMigrate(os.Args[2:])
+	case "alias-collisions":
+		err = runAliasCollisions(os.Args[2:])
+	default:
+		usage()
+	}
+
+	if err != nil {
+		log.Fatalf("url-admin %s: %v", os.Args[1], err)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "использование: url-admin export|import|migrate|alias-collisions [флаги]")
+	os.Exit(2)
+}
+
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	configPath := fs.String("config", "", "конфиг хранилища, по умолчанию CONFIG_PATH из .env")
+	format := fs.String("format", linkio.FormatNDJSON, "формат: csv, json, ndjson")
+	out := fs.String("out", "-", "файл выгрузки")
+	_ = fs.Parse(args)
+
+	dst, err := openFile(*out, *format)
+	if err != nil {
+		return err
+	}
+
+	return transfer(openStorage(*configPath), dst, storage.ConflictSkip, false)
+}
+
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	configPath := fs.String("config", "", "конфиг хранилища, по умолчанию CONFIG_PATH из .env")
+	format := fs.String("format", linkio.FormatNDJSON, "формат: csv, json, ndjson")
+	in := fs.String("in", "-", "файл загрузки")
+	conflict := fs.String("conflict", string(storage.ConflictSkip), "режим конфликта: skip, overwrite, fail")
+	dryRun := fs.Bool("dry-run", false, "только отчёт, без изменений")
+	_ = fs.Parse(args)
+
+	mode, err := storage.ParseConflictMode(*conflict)
+	if err != nil {
+		return err
+	}
+
+	src, err := openFile(*in, *format)
+	if err != nil {
+		return err
+	}
+
+	return transfer(src, openStorage(*configPath), mode, *dryRun)
+}
+
+func runMigrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	from := fs.String("from", "", "источник: конфиг хранилища или файл")
+	fromFormat := fs.String("from-format", "", "формат файла источника, по умолчанию по расширению, например yourls-sql, bitly-csv")
+	to := fs.String("to", "", "приёмник: конфиг хранилища или файл")
+	conflict := fs.String("conflict", string(storage.ConflictSkip), "режим конфликта: skip, overwrite, fail")
+	dryRun := fs.Bool("dry-run", false, "только отчёт, без изменений")
+	_ = fs.Parse(args)
+
+	if *from == "" || *to == "" {
+		return errors.New("нужно указать -from и -to")
+	}
+
+	mode, err := storage.ParseConflictMode(*conflict)
+	if err != nil {
+		return err
+	}
+
+	src, err := openBackend(*from, *fromFormat)
+	if err != nil {
+		return err
+	}
+	dst, err := openBackend(*to, "")
+	if err != nil {
+		return err
+	}
+
+	return transfer(src, dst, mode, *dryRun)
+}
+
+/*
+transfer перекачивает записи из источника в приёмник без загрузки всех данных в память
+и печатает отчёт в stderr
+*/
+func transfer(src source, dst target, mode storage.ConflictMode, dryRun bool) error {
+	records := make(chan storage.URLData)
+	iterErr := make(chan error, 1)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(records)
+		iterErr <- src.IterateUrls(func(data storage.URLData) error {
+			select {
+			case records <- data:
+				return nil
+			case <-done:
+				return errStopped
+			}
+		})
+	}()
+
+	var finished bool
+	next := func() (storage.URLData, error) {
+		if finished {
+			return storage.URLData{}, io.EOF
+		}
+
+		data, ok := <-records
+		if !ok {
+			finished = true
+			if err := <-iterErr; err != nil {
+				return data, err
+			}
+			return data, io.EOF
+		}
+
+		return data, nil
+	}
+
+	report, err := dst.ImportUrls(next, mode, dryRun, cliTrail)
+	close(done)
+
+	enc := json.NewEncoder(os.Stderr)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(report)
+
+	return err
+}
+
+/*
+openBackend хранилище по конфигу либо файл
+*/
+func openBackend(spec string, format string) (backend, error) {
+	switch strings.ToLower(filepath.Ext(spec)) {
+	case ".yaml", ".yml":
+		return openStorage(spec), nil
+	default:
+		return openFile(spec, format)
+	}
+}
+
+/*
+runAliasCollisions проверка перед включением поиска алиасов без учёта регистра
+*/
+func runAliasCollisions(args []string) error {
+	fs := flag.NewFlagSet("alias-collisions", flag.ExitOnError)
+	configPath := fs.String("config", "", "конфиг хранилища, по умолчанию CONFIG_PATH из .env")
+	asJSON := fs.Bool("json", false, "вывести совпадения в JSON")
+	_ = fs.Parse(args)
+
+	collisions, err := connect(loadConfig(*configPath)).AliasCollisions()
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		if collisions == nil {
+			collisions = []storage.AliasCollision{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(collisions); err != nil {
+			return err
+		}
+	} else {
+		for _, c := range collisions {
+			aliases := make([]string, len(c.Aliases))
+			for i, alias := range c.Aliases {
+				aliases[i] = fmt.Sprintf("%s (id %d)", alias, c.IDs[i])
+			}
+			fmt.Printf("%s\t%s\t%s\n", c.Domain, c.Key, strings.Join(aliases, ", "))
+		}
+	}
+
+	if len(collisions) > 0 {
+		return fmt.Errorf("найдено совпадений: %d, переименуйте алиасы перед включением case_insensitive", len(collisions))
+	}
+
+	fmt.Fprintln(os.Stderr, "совпадений нет, case_insensitive можно включать")
+	return nil
+}
+
+/*
+openStorage подключение к хранилищу из конфига с режимом регистра алиасов из alias_filter
+*/
+func openStorage(configPath string) *pgsql.Storage {
+	cfg := loadConfig(configPath)
+	s := connect(cfg)
+
+	if err := s.SetCaseInsensitive(cfg.AliasFilter.CaseInsensitive); err != nil {
+		log.Fatalf("Не удалось переключить режим регистра алиасов, проверьте url-admin alias-collisions: %v", err)
+	}
+
+	return s
+}
+
+func loadConfig(configPath string) *config.Config {
+	if configPath == "" {
+		return config.MustLoad()
+	}
+	return config.MustLoadPath(configPath)
+}
+
+func connect(cfg *config.Config) *pgsql.Storage {
+	s, err := pgsql.ConnectDB(pgsql.DBConfig{
+		Host:     cfg.PGSQL.DBHost,
+		Port:     cfg.PGSQL.DBPort,
+		User:     cfg.PGSQL.DBUser,
+		Password: cfg.PGSQL.DBPass,
+		DBName:   cfg.PGSQL.DBName,
+		SSLMode:  cfg.PGSQL.DBSSLMode,
+	})
+	if err != nil {
+		log.Fatalf("Неудалось подключиться к бд: %v", err)
+	}
+
+	return s
+}
+
+/*
+fileStorage файл выгрузки в роли хранилища, конфликты не проверяются
+*/
+type fileStorage struct {
+	path   string
+	format string
+}
+
+func openFile(path string, format string) (*fileStorage, error) {
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".csv":
+			format = linkio.FormatCSV
+		case ".json":
+			format = linkio.FormatJSON
+		case ".ndjson", ".jsonl":
+			format = linkio.FormatNDJSON
+		case ".sql":
+			format = linkio.FormatYOURLSSQL
+		default:
+			return nil, fmt.Errorf("не удалось определить формат файла %s", path)
+		}
+	}
+
+	return &fileStorage{path: path, format: format}, nil
+}
+
+func (f *fileStorage) IterateUrls(fn func(storage.URLData) error) error {
+	in := os.Stdin
+	if f.path != "-" {
+		file, err := os.Open(f.path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		in = file
+	}
+
+	reader, err := linkio.NewReader(f.format, in, linkio.WithPasswordHashes())
+	if err != nil {
+		return err
+	}
+
+	for {
+		data, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(data); err != nil {
+			return err
+		}
+	}
+}
+
+func (f *fileStorage) ImportUrls(next func() (storage.URLData, error), _ storage.ConflictMode, dryRun bool,
+	_ *audit.Trail) (storage.ImportReport, error) {
+	report := storage.ImportReport{DryRun: dryRun}
+
+	var out io.Writer = io.Discard
+	if !dryRun {
+		if f.path == "-" {
+			out = os.Stdout
+		} else {
+			file, err := os.Create(f.path)
+			if err != nil {
+				return report, err
+			}
+			defer file.Close()
+			out = file
+		}
+	}
+
+	writer, err := linkio.NewWriter(f.format, out, linkio.WithPasswordHashes())
+	if err != nil {
+		return report, err
+	}
+
+	for line := 1; ; line++ {
+		data, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if errors.Is(err, storage.ErrInvalidRecord) {
+			report.Reject(line, data.Alias, err)
+			continue
+		}
+		if err != nil {
+			return report, err
+		}
+
+		report.Total++
+		report.Created++
+		if err := writer.Write(data); err != nil {
+			return report, err
+		}
+	}
+
+	return report, writer.Close()
+}
@@ -1,19 +1,57 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"strings"
 	"url-shoter/internal/config"
+	grpcserver "url-shoter/internal/grpc-server"
+	"url-shoter/internal/grpc-server/linkservice"
+	auditLog "url-shoter/internal/http-server/handlers/audit"
+	"url-shoter/internal/http-server/handlers/graph"
+	"url-shoter/internal/http-server/handlers/security/blocked"
+	"url-shoter/internal/http-server/handlers/url/batch"
 	"url-shoter/internal/http-server/handlers/url/delete"
 	"url-shoter/internal/http-server/handlers/url/editAlias"
+	"url-shoter/internal/http-server/handlers/url/exportUrls"
+	"url-shoter/internal/http-server/handlers/url/importUrls"
+	"url-shoter/internal/http-server/handlers/url/qr"
 	"url-shoter/internal/http-server/handlers/url/redirect"
 	"url-shoter/internal/http-server/handlers/url/save"
 	"url-shoter/internal/http-server/handlers/url/showAll"
+	"url-shoter/internal/http-server/handlers/url/stats"
+	"url-shoter/internal/http-server/handlers/url/trash"
+	"url-shoter/internal/http-server/handlers/webhooks"
+	"url-shoter/internal/http-server/middleware/apikey"
+	mwLang "url-shoter/internal/http-server/middleware/lang"
 	mwLogger "url-shoter/internal/http-server/middleware/logger"
+	"url-shoter/internal/http-server/middleware/ratelimit"
+	"url-shoter/internal/http-server/middleware/scanguard"
+	"url-shoter/internal/lib/aliasfilter"
+	"url-shoter/internal/lib/api/link"
+	"url-shoter/internal/lib/audit"
+	"url-shoter/internal/lib/blocklist"
+	"url-shoter/internal/lib/domains"
+	"url-shoter/internal/lib/events"
+	"url-shoter/internal/lib/geoip"
+	"url-shoter/internal/lib/i18n"
+	"url-shoter/internal/lib/logger/sl"
+	"url-shoter/internal/lib/outbox"
+	"url-shoter/internal/lib/pages"
+	"url-shoter/internal/lib/password"
+	"url-shoter/internal/lib/purge"
+	"url-shoter/internal/lib/scan"
+	"url-shoter/internal/lib/webhook"
 	"url-shoter/internal/logger"
+	urlstorage "url-shoter/internal/storage"
 	"url-shoter/internal/storage/pgsql"
 )
 
@@ -51,12 +89,143 @@ func main() {
 
 	storage, err := pgsql.ConnectDB(pgsql.DBConfig(pgcfg))
 	if err != nil {
-		log.Error("Неудалось подключиться к бд:", pgcfg)
+		log.Error("Неудалось подключиться к бд", sl.Err(err))
 		os.Exit(1)
 	}
 
 	//подключение к бд это будет использоваться внутри хендлеров
 
+	//домены коротких ссылок
+	resolver, err := domains.New(cfg.BaseURL, cfg.ShortDomains.Default, cfg.ShortDomains.List, cfg.ShortDomains.Scheme)
+	if err != nil {
+		log.Error("Некорректные настройки доменов", sl.Err(err))
+		os.Exit(1)
+	}
+
+	defaultLang, err := i18n.ParseLang(cfg.Lang)
+	if err != nil {
+		log.Error("Некорректный язык сообщений", sl.Err(err))
+		os.Exit(1)
+	}
+
+	//страницы ошибок для браузеров
+	errorPages, err := pages.New(cfg.Pages.TemplateDir)
+	if err != nil {
+		log.Error("Не удалось загрузить шаблоны страниц", sl.Err(err))
+		os.Exit(1)
+	}
+
+	//страна по IP для правил ссылок
+	var locator redirect.CountryLocator
+	if cfg.GeoIP.DBPath != "" {
+		geoDB, err := geoip.Open(cfg.GeoIP.DBPath)
+		if err != nil {
+			log.Error("Не удалось открыть базу GeoIP", sl.Err(err))
+			os.Exit(1)
+		}
+		defer geoDB.Close()
+		locator = geoDB
+	}
+
+	//опасные адреса назначения
+	var safety redirect.SafetyChecker
+	unsafeHosts := cfg.Blocklist.Hosts
+	if cfg.Blocklist.HostsFile != "" {
+		hosts, err := blocklist.Load(cfg.Blocklist.HostsFile)
+		if err != nil {
+			log.Error("Не удалось загрузить список опасных доменов", sl.Err(err))
+			os.Exit(1)
+		}
+		unsafeHosts = append(unsafeHosts, hosts...)
+	}
+	if len(unsafeHosts) > 0 {
+		safety = blocklist.New(unsafeHosts)
+	}
+
+	//доступ к ссылкам с паролем
+	cookieSecret := []byte(cfg.Protected.CookieSecret)
+	if len(cookieSecret) == 0 {
+		log.Warn("cookie_secret не задан, cookie доступа к ссылкам с паролем не переживут перезапуск")
+		cookieSecret = make([]byte, 32)
+		if _, err := rand.Read(cookieSecret); err != nil {
+			log.Error("Не удалось сгенерировать ключ cookie", sl.Err(err))
+			os.Exit(1)
+		}
+	}
+	guard := password.NewGuard(cookieSecret, cfg.Protected.CookieTTL, cfg.Protected.MaxAttempts, cfg.Protected.AttemptWindow)
+
+	//ключи клиентов: проверка доступа, лимиты и журнал аудита
+	apiKeys := make([]apikey.Key, 0, len(cfg.APIKeys))
+	for _, key := range cfg.APIKeys {
+		apiKeys = append(apiKeys, apikey.Key{Name: key.Name, Value: key.Key})
+	}
+
+	//ограничение частоты запросов
+	saveLimit, redirectLimit := noLimit, noLimit
+	if cfg.RateLimit.Enabled {
+		limitStore := ratelimit.NewMemoryStore()
+		saveLimit, err = rateLimit(log, limitStore, "save", cfg.RateLimit.Save, apiKeys)
+		if err == nil {
+			redirectLimit, err = rateLimit(log, limitStore, "redirect", cfg.RateLimit.Redirect, apiKeys)
+		}
+		if err != nil {
+			log.Error("Некорректные настройки лимитов", sl.Err(err))
+			os.Exit(1)
+		}
+	}
+
+	//защита переходов от перебора алиасов
+	scanGuard := noLimit
+	if cfg.ScanGuard.Enabled {
+		scanGuard = scanguard.New(log, scan.New(scan.Config{
+			Window:        cfg.ScanGuard.Window,
+			MinRequests:   cfg.ScanGuard.MinRequests,
+			NotFoundRatio: cfg.ScanGuard.NotFoundRatio,
+			BaseBlock:     cfg.ScanGuard.BaseBlock,
+			MaxBlock:      cfg.ScanGuard.MaxBlock,
+			ResetAfter:    cfg.ScanGuard.ResetAfter,
+		}), storage)
+	}
+
+	//запрещённые алиасы
+	blockedWords := cfg.AliasFilter.BlockedWords
+	if cfg.AliasFilter.BlockedWordsFile != "" {
+		words, err := aliasfilter.LoadWords(cfg.AliasFilter.BlockedWordsFile)
+		if err != nil {
+			log.Error("Не удалось загрузить список запрещённых слов", sl.Err(err))
+			os.Exit(1)
+		}
+		blockedWords = append(blockedWords, words...)
+	}
+	aliasFilter, err := aliasfilter.New(aliasfilter.Rules{
+		Charset:   cfg.AliasFilter.Charset,
+		MinLength: cfg.AliasFilter.MinLength,
+		MaxLength: cfg.AliasFilter.MaxLength,
+		Case:      cfg.AliasFilter.Case,
+
+		CaseInsensitive: cfg.AliasFilter.CaseInsensitive,
+	}, cfg.AliasFilter.Reserved, blockedWords)
+	if err != nil {
+		log.Error("Некорректные настройки алиасов", sl.Err(err))
+		os.Exit(1)
+	}
+	if !aliasFilter.Allowed(strings.Repeat("a", int(cfg.AliasLength))) {
+		log.Error("alias_length не проходит правила alias_filter", slog.Int64("alias_length", cfg.AliasLength))
+		os.Exit(1)
+	}
+	if err := storage.SetCaseInsensitive(cfg.AliasFilter.CaseInsensitive); err != nil {
+		if errors.Is(err, urlstorage.ErrAliasCollisions) {
+			log.Error("Есть алиасы, различающиеся только регистром, список: url-admin alias-collisions", sl.Err(err))
+		} else {
+			log.Error("Не удалось переключить режим регистра алиасов", sl.Err(err))
+		}
+		os.Exit(1)
+	}
+
+	//журнал аудита от имени ключей клиентов, ссылки в нём в том же виде, что в ответах API
+	auditor := audit.New(func(data urlstorage.URLData) any { return link.New(data, resolver) })
+	requireKey := apikey.New(log, apiKeys)
+
 	//init router: chi, "chi-render"
 	router := chi.NewRouter()
 
@@ -65,8 +234,8 @@ func main() {
 	router.Use(middleware.RealIP)
 	router.Use(middleware.Logger) // логирует все запросы из минусов свой логгер
 	router.Use(middleware.Recoverer)
-	router.Use(middleware.URLFormat)
-	router.Use(mwLogger.New(*log)) // кастомный логгер
+	router.Use(mwLogger.New(*log))      // кастомный логгер
+	router.Use(mwLang.New(defaultLang)) // язык сообщений по Accept-Language
 
 	//routing breakpoints
 	//router.Route("/url", func(r chi.Router) {
@@ -80,29 +249,192 @@ func main() {
 	/*
 		TODO написать анотацию для swagger
 	*/
-	router.Get("/all", showAll.New(log, storage))
+	router.Get("/all", showAll.New(log, storage, resolver))
+	/*
+		TODO написать анотацию для swagger
+	*/
+	router.With(requireKey).Get("/url/export", exportUrls.New(log, storage))
+	/*
+		TODO написать анотацию для swagger
+	*/
+	router.With(requireKey).Get("/url/stats", stats.New(log, storage))
+	/*
+		TODO написать анотацию для swagger
+	*/
+	qrHandler := qr.New(log, storage, resolver)
+	router.Get("/url/{alias}/qr", qrHandler)
+	router.Get("/url/{alias}/qr.{format}", qrHandler)
+	/*
+		TODO написать анотацию для swagger
+	*/
+	router.With(requireKey).Get("/url/{id}/variants", stats.NewVariants(log, storage))
 	/*
 		TODO написать анотацию для swagger
 	*/
-	router.Get("/{alias}", redirect.New(log, storage))
+	router.With(requireKey).Get("/security/blocked", blocked.New(log, storage))
+	/*
+		TODO написать анотацию для swagger
+	*/
+	redirectHandler := redirect.New(log, storage, storage, resolver, errorPages, locator, safety, guard)
+	router.With(redirectLimit, scanGuard).Get("/*", redirectHandler)
+	// форма пароля отправляется на адрес самой ссылки
+	router.With(redirectLimit, scanGuard).Post("/*", redirectHandler)
 
 	//post
 
 	/*
 		TODO написать анотацию для swagger
 	*/
-	router.Post("/url", save.New(log, storage, cfg.AliasLength))
+	router.With(requireKey, saveLimit).Post("/url", save.New(log, storage, cfg.AliasLength, resolver, aliasFilter, auditor))
+	/*
+		TODO написать анотацию для swagger
+	*/
+	router.With(requireKey).Post("/url/edit", editAlias.New(log, storage, resolver, aliasFilter, auditor))
+	/*
+		TODO написать анотацию для swagger
+	*/
+	router.With(requireKey, saveLimit).Post("/url/batch", batch.New(log, storage, cfg.AliasLength, cfg.Batch.MaxSize, cfg.Batch.ChunkSize,
+		resolver, aliasFilter, auditor))
 	/*
 		TODO написать анотацию для swagger
 	*/
-	router.Post("/url/edit", editAlias.New(log, storage))
+	router.With(requireKey).Post("/url/import", importUrls.New(log, storage, resolver, aliasFilter, auditor))
 
 	//delete
 
 	/*
 		TODO написать анотацию для swagger
 	*/
-	router.Delete("/url/{id}", delete.Delete(log, storage))
+	router.With(requireKey).Delete("/url/{id}", delete.Delete(log, storage, auditor))
+
+	//корзина
+
+	/*
+		TODO написать анотацию для swagger
+	*/
+	router.With(requireKey).Get("/url/trash", trash.List(log, storage, resolver))
+
+	/*
+		TODO написать анотацию для swagger
+	*/
+	router.With(requireKey).Post("/url/{id}/restore", trash.Restore(log, storage, auditor))
+
+	//аудит
+
+	/*
+		TODO написать анотацию для swagger
+	*/
+	router.With(requireKey).Get("/audit", auditLog.New(log, storage))
+
+	//вебхуки
+
+	/*
+		TODO написать анотацию для swagger
+	*/
+	router.With(requireKey).Post("/webhooks", webhooks.Create(log, storage))
+
+	/*
+		TODO написать анотацию для swagger
+	*/
+	router.With(requireKey).Get("/webhooks", webhooks.List(log, storage))
+
+	/*
+		TODO написать анотацию для swagger
+	*/
+	router.With(requireKey).Delete("/webhooks/{id}", webhooks.Delete(log, storage))
+
+	/*
+		TODO написать анотацию для swagger
+	*/
+	router.With(requireKey).Get("/webhooks/deliveries", webhooks.Deliveries(log, storage))
+
+	/*
+		TODO написать анотацию для swagger
+	*/
+	router.With(requireKey).Post("/webhooks/deliveries/{id}/retry", webhooks.Retry(log, storage))
+
+	//GraphQL для дашборда
+
+	/*
+		TODO написать анотацию для swagger
+	*/
+	router.With(requireKey).Post("/graphql", graph.New(log, storage, resolver))
+
+	if cfg.Trash.Retention > 0 {
+		go purge.Run(context.Background(), log, storage, auditor, cfg.Trash.Retention, cfg.Trash.PurgeInterval)
+	}
+
+	if cfg.Webhooks.Enabled {
+		dispatcher := webhook.NewDispatcher(log, storage, webhook.Config{
+			Interval:    cfg.Webhooks.Interval,
+			BatchSize:   cfg.Webhooks.BatchSize,
+			Timeout:     cfg.Webhooks.Timeout,
+			MaxAttempts: cfg.Webhooks.MaxAttempts,
+			BaseBackoff: cfg.Webhooks.BaseBackoff,
+			MaxBackoff:  cfg.Webhooks.MaxBackoff,
+		})
+		go dispatcher.Run(context.Background())
+	}
+
+	if cfg.Events.Sink != "" {
+		publisher, err := eventPublisher(cfg.Events)
+		if err != nil {
+			log.Error("Не удалось подключить поток событий", sl.Err(err))
+			os.Exit(1)
+		}
+		storage.SetClickEvents(cfg.Events.Clicks)
+
+		relay := events.NewRelay(log, storage, publisher, events.RelayConfig{
+			Interval:  cfg.Events.Interval,
+			BatchSize: cfg.Events.BatchSize,
+			Timeout:   cfg.Events.Timeout,
+		})
+		go relay.Run(context.Background())
+	}
+
+	//очистка outbox: событие удаляется, когда его забрали все включённые потребители
+	if cfg.Outbox.Retention > 0 {
+		var consumers []string
+		if cfg.Webhooks.Enabled {
+			consumers = append(consumers, pgsql.WebhookConsumer)
+		}
+		if cfg.Events.Sink != "" {
+			consumers = append(consumers, pgsql.StreamConsumer)
+		}
+		go outbox.Run(context.Background(), log, storage, consumers, cfg.Outbox.Retention, cfg.Outbox.PurgeInterval)
+	}
+
+	//алиасы не должны перекрывать маршруты
+	routeWords, err := aliasfilter.RouteWords(router)
+	if err != nil {
+		log.Error("Не удалось обойти маршруты", sl.Err(err))
+		os.Exit(1)
+	}
+	aliasFilter.Reserve(routeWords...)
+
+	if cfg.GRPC.Enabled {
+		listener, err := net.Listen("tcp", cfg.GRPC.Address)
+		if err != nil {
+			log.Error("Не удалось открыть адрес gRPC сервера", slog.String("address", cfg.GRPC.Address), sl.Err(err))
+			os.Exit(1)
+		}
+
+		links := linkservice.New(log, storage, cfg.AliasLength, cfg.Batch.MaxSize, cfg.Batch.ChunkSize, resolver, aliasFilter, auditor)
+		grpcServer := grpcserver.New(log, links, grpcserver.Config{
+			Timeout:     cfg.GRPC.Timeout,
+			IdleTimeout: cfg.GRPC.IdleTimeout,
+			Keys:        apiKeys,
+			Lang:        defaultLang,
+		})
+
+		go func() {
+			log.Info("gRPC сервер запущен", slog.String("address", cfg.GRPC.Address))
+
+			if err := grpcServer.Serve(listener); err != nil {
+				log.Error("gRPC сервер остановлен", sl.Err(err))
+			}
+		}()
+	}
 
 	log.Info("сервер запущен", slog.String("address", cfg.Address), slog.String("env", cfg.Env))
 
@@ -122,3 +454,40 @@ func main() {
 
 	log.Error("сервер остановлен")
 }
+
+// noLimit middleware без ограничений для отключённых политик и защит
+func noLimit(next http.Handler) http.Handler {
+	return next
+}
+
+// rateLimit middleware лимита по настройкам политики, нулевые rate или burst отключают политику
+func rateLimit(log *slog.Logger, store ratelimit.Store, name string, cfg config.RateLimitPolicy,
+	keys []apikey.Key) (func(http.Handler) http.Handler, error) {
+	if cfg.Rate <= 0 || cfg.Burst <= 0 {
+		return noLimit, nil
+	}
+
+	key, err := ratelimit.ParseKey(cfg.Key, keys)
+	if err != nil {
+		return nil, fmt.Errorf("политика %s: %w", name, err)
+	}
+
+	return ratelimit.New(log, store, ratelimit.Policy{Name: name, Rate: cfg.Rate, Burst: cfg.Burst, Key: key}), nil
+}
+
+// eventPublisher приёмник потока событий по настройке sink
+func eventPublisher(cfg config.Events) (events.Publisher, error) {
+	switch cfg.Sink {
+	case "file":
+		return events.NewFilePublisher(cfg.File)
+	case "nats":
+		return events.NewNATSPublisher(events.NATSConfig{
+			URL:           cfg.NATS.URL,
+			Stream:        cfg.NATS.Stream,
+			SubjectPrefix: cfg.NATS.SubjectPrefix,
+			Timeout:       cfg.Timeout,
+		})
+	default:
+		return nil, fmt.Errorf("неизвестный приёмник событий %q, ожидается file или nats", cfg.Sink)
+	}
+}
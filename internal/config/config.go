@@ -10,11 +10,28 @@ import (
 )
 
 type Config struct {
-	Env         string `yaml:"env" env-default:"local"`
-	StoragePath string `yaml:"storage_path" env-required:"true"`
-	AliasLength int64  `yaml:"alias_length" env-required:"true"`
-	HTTPServer  `yaml:"http_server"`
-	PGSQL       `yaml:"pgsql"`
+	Env          string `yaml:"env" env-default:"local"`
+	StoragePath  string `yaml:"storage_path" env-required:"true"`
+	AliasLength  int64  `yaml:"alias_length" env-required:"true"`
+	BaseURL      string `yaml:"base_url"`              // публичный адрес сервиса для полных коротких ссылок, например https://sho.rt
+	Lang         string `yaml:"lang" env-default:"ru"` // язык сообщений API, если клиент не передал поддерживаемый Accept-Language: ru | en
+	HTTPServer   `yaml:"http_server"`
+	GRPC         GRPCServer `yaml:"grpc_server"`
+	PGSQL        `yaml:"pgsql"`
+	Batch        `yaml:"batch"`
+	ShortDomains `yaml:"short_domains"`
+	Pages        `yaml:"pages"`
+	GeoIP        `yaml:"geoip"`
+	Blocklist    `yaml:"blocklist"`
+	Protected    `yaml:"protected"`
+	RateLimit    `yaml:"rate_limit"`
+	ScanGuard    `yaml:"scan_guard"`
+	AliasFilter  `yaml:"alias_filter"`
+	Trash        `yaml:"trash"`
+	Webhooks     `yaml:"webhooks"`
+	Events       `yaml:"events"`
+	Outbox       `yaml:"outbox"`
+	APIKeys      []APIKey `yaml:"api_keys"` // ключи клиентов для изменения ссылок и чтения журнала аудита, пусто - без проверки
 }
 
 type HTTPServer struct {
@@ -23,6 +40,13 @@ type HTTPServer struct {
 	IdleTimeout time.Duration `yaml:"idle_timeout" env-default:"60s"`
 }
 
+type GRPCServer struct {
+	Enabled     bool          `yaml:"enabled" env-default:"true"`
+	Address     string        `yaml:"address" env-default:"localhost:8083"`
+	Timeout     time.Duration `yaml:"timeout" env-default:"4s"` // время на один вызов
+	IdleTimeout time.Duration `yaml:"idle_timeout" env-default:"60s"`
+}
+
 type PGSQL struct {
 	DBHost    string `yaml:"db_host" env-default:"localhost"`
 	DBPort    int    `yaml:"db_port" env-default:"5432"`
@@ -32,6 +56,111 @@ type PGSQL struct {
 	DBSSLMode string `yaml:"db_ssl_mode" env-default:"disable"`
 }
 
+type Batch struct {
+	MaxSize   int `yaml:"max_size" env-default:"10000"` // максимальное количество ссылок в одном запросе
+	ChunkSize int `yaml:"chunk_size" env-default:"500"` // количество ссылок, сохраняемых одной транзакцией
+}
+
+type ShortDomains struct {
+	Default string   `yaml:"default" env-default:"localhost:8082"` // домен коротких ссылок по умолчанию
+	List    []string `yaml:"list"`                                 // дополнительные домены, доступные при сохранении
+	Scheme  string   `yaml:"scheme" env-default:"http"`
+}
+
+type Pages struct {
+	TemplateDir string `yaml:"template_dir"` // каталог с layout.html и <state>.html, недостающие шаблоны берутся встроенные
+}
+
+type GeoIP struct {
+	DBPath string `yaml:"db_path"` // файл MMDB со странами для правил ссылок, без него правила по стране не срабатывают
+}
+
+type Blocklist struct {
+	Hosts     []string `yaml:"hosts"`      // домены назначения, переход на которые идёт через страницу предупреждения, вместе с поддоменами
+	HostsFile string   `yaml:"hosts_file"` // файл с доменами, по домену в строке
+}
+
+type Protected struct {
+	CookieSecret  string        `yaml:"cookie_secret" env:"PROTECTED_COOKIE_SECRET"` // ключ подписи cookie доступа, пустой - случайный на время работы процесса
+	CookieTTL     time.Duration `yaml:"cookie_ttl" env-default:"1h"`                 // сколько не спрашивать пароль повторно
+	MaxAttempts   int           `yaml:"max_attempts" env-default:"5"`                // неверных паролей с одного IP до блокировки
+	AttemptWindow time.Duration `yaml:"attempt_window" env-default:"15m"`
+}
+
+type RateLimit struct {
+	Enabled  bool            `yaml:"enabled" env-default:"true"`
+	Save     RateLimitPolicy `yaml:"save"`     // создание ссылок: POST /url и POST /url/batch
+	Redirect RateLimitPolicy `yaml:"redirect"` // переходы по коротким ссылкам
+}
+
+type RateLimitPolicy struct {
+	Rate  float64 `yaml:"rate"`  // запросов в секунду в среднем
+	Burst int     `yaml:"burst"` // запросов подряд без ожидания
+	Key   string  `yaml:"key"`   // ip | api_key | route
+}
+
+type ScanGuard struct {
+	Enabled       bool          `yaml:"enabled" env-default:"true"`
+	Window        time.Duration `yaml:"window" env-default:"1m"`
+	MinRequests   int           `yaml:"min_requests" env-default:"20"`     // переходов за окно, раньше клиент не оценивается
+	NotFoundRatio float64       `yaml:"not_found_ratio" env-default:"0.5"` // доля 404, при которой клиент блокируется
+	BaseBlock     time.Duration `yaml:"base_block" env-default:"1m"`       // первая блокировка, следующие вдвое длиннее
+	MaxBlock      time.Duration `yaml:"max_block" env-default:"1h"`
+	ResetAfter    time.Duration `yaml:"reset_after" env-default:"24h"` // через сколько без блокировок эскалация сбрасывается
+}
+
+type AliasFilter struct {
+	Charset          string   `yaml:"charset" env-default:"A-Za-z0-9_-"` // допустимые символы, содержимое класса [...] регулярного выражения
+	MinLength        int      `yaml:"min_length" env-default:"1"`
+	MaxLength        int      `yaml:"max_length" env-default:"64"`
+	Case             string   `yaml:"case" env-default:"preserve"` // preserve | fold (привести к нижнему) | lower_only (отклонить заглавные)
+	Reserved         []string `yaml:"reserved"`                    // алиасы, которые нельзя выдать целиком, первые сегменты маршрутов добавляются сами
+	BlockedWords     []string `yaml:"blocked_words"`               // слова, которые не должны встречаться внутри алиаса
+	BlockedWordsFile string   `yaml:"blocked_words_file"`          // файл со словами, по слову в строке
+	CaseInsensitive  bool     `yaml:"case_insensitive"`            // поиск алиасов без учёта регистра, перед включением: url-admin alias-collisions
+}
+
+type Trash struct {
+	Retention     time.Duration `yaml:"retention" env-default:"720h"`    // сколько удалённая ссылка хранится в корзине, 0 - бессрочно
+	PurgeInterval time.Duration `yaml:"purge_interval" env-default:"1h"` // как часто удалять ссылки с истёкшим сроком хранения
+}
+
+type Webhooks struct {
+	Enabled     bool          `yaml:"enabled" env-default:"true"`
+	Interval    time.Duration `yaml:"interval" env-default:"5s"`      // как часто разбирать очередь событий
+	BatchSize   int           `yaml:"batch_size" env-default:"100"`   // событий и доставок за один проход
+	Timeout     time.Duration `yaml:"timeout" env-default:"10s"`      // ожидание ответа подписчика
+	MaxAttempts int           `yaml:"max_attempts" env-default:"8"`   // попыток до попадания в недоставленные
+	BaseBackoff time.Duration `yaml:"base_backoff" env-default:"10s"` // пауза перед второй попыткой, дальше вдвое длиннее
+	MaxBackoff  time.Duration `yaml:"max_backoff" env-default:"1h"`
+}
+
+type Events struct {
+	Sink      string        `yaml:"sink"`                         // пусто - поток выключен | file | nats
+	File      string        `yaml:"file"`                         // для sink: file, пусто или "-" - stdout
+	Clicks    bool          `yaml:"clicks" env-default:"true"`    // публиковать link.clicked на каждый переход
+	Interval  time.Duration `yaml:"interval" env-default:"1s"`    // как часто забирать события из outbox
+	BatchSize int           `yaml:"batch_size" env-default:"500"` // событий в одной публикации
+	Timeout   time.Duration `yaml:"timeout" env-default:"10s"`    // ожидание подтверждения пачки брокером
+	NATS      EventsNATS    `yaml:"nats"`
+}
+
+type EventsNATS struct {
+	URL           string `yaml:"url" env-default:"nats://localhost:4222"`
+	Stream        string `yaml:"stream" env-default:"URL_SHORTENER"` // поток JetStream, пусто - не создавать
+	SubjectPrefix string `yaml:"subject_prefix" env-default:"url_shortener"`
+}
+
+type Outbox struct {
+	Retention     time.Duration `yaml:"retention" env-default:"168h"`    // сколько хранятся разобранные события и завершённые доставки вебхуков, 0 - бессрочно
+	PurgeInterval time.Duration `yaml:"purge_interval" env-default:"1h"` // как часто удалять устаревшие записи
+}
+
+type APIKey struct {
+	Name string `yaml:"name"` // имя клиента в журнале аудита
+	Key  string `yaml:"key"`
+}
+
 func MustLoad() *Config {
 	err := godotenv.Load("../../.env")
 	if err != nil {
@@ -44,6 +173,13 @@ func MustLoad() *Config {
 		log.Fatal("CONFIG_PATH нет такой переменной в env")
 	}
 
+	return MustLoadPath(configPath)
+}
+
+/*
+MustLoadPath чтение конфига по явному пути, без .env
+*/
+func MustLoadPath(configPath string) *Config {
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
 		log.Fatalf("файла конфига нет по указанному пути: %s", configPath)
 	}
@@ -0,0 +1,407 @@
+package linkservice
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	linkv1 "url-shoter/api/link/v1"
+	"url-shoter/internal/http-server/handlers/url/batch"
+	"url-shoter/internal/http-server/handlers/url/save"
+	"url-shoter/internal/lib/actor"
+	"url-shoter/internal/lib/aliasfilter"
+	"url-shoter/internal/lib/api/link"
+	resp "url-shoter/internal/lib/api/response"
+	"url-shoter/internal/lib/audit"
+	"url-shoter/internal/lib/domains"
+	"url-shoter/internal/lib/i18n"
+	"url-shoter/internal/lib/logger/sl"
+	"url-shoter/internal/storage"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// errorDomain домен причин ошибок в google.rpc.ErrorInfo, причина - код ошибки REST API
+const errorDomain = "url-shoter"
+
+/*
+Storage методы хранилища, те же что используют обработчики REST
+*/
+type Storage interface {
+	batch.URLBatchSaver
+	GetUrlDataById(id int64) (storage.URLData, error)
+	GetRedirect(domain string, alias string) (storage.URLData, error)
+	ReplacementAliasByID(id int64, alias string, trail *audit.Trail) (int64, error)
+	DeleteById(id int64, actor string, trail *audit.Trail) error
+	ListUrls(filter storage.ListFilter) ([]storage.URLData, error)
+	VariantStats(id int64) ([]storage.VariantStat, error)
+}
+
+/*
+Service LinkService поверх хранилища, правила алиасов и журнал аудита общие с REST API
+*/
+type Service struct {
+	linkv1.UnimplementedLinkServiceServer
+
+	log         *slog.Logger
+	storage     Storage
+	aliasLength int64
+	maxBatch    int
+	chunkSize   int
+	resolver    *domains.Resolver
+	filter      *aliasfilter.Filter
+	auditor     *audit.Logger
+}
+
+func New(log *slog.Logger, storage Storage, aliasLength int64, maxBatch int, chunkSize int, resolver *domains.Resolver,
+	filter *aliasfilter.Filter, auditor *audit.Logger) *Service {
+	return &Service{
+		log:         log.With(slog.String("component", "grpc/linkservice")),
+		storage:     storage,
+		aliasLength: aliasLength,
+		maxBatch:    maxBatch,
+		chunkSize:   chunkSize,
+		resolver:    resolver,
+		filter:      filter,
+		auditor:     auditor,
+	}
+}
+
+func (s *Service) Create(ctx context.Context, req *linkv1.CreateRequest) (*linkv1.CreateResponse, error) {
+	if req.GetExpiresAt() != nil && !req.GetExpiresAt().AsTime().After(time.Now()) {
+		return nil, s.fail(ctx, resp.Unprocessable(resp.CodeInvalidExpiry, i18n.MsgExpiryInPast))
+	}
+
+	results, saved := batch.Save(s.log, lang(ctx), s.storage, []save.Request{saveRequest(req)}, s.aliasLength, 0, s.resolver, s.filter,
+		s.auditor.TrailFrom(source(ctx)))
+	if results[0].ID == 0 {
+		return nil, statusError(results[0].Code, results[0].Error)
+	}
+
+	data, err := s.storage.GetUrlDataById(results[0].ID)
+	if err != nil {
+		// ссылка уже сохранена, отвечаем тем что известно без даты создания
+		s.log.Error("не удалось прочитать сохранённый URL", slog.Int64("id", results[0].ID), sl.Err(err))
+		data = saved[0]
+	}
+
+	return &linkv1.CreateResponse{Link: toProto(link.New(data, s.resolver))}, nil
+}
+
+func (s *Service) BatchCreate(ctx context.Context, req *linkv1.BatchCreateRequest) (*linkv1.BatchCreateResponse, error) {
+	if len(req.GetLinks()) > s.maxBatch {
+		return nil, s.fail(ctx, resp.NewError(http.StatusRequestEntityTooLarge, resp.CodeBatchTooLarge, i18n.MsgBatchTooLarge, s.maxBatch))
+	}
+
+	reqs := make([]save.Request, len(req.GetLinks()))
+	for i, r := range req.GetLinks() {
+		reqs[i] = saveRequest(r)
+	}
+
+	results, saved := batch.Save(s.log, lang(ctx), s.storage, reqs, s.aliasLength, s.chunkSize, s.resolver, s.filter,
+		s.auditor.TrailFrom(source(ctx)))
+
+	res := &linkv1.BatchCreateResponse{Results: make([]*linkv1.BatchCreateResult, len(results))}
+	for i, r := range results {
+		res.Results[i] = &linkv1.BatchCreateResult{Index: int32(r.Index), Code: string(r.Code), Error: r.Error}
+		if r.ID == 0 {
+			continue
+		}
+
+		res.Results[i].Link = toProto(link.New(saved[i], s.resolver))
+	}
+
+	return res, nil
+}
+
+func (s *Service) Get(ctx context.Context, req *linkv1.GetRequest) (*linkv1.GetResponse, error) {
+	data, err := s.active(req.GetId())
+	if err != nil {
+		return nil, s.fail(ctx, resp.FromStorage(err, storageMessage(err, i18n.MsgIDNotFound)))
+	}
+
+	return &linkv1.GetResponse{Link: toProto(link.New(data, s.resolver))}, nil
+}
+
+/*
+Resolve адрес назначения по умолчанию, правила и варианты A/B теста не применяются, переход не учитывается.
+Адрес ссылки с паролем не раскрывается
+*/
+func (s *Service) Resolve(ctx context.Context, req *linkv1.ResolveRequest) (*linkv1.ResolveResponse, error) {
+	domain, err := s.resolver.Key(req.GetDomain())
+	if err != nil {
+		return nil, s.fail(ctx, resp.Unprocessable(resp.CodeDomainNotAllowed, i18n.MsgDomainNotAllowed))
+	}
+
+	data, err := s.storage.GetRedirect(domain, req.GetAlias())
+	if err != nil {
+		return nil, s.fail(ctx, resp.FromStorage(err, storageMessage(err, i18n.MsgNotFound)))
+	}
+
+	if data.PasswordHash != "" {
+		return nil, s.fail(ctx, resp.NewError(http.StatusUnauthorized, resp.CodePasswordRequired, i18n.MsgPasswordRequired))
+	}
+
+	return &linkv1.ResolveResponse{Url: data.Url, Link: toProto(link.New(data, s.resolver))}, nil
+}
+
+/*
+Update смена алиаса, как POST /url/edit
+*/
+func (s *Service) Update(ctx context.Context, req *linkv1.UpdateRequest) (*linkv1.UpdateResponse, error) {
+	alias, err := s.filter.Check(req.GetAlias())
+	if err != nil {
+		return nil, s.fail(ctx, resp.InvalidAlias(err))
+	}
+
+	before, err := s.active(req.GetId())
+	if err != nil {
+		return nil, s.fail(ctx, resp.FromStorage(err, storageMessage(err, i18n.MsgIDNotFound)))
+	}
+
+	if _, err = s.storage.ReplacementAliasByID(req.GetId(), alias, s.auditor.TrailFrom(source(ctx))); err != nil {
+		return nil, s.fail(ctx, resp.FromStorage(err, i18n.MsgEditAliasFailed))
+	}
+
+	after, err := s.storage.GetUrlDataById(req.GetId())
+	if err != nil {
+		s.log.Error("не удалось прочитать URL после смены алиаса", slog.Int64("id", req.GetId()), sl.Err(err))
+		after = before
+		after.Alias = alias
+	}
+
+	return &linkv1.UpdateResponse{Link: toProto(link.New(after, s.resolver))}, nil
+}
+
+/*
+Delete перенос в корзину, как DELETE /url/{id}
+*/
+func (s *Service) Delete(ctx context.Context, req *linkv1.DeleteRequest) (*linkv1.DeleteResponse, error) {
+	if _, err := s.active(req.GetId()); err != nil {
+		return nil, s.fail(ctx, resp.FromStorage(err, storageMessage(err, i18n.MsgIDNotFound)))
+	}
+
+	src := source(ctx)
+	if err := s.storage.DeleteById(req.GetId(), src.Actor, s.auditor.TrailFrom(src)); err != nil {
+		return nil, s.fail(ctx, resp.FromStorage(err, storageMessage(err, i18n.MsgDeleteFailed)))
+	}
+
+	return &linkv1.DeleteResponse{}, nil
+}
+
+/*
+List активные ссылки по возрастанию id. page_token - id последней ссылки предыдущей страницы
+*/
+func (s *Service) List(ctx context.Context, req *linkv1.ListRequest) (*linkv1.ListResponse, error) {
+	size := int(req.GetPageSize())
+	switch {
+	case size == 0:
+		size = defaultPageSize
+	case size < 0 || size > maxPageSize:
+		return nil, s.fail(ctx, resp.BadRequest(resp.CodeInvalidParam, i18n.MsgInvalidLimit, maxPageSize))
+	}
+
+	var after int64
+	if token := req.GetPageToken(); token != "" {
+		var err error
+		if after, err = strconv.ParseInt(token, 10, 64); err != nil || after < 0 {
+			return nil, s.fail(ctx, resp.BadRequest(resp.CodeInvalidParam, i18n.MsgInvalidPageToken))
+		}
+	}
+
+	// лишняя запись показывает, есть ли следующая страница
+	list, err := s.storage.ListUrls(storage.ListFilter{Campaign: req.GetCampaign(), AfterID: after, Limit: size + 1})
+	if err != nil {
+		return nil, s.fail(ctx, resp.Internal(i18n.MsgListFailed, err))
+	}
+
+	res := &linkv1.ListResponse{}
+	if len(list) > size {
+		list = list[:size]
+		res.NextPageToken = strconv.FormatInt(list[size-1].Id, 10)
+	}
+
+	res.Links = make([]*linkv1.Link, len(list))
+	for i, data := range list {
+		res.Links[i] = toProto(link.New(data, s.resolver))
+	}
+
+	return res, nil
+}
+
+func (s *Service) Stats(ctx context.Context, req *linkv1.StatsRequest) (*linkv1.StatsResponse, error) {
+	data, err := s.active(req.GetId())
+	if err != nil {
+		return nil, s.fail(ctx, resp.FromStorage(err, storageMessage(err, i18n.MsgIDNotFound)))
+	}
+
+	variants, err := s.storage.VariantStats(req.GetId())
+	if err != nil {
+		return nil, s.fail(ctx, resp.FromStorage(err, i18n.MsgStatsFailed))
+	}
+
+	res := &linkv1.StatsResponse{Id: data.Id, Clicks: data.Clicks, Variants: make([]*linkv1.VariantStats, len(variants))}
+	for i, v := range variants {
+		res.Variants[i] = &linkv1.VariantStats{Variant: int32(v.Variant), Url: v.URL, Weight: int32(v.Weight), Clicks: v.Clicks}
+	}
+
+	return res, nil
+}
+
+// active ссылка по id, ссылка в корзине - storage.ErrURLDeleted
+func (s *Service) active(id int64) (storage.URLData, error) {
+	data, err := s.storage.GetUrlDataById(id)
+	if err != nil {
+		return data, err
+	}
+	if data.DeletedAt != nil {
+		return data, storage.ErrURLDeleted
+	}
+
+	return data, nil
+}
+
+// fail ошибка API в статус gRPC на языке запроса, внутренние ошибки пишутся в лог
+func (s *Service) fail(ctx context.Context, apiErr *resp.APIError) error {
+	if apiErr.Code == resp.CodeInternal {
+		s.log.Error("ошибка обработки запроса", slog.String("request_id", middleware.GetReqID(ctx)), sl.Err(apiErr))
+	}
+
+	return statusError(apiErr.Code, apiErr.Message(lang(ctx)))
+}
+
+/*
+statusError код ошибки REST API в код gRPC, сам код уходит в ErrorInfo.Reason
+*/
+func statusError(code resp.Code, msg string) error {
+	var grpcCode codes.Code
+	switch code {
+	case resp.CodeNotFound, resp.CodeURLNotFound:
+		grpcCode = codes.NotFound
+	case resp.CodeAliasExists, resp.CodeIDExists, resp.CodeConflict:
+		grpcCode = codes.AlreadyExists
+	case resp.CodeURLExpired, resp.CodeURLDeleted:
+		grpcCode = codes.FailedPrecondition
+	case resp.CodePasswordRequired, resp.CodeInvalidPassword:
+		grpcCode = codes.PermissionDenied
+	case resp.CodeUnauthorized:
+		grpcCode = codes.Unauthenticated
+	case resp.CodeTooManyRequests:
+		grpcCode = codes.ResourceExhausted
+	case resp.CodeInternal:
+		grpcCode = codes.Internal
+	default:
+		grpcCode = codes.InvalidArgument
+	}
+
+	st := status.New(grpcCode, msg)
+	if detailed, err := st.WithDetails(&errdetails.ErrorInfo{Reason: string(code), Domain: errorDomain}); err == nil {
+		st = detailed
+	}
+
+	return st.Err()
+}
+
+// storageMessage сообщение для известных ошибок хранилища, иначе def
+func storageMessage(err error, def i18n.Key) i18n.Key {
+	switch {
+	case errors.Is(err, storage.ErrURLNotFound):
+		return i18n.MsgIDNotFound
+	case errors.Is(err, storage.ErrURLDeleted):
+		return i18n.MsgURLDeleted
+	case errors.Is(err, storage.ErrURLExpired):
+		return i18n.MsgURLExpired
+	}
+
+	return def
+}
+
+// lang язык сообщений, выбранный перехватчиком сервера
+func lang(ctx context.Context) i18n.Lang {
+	return i18n.FromContext(ctx, i18n.DefaultLang)
+}
+
+// source кто выполняет вызов для журнала аудита, по тем же правилам что actor.FromRequest
+func source(ctx context.Context) audit.Source {
+	src := audit.Source{RequestID: middleware.GetReqID(ctx)}
+
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		src.IP = p.Addr.String()
+		if host, _, err := net.SplitHostPort(src.IP); err == nil {
+			src.IP = host
+		}
+	}
+
+	keys := metadata.ValueFromIncomingContext(ctx, actor.APIKeyHeader)
+	switch name, ok := actor.Name(ctx); {
+	case ok:
+		src.Actor = "key:" + name
+	case len(keys) > 0 && keys[0] != "":
+		src.Actor = "key:" + actor.Fingerprint(keys[0])
+	default:
+		src.Actor = "ip:" + src.IP
+	}
+
+	return src
+}
+
+func saveRequest(req *linkv1.CreateRequest) save.Request {
+	r := save.Request{
+		URL:          req.GetUrl(),
+		Alias:        req.GetAlias(),
+		Domain:       req.GetDomain(),
+		RedirectType: int(req.GetRedirectType()),
+		Preview:      req.GetPreview(),
+		ForwardQuery: req.GetForwardQuery(),
+		ForwardPath:  req.GetForwardPath(),
+		Password:     req.GetPassword(),
+	}
+	if req.GetExpiresAt() != nil {
+		expiresAt := req.GetExpiresAt().AsTime()
+		r.ExpiresAt = &expiresAt
+	}
+
+	return r
+}
+
+func toProto(l *link.Link) *linkv1.Link {
+	res := &linkv1.Link{
+		Id:           l.ID,
+		Alias:        l.Alias,
+		Url:          l.URL,
+		Domain:       l.Domain,
+		ShortUrl:     l.ShortURL,
+		QrCodeUrl:    l.QRCodeURL,
+		Title:        l.Title,
+		Clicks:       l.Clicks,
+		Campaign:     l.Campaign,
+		RedirectType: int32(l.RedirectType),
+		Preview:      l.Preview,
+		ForwardQuery: l.ForwardQuery,
+		ForwardPath:  l.ForwardPath,
+		Protected:    l.Protected,
+	}
+	if l.CreatedAt != nil {
+		res.CreatedAt = timestamppb.New(*l.CreatedAt)
+	}
+	if l.ExpiresAt != nil {
+		res.ExpiresAt = timestamppb.New(*l.ExpiresAt)
+	}
+
+	return res
+}
@@ -0,0 +1,234 @@
+package linkservice_test
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	linkv1 "url-shoter/api/link/v1"
+	grpcserver "url-shoter/internal/grpc-server"
+	"url-shoter/internal/grpc-server/linkservice"
+	"url-shoter/internal/http-server/middleware/apikey"
+	"url-shoter/internal/lib/aliasfilter"
+	"url-shoter/internal/lib/audit"
+	"url-shoter/internal/lib/domains"
+	"url-shoter/internal/lib/i18n"
+	"url-shoter/internal/lib/logger/handlers/slogdiscard"
+	"url-shoter/internal/storage"
+)
+
+// fakeStorage ссылки в памяти по возрастанию id
+type fakeStorage struct {
+	links []storage.URLData
+}
+
+func (f *fakeStorage) SaveUrlBatch(items []storage.URLData, _ *audit.Trail) ([]storage.SaveResult, error) {
+	results := make([]storage.SaveResult, len(items))
+	for i, item := range items {
+		item.Id = int64(len(f.links) + 1)
+		item.CreatedAt = time.Now()
+		f.links = append(f.links, item)
+		results[i].Id = item.Id
+	}
+	return results, nil
+}
+
+func (f *fakeStorage) GetUrlDataById(id int64) (storage.URLData, error) {
+	for _, l := range f.links {
+		if l.Id == id {
+			return l, nil
+		}
+	}
+	return storage.URLData{}, storage.ErrURLNotFound
+}
+
+func (f *fakeStorage) GetRedirect(domain string, alias string) (storage.URLData, error) {
+	for _, l := range f.links {
+		if l.Domain == domain && l.Alias == alias {
+			return l, nil
+		}
+	}
+	return storage.URLData{}, storage.ErrURLNotFound
+}
+
+func (f *fakeStorage) ReplacementAliasByID(id int64, alias string, _ *audit.Trail) (int64, error) {
+	f.links[id-1].Alias = alias
+	return id, nil
+}
+
+func (f *fakeStorage) DeleteById(id int64, actor string, _ *audit.Trail) error {
+	now := time.Now()
+	f.links[id-1].DeletedAt, f.links[id-1].DeletedBy = &now, actor
+	return nil
+}
+
+func (f *fakeStorage) ListUrls(filter storage.ListFilter) ([]storage.URLData, error) {
+	var list []storage.URLData
+	for _, l := range f.links {
+		if l.Id > filter.AfterID && l.DeletedAt == nil && (filter.Limit == 0 || len(list) < filter.Limit) {
+			list = append(list, l)
+		}
+	}
+	return list, nil
+}
+
+func (f *fakeStorage) VariantStats(id int64) ([]storage.VariantStat, error) { return nil, nil }
+
+func newClient(t *testing.T, store *fakeStorage) (linkv1.LinkServiceClient, *grpc.ClientConn) {
+	t.Helper()
+
+	log := slogdiscard.NewDiscardLogger()
+	filter, err := aliasfilter.New(aliasfilter.DefaultRules, []string{"admin"}, nil)
+	require.NoError(t, err)
+	resolver, err := domains.New("", "sho.rt", nil, "https")
+	require.NoError(t, err)
+
+	srv := grpcserver.New(log, linkservice.New(log, store, 6, 2, 0, resolver, filter, nil), grpcserver.Config{
+		Timeout: time.Second,
+		Keys:    []apikey.Key{{Name: "ci", Value: "secret"}},
+		Lang:    i18n.DefaultLang,
+	})
+
+	listener := bufconn.Listen(1 << 20)
+	go func() { _ = srv.Serve(listener) }()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return linkv1.NewLinkServiceClient(conn), conn
+}
+
+func withKey(key string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "x-api-key", key)
+}
+
+func TestCreate(t *testing.T) {
+	client, _ := newClient(t, &fakeStorage{})
+
+	_, err := client.Create(context.Background(), &linkv1.CreateRequest{Url: "https://go.dev"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = client.Create(withKey("wrong"), &linkv1.CreateRequest{Url: "https://go.dev"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	res, err := client.Create(withKey("secret"), &linkv1.CreateRequest{Url: "https://go.dev", Alias: "go"})
+	require.NoError(t, err)
+	assert.Equal(t, "go", res.GetLink().GetAlias())
+	assert.Equal(t, "https://sho.rt/go", res.GetLink().GetShortUrl())
+	assert.NotNil(t, res.GetLink().GetCreatedAt())
+
+	_, err = client.Create(withKey("secret"), &linkv1.CreateRequest{Url: "https://go.dev", Alias: "Admin"})
+	st := status.Convert(err)
+	require.Equal(t, codes.InvalidArgument, st.Code())
+	require.Len(t, st.Details(), 1)
+	assert.Equal(t, "alias_not_allowed", st.Details()[0].(*errdetails.ErrorInfo).GetReason())
+
+	_, err = client.Create(withKey("secret"), &linkv1.CreateRequest{Url: "not a url"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// 42 символа кириллицы проходят max=72 валидатора, но занимают 84 байта
+	_, err = client.Create(withKey("secret"), &linkv1.CreateRequest{Url: "https://go.dev", Password: strings.Repeat("пароль", 7)})
+	st = status.Convert(err)
+	require.Equal(t, codes.InvalidArgument, st.Code())
+	assert.Equal(t, "validation_failed", st.Details()[0].(*errdetails.ErrorInfo).GetReason())
+
+	batch, err := client.BatchCreate(withKey("secret"), &linkv1.BatchCreateRequest{Links: []*linkv1.CreateRequest{
+		{Url: "https://ya.ru"}, {Url: "bad"},
+	}})
+	require.NoError(t, err)
+	require.Len(t, batch.GetResults(), 2)
+	assert.NotNil(t, batch.GetResults()[0].GetLink())
+	assert.Equal(t, "validation_failed", batch.GetResults()[1].GetCode())
+
+	_, err = client.BatchCreate(withKey("secret"), &linkv1.BatchCreateRequest{Links: []*linkv1.CreateRequest{
+		{Url: "https://ya.ru"}, {Url: "https://ya.ru"}, {Url: "https://ya.ru"},
+	}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestReadMethods(t *testing.T) {
+	store := &fakeStorage{links: []storage.URLData{
+		{Id: 1, Alias: "a", Url: "https://a.example"},
+		{Id: 2, Alias: "b", Url: "https://b.example", Options: storage.Options{PasswordHash: "hash"}},
+		{Id: 3, Alias: "c", Url: "https://c.example"},
+		{Id: 4, Alias: "d", Url: "https://d.example"},
+	}}
+	client, conn := newClient(t, store)
+	ctx := context.Background()
+
+	resolved, err := client.Resolve(ctx, &linkv1.ResolveRequest{Alias: "a"})
+	require.NoError(t, err)
+	assert.Equal(t, "https://a.example", resolved.GetUrl())
+
+	_, err = client.Resolve(ctx, &linkv1.ResolveRequest{Alias: "b"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = client.Resolve(ctx, &linkv1.ResolveRequest{Alias: "missing"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = client.Delete(withKey("secret"), &linkv1.DeleteRequest{Id: 3})
+	require.NoError(t, err)
+	assert.Equal(t, "key:ci", store.links[2].DeletedBy)
+
+	_, err = client.Get(withKey("secret"), &linkv1.GetRequest{Id: 3})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	page, err := client.List(withKey("secret"), &linkv1.ListRequest{PageSize: 2})
+	require.NoError(t, err)
+	require.Len(t, page.GetLinks(), 2)
+	assert.Equal(t, "2", page.GetNextPageToken())
+
+	page, err = client.List(withKey("secret"), &linkv1.ListRequest{PageSize: 2, PageToken: page.GetNextPageToken()})
+	require.NoError(t, err)
+	require.Len(t, page.GetLinks(), 1)
+	assert.Equal(t, int64(4), page.GetLinks()[0].GetId())
+	assert.Empty(t, page.GetNextPageToken())
+
+	_, err = client.List(withKey("secret"), &linkv1.ListRequest{PageToken: "abc"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	health, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: "link.v1.LinkService"})
+	require.NoError(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, health.GetStatus())
+}
+
+func TestProtectedMethods(t *testing.T) {
+	client, _ := newClient(t, &fakeStorage{links: []storage.URLData{{Id: 1, Alias: "a", Url: "https://a.example"}}})
+	ctx := context.Background()
+
+	_, err := client.Get(ctx, &linkv1.GetRequest{Id: 1})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = client.List(ctx, &linkv1.ListRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = client.Stats(ctx, &linkv1.StatsRequest{Id: 1})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = client.Stats(withKey("wrong"), &linkv1.StatsRequest{Id: 1})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = client.Stats(withKey("secret"), &linkv1.StatsRequest{Id: 1})
+	assert.NoError(t, err)
+
+	// Resolve открыт, как редирект
+	_, err = client.Resolve(ctx, &linkv1.ResolveRequest{Alias: "a"})
+	assert.NoError(t, err)
+}
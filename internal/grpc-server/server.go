@@ -0,0 +1,182 @@
+package grpcserver
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+
+	linkv1 "url-shoter/api/link/v1"
+	"url-shoter/internal/http-server/middleware/apikey"
+	"url-shoter/internal/lib/actor"
+	"url-shoter/internal/lib/i18n"
+	"url-shoter/internal/lib/logger/sl"
+)
+
+/*
+Ключи метаданных запроса, те же заголовки что и в REST API в нижнем регистре
+*/
+var (
+	MetadataAPIKey    = strings.ToLower(actor.APIKeyHeader)
+	MetadataRequestID = "x-request-id"
+	MetadataLang      = "accept-language"
+)
+
+// protected методы требуют API ключ как соответствующие маршруты REST. Открыт только Resolve,
+// как редирект: Get, List и Stats отдают ссылки, в том числе защищённые паролем, и статистику
+var protected = map[string]bool{
+	linkv1.LinkService_Create_FullMethodName:      true,
+	linkv1.LinkService_BatchCreate_FullMethodName: true,
+	linkv1.LinkService_Get_FullMethodName:         true,
+	linkv1.LinkService_Update_FullMethodName:      true,
+	linkv1.LinkService_Delete_FullMethodName:      true,
+	linkv1.LinkService_List_FullMethodName:        true,
+	linkv1.LinkService_Stats_FullMethodName:       true,
+}
+
+/*
+Config Timeout - время на один вызов, IdleTimeout - закрытие соединения без вызовов.
+Пустой Keys отключает проверку API ключа, Lang - язык сообщений об ошибках без accept-language в метаданных
+*/
+type Config struct {
+	Timeout     time.Duration
+	IdleTimeout time.Duration
+	Keys        []apikey.Key
+	Lang        i18n.Lang
+}
+
+/*
+New gRPC сервер с LinkService, health и reflection
+*/
+func New(log *slog.Logger, links linkv1.LinkServiceServer, cfg Config) *grpc.Server {
+	log = log.With(slog.String("component", "grpc-server"))
+
+	srv := grpc.NewServer(
+		grpc.KeepaliveParams(keepalive.ServerParameters{MaxConnectionIdle: cfg.IdleTimeout}),
+		grpc.ChainUnaryInterceptor(
+			requestContext(cfg.Lang, cfg.Timeout),
+			logging(log),
+			recovery(log),
+			auth(log, cfg.Keys),
+		),
+	)
+
+	linkv1.RegisterLinkServiceServer(srv, links)
+
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus(linkv1.LinkService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(srv, healthServer)
+
+	reflection.Register(srv)
+
+	return srv
+}
+
+// requestContext id запроса для логов и журнала аудита, язык сообщений и срок вызова, как middleware REST
+func requestContext(def i18n.Lang, timeout time.Duration) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		requestID := first(ctx, MetadataRequestID)
+		if requestID == "" {
+			requestID = fmt.Sprintf("grpc-%06d", middleware.NextRequestID())
+		}
+		ctx = context.WithValue(ctx, middleware.RequestIDKey, requestID)
+
+		return handler(i18n.WithLang(ctx, i18n.Match(first(ctx, MetadataLang), def)), req)
+	}
+}
+
+func logging(log *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+
+		res, err := handler(ctx, req)
+
+		log.Info("request completed",
+			slog.String("method", info.FullMethod),
+			slog.String("code", status.Code(err).String()),
+			slog.String("request_id", middleware.GetReqID(ctx)),
+			slog.String("duration", time.Since(start).String()),
+		)
+
+		return res, err
+	}
+}
+
+// recovery паника обработчика становится ошибкой Internal, сервер продолжает работу
+func recovery(log *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (res any, err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				log.Error("паника в обработчике", slog.String("method", info.FullMethod),
+					sl.Err(fmt.Errorf("%v", p)))
+
+				err = status.Error(codes.Internal, i18n.T(i18n.FromContext(ctx, i18n.DefaultLang), i18n.MsgInternal))
+			}
+		}()
+
+		return handler(ctx, req)
+	}
+}
+
+// auth проверка x-api-key по тем же правилам, что и apikey.New: известный ключ сохраняет имя клиента в контексте
+func auth(log *slog.Logger, keys []apikey.Key) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if len(keys) == 0 {
+			return handler(ctx, req)
+		}
+
+		value := first(ctx, MetadataAPIKey)
+
+		var name string
+		var ok bool
+		if value != "" {
+			name, ok = apikey.Lookup(keys, value)
+		}
+		if ok {
+			ctx = actor.WithName(ctx, name)
+		}
+
+		// открытые методы не требуют ключа, как маршруты REST без apikey.New
+		if ok || !protected[info.FullMethod] {
+			return handler(ctx, req)
+		}
+
+		lang := i18n.FromContext(ctx, i18n.DefaultLang)
+
+		if value == "" {
+			log.Info("запрос без API ключа", slog.String("method", info.FullMethod))
+
+			return nil, status.Error(codes.Unauthenticated, i18n.T(lang, i18n.MsgAPIKeyRequired))
+		}
+
+		log.Warn("неизвестный API ключ", slog.String("method", info.FullMethod), slog.String("key", actor.Fingerprint(value)))
+
+		return nil, status.Error(codes.Unauthenticated, i18n.T(lang, i18n.MsgAPIKeyInvalid))
+	}
+}
+
+// first первое значение ключа метаданных запроса
+func first(ctx context.Context, key string) string {
+	if values := metadata.ValueFromIncomingContext(ctx, key); len(values) > 0 {
+		return values[0]
+	}
+
+	return ""
+}
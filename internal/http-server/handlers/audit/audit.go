@@ -0,0 +1,104 @@
+package audit
+
+import (
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+	resp "url-shoter/internal/lib/api/response"
+	"url-shoter/internal/lib/audit"
+	"url-shoter/internal/lib/i18n"
+	"url-shoter/internal/lib/logger/sl"
+)
+
+const (
+	defaultLimit = 100
+	maxLimit     = 1000
+)
+
+type LogGetter interface {
+	AuditLog(filter audit.Filter) ([]audit.Entry, error)
+}
+
+type Response struct {
+	resp.Response
+	Entries []audit.Entry `json:"entries"`
+}
+
+/*
+New журнал изменений ссылок, новые первыми. Фильтры: ?link_id=, ?actor=, ?from= и ?to= в RFC 3339
+(to не включается), ?limit= до 1000
+*/
+func New(log *slog.Logger, getter LogGetter) http.HandlerFunc {
+	const op = "internal.http.handlers.audit.New"
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		query := r.URL.Query()
+		filter := audit.Filter{Actor: query.Get("actor"), Limit: defaultLimit}
+
+		if raw := query.Get("limit"); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n < 1 || n > maxLimit {
+				log.Info("некорректный limit", slog.String("limit", raw))
+
+				resp.Render(w, r, resp.BadRequest(resp.CodeInvalidParam, i18n.MsgInvalidLimit, maxLimit))
+
+				return
+			}
+			filter.Limit = n
+		}
+
+		if raw := query.Get("link_id"); raw != "" {
+			id, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil || id < 1 {
+				log.Info("некорректный link_id", slog.String("link_id", raw))
+
+				resp.Render(w, r, resp.BadRequest(resp.CodeInvalidParam, i18n.MsgAuditFilter, "link_id"))
+
+				return
+			}
+			filter.LinkID = id
+		}
+
+		for name, dst := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+			raw := query.Get(name)
+			if raw == "" {
+				continue
+			}
+			t, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				log.Info("некорректная граница времени", slog.String(name, raw))
+
+				resp.Render(w, r, resp.BadRequest(resp.CodeInvalidParam, i18n.MsgAuditFilter, name))
+
+				return
+			}
+			*dst = t
+		}
+
+		entries, err := getter.AuditLog(filter)
+		if err != nil {
+			log.Error("не удалось получить журнал аудита", sl.Err(err))
+
+			resp.Render(w, r, resp.Internal(i18n.MsgListFailed, err))
+
+			return
+		}
+
+		if entries == nil {
+			entries = []audit.Entry{}
+		}
+
+		render.JSON(w, r, Response{
+			Response: resp.OK(),
+			Entries:  entries,
+		})
+	}
+}
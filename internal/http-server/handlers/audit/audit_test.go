@@ -0,0 +1,74 @@
+package audit_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	handler "url-shoter/internal/http-server/handlers/audit"
+	"url-shoter/internal/lib/audit"
+	"url-shoter/internal/lib/logger/handlers/slogdiscard"
+)
+
+type fakeLog struct {
+	filter audit.Filter
+}
+
+func (f *fakeLog) AuditLog(filter audit.Filter) ([]audit.Entry, error) {
+	f.filter = filter
+	return []audit.Entry{{ID: 1, LinkID: filter.LinkID, Actor: "key:ci", Action: audit.ActionCreate}}, nil
+}
+
+func TestAuditHandler(t *testing.T) {
+	cases := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantFilter audit.Filter
+	}{
+		{
+			name:       "Defaults",
+			wantStatus: http.StatusOK,
+			wantFilter: audit.Filter{Limit: 100},
+		},
+		{
+			name:       "All filters",
+			query:      "?link_id=7&actor=key:ci&from=2024-05-01T00:00:00Z&to=2024-05-02T00:00:00Z&limit=10",
+			wantStatus: http.StatusOK,
+			wantFilter: audit.Filter{
+				LinkID: 7,
+				Actor:  "key:ci",
+				From:   time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+				To:     time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC),
+				Limit:  10,
+			},
+		},
+		{name: "Bad link", query: "?link_id=abc", wantStatus: http.StatusBadRequest},
+		{name: "Bad time", query: "?from=yesterday", wantStatus: http.StatusBadRequest},
+		{name: "Bad limit", query: "?limit=5000", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			getter := &fakeLog{}
+			rr := httptest.NewRecorder()
+			handler.New(slogdiscard.NewDiscardLogger(), getter).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/audit"+tc.query, nil))
+
+			require.Equal(t, tc.wantStatus, rr.Code)
+			if tc.wantStatus != http.StatusOK {
+				return
+			}
+
+			assert.Equal(t, tc.wantFilter, getter.filter)
+
+			var body handler.Response
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+			assert.Len(t, body.Entries, 1)
+		})
+	}
+}
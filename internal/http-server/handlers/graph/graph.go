@@ -0,0 +1,142 @@
+package graph
+
+import (
+	"context"
+	_ "embed"
+	"log/slog"
+	"net/http"
+	"sync"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	graphqlgo "github.com/graph-gophers/graphql-go"
+
+	resp "url-shoter/internal/lib/api/response"
+	"url-shoter/internal/lib/audit"
+	"url-shoter/internal/lib/domains"
+	"url-shoter/internal/lib/i18n"
+	"url-shoter/internal/storage"
+)
+
+//go:embed schema.graphql
+var schema string
+
+// maxDepth ограничивает вложенность запроса, чтобы один запрос не обходил всю базу через owner.links
+const maxDepth = 10
+
+type Storage interface {
+	ListUrls(filter storage.ListFilter) ([]storage.URLData, error)
+	GetUrlsByIds(ids []int64) ([]storage.URLData, error)
+	VariantClicksByIds(ids []int64) (map[int64]map[int]int64, error)
+	AuditByLinks(ids []int64) (map[int64][]audit.Entry, error)
+	AuditLog(filter audit.Filter) ([]audit.Entry, error)
+	Owners() ([]storage.OwnerStat, error)
+	OwnerLinkIDs(actor string, afterID int64, limit int) ([]int64, error)
+}
+
+type Request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+/*
+New GraphQL API для дашборда: ссылки с переходами, владельцами, историей алиасов и журналом аудита.
+Схема в schema.graphql, ошибки выполнения отдаются в errors с кодом REST API в extensions.code
+*/
+func New(log *slog.Logger, store Storage, resolver *domains.Resolver) http.HandlerFunc {
+	const op = "internal.http.handlers.graph.New"
+
+	s := graphqlgo.MustParseSchema(schema, &query{store: store, resolver: resolver}, graphqlgo.MaxDepth(maxDepth),
+		graphqlgo.UseFieldResolvers())
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		var req Request
+		if err := render.DecodeJSON(r.Body, &req); err != nil {
+			log.Info("не удалось расшифровать запрос", slog.String("error", err.Error()))
+
+			resp.Render(w, r, resp.BadRequest(resp.CodeInvalidJSON, i18n.MsgInvalidJSON))
+
+			return
+		}
+
+		if req.Query == "" {
+			log.Info("пустой запрос GraphQL")
+
+			resp.Render(w, r, resp.BadRequest(resp.CodeValidation, i18n.MsgFieldRequired, "query"))
+
+			return
+		}
+
+		ctx := withRequest(r.Context(), newRequest(log, i18n.FromRequest(r), store))
+		result := s.Exec(ctx, req.Query, req.OperationName, req.Variables)
+		if len(result.Errors) > 0 {
+			log.Info("запрос GraphQL выполнен с ошибками", slog.Int("errors", len(result.Errors)))
+		}
+
+		render.JSON(w, r, result)
+	}
+}
+
+/*
+request состояние одного запроса GraphQL: загрузчики живут только в его пределах,
+поэтому данные из кэша не переживают запрос
+*/
+type request struct {
+	log  *slog.Logger
+	lang i18n.Lang
+
+	links  *loader[int64, storage.URLData]
+	clicks *loader[int64, map[int]int64]
+	audit  *loader[int64, []audit.Entry]
+
+	ownersOnce sync.Once
+	owners     []storage.OwnerStat
+	ownersErr  error
+}
+
+func newRequest(log *slog.Logger, lang i18n.Lang, store Storage) *request {
+	return &request{
+		log:  log,
+		lang: lang,
+		links: newLoader(func(ids []int64) (map[int64]storage.URLData, error) {
+			list, err := store.GetUrlsByIds(ids)
+			if err != nil {
+				return nil, err
+			}
+
+			links := make(map[int64]storage.URLData, len(list))
+			for _, data := range list {
+				links[data.Id] = data
+			}
+
+			return links, nil
+		}),
+		clicks: newLoader(store.VariantClicksByIds),
+		audit:  newLoader(store.AuditByLinks),
+	}
+}
+
+// ownerStats владельцы ссылок, читаются не больше одного раза за запрос
+func (r *request) ownerStats(store Storage) ([]storage.OwnerStat, error) {
+	r.ownersOnce.Do(func() {
+		r.owners, r.ownersErr = store.Owners()
+	})
+
+	return r.owners, r.ownersErr
+}
+
+type ctxKey struct{}
+
+func withRequest(ctx context.Context, req *request) context.Context {
+	return context.WithValue(ctx, ctxKey{}, req)
+}
+
+func requestFrom(ctx context.Context) *request {
+	return ctx.Value(ctxKey{}).(*request)
+}
@@ -0,0 +1,229 @@
+package graph_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"url-shoter/internal/http-server/handlers/graph"
+	"url-shoter/internal/lib/audit"
+	"url-shoter/internal/lib/domains"
+	"url-shoter/internal/lib/logger/handlers/slogdiscard"
+	"url-shoter/internal/lib/variants"
+	"url-shoter/internal/storage"
+)
+
+// fakeStore ссылки 1..3, ссылку 2 создал alice и потом сменила алиас, остальные импортированы. Считает запросы
+type fakeStore struct {
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+var created = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func (f *fakeStore) call(name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.calls == nil {
+		f.calls = make(map[string]int)
+	}
+	f.calls[name]++
+}
+
+func (f *fakeStore) links() []storage.URLData {
+	return []storage.URLData{
+		{Id: 1, Alias: "one", Url: "https://example.com/1", CreatedAt: created},
+		{Id: 2, Alias: "two-new", Url: "https://example.com/2", Clicks: 5, CreatedAt: created,
+			Options: storage.Options{Variants: []variants.Variant{{URL: "https://a.example.com", Weight: 1}, {URL: "https://b.example.com", Weight: 1}}}},
+		{Id: 3, Alias: "three", Url: "https://example.com/3", Clicks: 5_000_000_000, CreatedAt: created},
+	}
+}
+
+func (f *fakeStore) ListUrls(filter storage.ListFilter) ([]storage.URLData, error) {
+	f.call("ListUrls")
+	var list []storage.URLData
+	for _, data := range f.links() {
+		if data.Id > filter.AfterID && (filter.Limit == 0 || len(list) < filter.Limit) {
+			list = append(list, data)
+		}
+	}
+	return list, nil
+}
+
+func (f *fakeStore) GetUrlsByIds(ids []int64) ([]storage.URLData, error) {
+	f.call("GetUrlsByIds")
+	var list []storage.URLData
+	for _, data := range f.links() {
+		for _, id := range ids {
+			if data.Id == id {
+				list = append(list, data)
+			}
+		}
+	}
+	return list, nil
+}
+
+func (f *fakeStore) VariantClicksByIds(ids []int64) (map[int64]map[int]int64, error) {
+	f.call("VariantClicksByIds")
+	return map[int64]map[int]int64{2: {0: 3, 1: 2}}, nil
+}
+
+func (f *fakeStore) AuditByLinks(ids []int64) (map[int64][]audit.Entry, error) {
+	f.call("AuditByLinks")
+	return map[int64][]audit.Entry{2: {
+		{ID: 10, LinkID: 2, Actor: "alice", Action: audit.ActionCreate, After: json.RawMessage(`{"alias":"two"}`), CreatedAt: created},
+		{ID: 11, LinkID: 2, Actor: "bob", Action: audit.ActionEditAlias, Before: json.RawMessage(`{"alias":"two"}`),
+			After: json.RawMessage(`{"alias":"two-new"}`), CreatedAt: created.Add(time.Hour)},
+	}}, nil
+}
+
+func (f *fakeStore) AuditLog(filter audit.Filter) ([]audit.Entry, error) { return nil, nil }
+
+func (f *fakeStore) Owners() ([]storage.OwnerStat, error) {
+	f.call("Owners")
+	return []storage.OwnerStat{{Actor: "alice", Links: 1}}, nil
+}
+
+func (f *fakeStore) OwnerLinkIDs(actor string, afterID int64, limit int) ([]int64, error) {
+	f.call("OwnerLinkIDs")
+	if actor != "alice" || afterID >= 2 {
+		return nil, nil
+	}
+	return []int64{2}, nil
+}
+
+type response struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string         `json:"message"`
+		Extensions map[string]any `json:"extensions"`
+	} `json:"errors"`
+}
+
+func exec(t *testing.T, store *fakeStore, body string) (int, response) {
+	t.Helper()
+
+	resolver, err := domains.New("", "sho.rt", nil, "https")
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	graph.New(slogdiscard.NewDiscardLogger(), store, resolver).
+		ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(body)))
+
+	var res response
+	if rr.Code == http.StatusOK {
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &res), rr.Body.String())
+	}
+	return rr.Code, res
+}
+
+func TestLinksBatching(t *testing.T) {
+	store := &fakeStore{}
+	code, res := exec(t, store, `{"query":"{ links(first: 2) { edges { cursor node { id shortUrl clicks { total variants { url clicks } } owner { id linkCount } aliasHistory { from to actor } audit { action } } } pageInfo { hasNextPage endCursor } } }"}`)
+	require.Equal(t, http.StatusOK, code)
+	require.Empty(t, res.Errors)
+
+	var data struct {
+		Links struct {
+			Edges []struct {
+				Cursor string
+				Node   struct {
+					ID       string
+					ShortURL string `json:"shortUrl"`
+					Clicks   struct {
+						Total    int
+						Variants []struct {
+							URL    string
+							Clicks int
+						}
+					}
+					Owner *struct {
+						ID        string
+						LinkCount int
+					}
+					AliasHistory []struct{ From, To, Actor string }
+					Audit        []struct{ Action string }
+				}
+			}
+			PageInfo struct {
+				HasNextPage bool
+				EndCursor   string
+			}
+		}
+	}
+	require.NoError(t, json.Unmarshal(res.Data, &data))
+
+	edges := data.Links.Edges
+	require.Len(t, edges, 2)
+	assert.True(t, data.Links.PageInfo.HasNextPage)
+	assert.Equal(t, edges[1].Cursor, data.Links.PageInfo.EndCursor)
+
+	assert.Nil(t, edges[0].Node.Owner)
+	assert.Empty(t, edges[0].Node.AliasHistory)
+
+	two := edges[1].Node
+	assert.Equal(t, "https://sho.rt/two-new", two.ShortURL)
+	assert.Equal(t, 5, two.Clicks.Total)
+	require.Len(t, two.Clicks.Variants, 2)
+	assert.Equal(t, 2, two.Clicks.Variants[1].Clicks)
+	require.NotNil(t, two.Owner)
+	assert.Equal(t, "alice", two.Owner.ID)
+	assert.Equal(t, 1, two.Owner.LinkCount)
+	assert.Equal(t, []struct{ From, To, Actor string }{{"two", "two-new", "bob"}}, two.AliasHistory)
+	assert.Len(t, two.Audit, 2)
+
+	// вложенные поля всех ссылок страницы читаются одним запросом
+	assert.Equal(t, map[string]int{"ListUrls": 1, "VariantClicksByIds": 1, "AuditByLinks": 1, "Owners": 1}, store.calls)
+
+	_, res = exec(t, store, `{"query":"query($after: String) { links(after: $after) { edges { node { id } } pageInfo { hasNextPage } } }","variables":{"after":"`+edges[1].Cursor+`"}}`)
+	require.Empty(t, res.Errors)
+	assert.JSONEq(t, `{"links":{"edges":[{"node":{"id":"3"}}],"pageInfo":{"hasNextPage":false}}}`, string(res.Data))
+}
+
+func TestClicksBeyondInt32(t *testing.T) {
+	_, res := exec(t, &fakeStore{}, `{"query":"{ link(id: 3) { clicks { total } } }"}`)
+	require.Empty(t, res.Errors)
+	assert.JSONEq(t, `{"link":{"clicks":{"total":5000000000}}}`, string(res.Data))
+}
+
+func TestOwnerLinks(t *testing.T) {
+	store := &fakeStore{}
+	_, res := exec(t, store, `{"query":"{ owner(id: \"alice\") { links { edges { node { alias } } } } nobody: owner(id: \"bob\") { id } }"}`)
+	require.Empty(t, res.Errors)
+	assert.JSONEq(t, `{"owner":{"links":{"edges":[{"node":{"alias":"two-new"}}]}},"nobody":null}`, string(res.Data))
+}
+
+func TestErrors(t *testing.T) {
+	cases := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "Invalid JSON", body: `{"query":`, wantStatus: http.StatusBadRequest},
+		{name: "Empty query", body: `{}`, wantStatus: http.StatusBadRequest},
+		{name: "Invalid cursor", body: `{"query":"{ links(after: \"abc\") { pageInfo { hasNextPage } } }"}`, wantStatus: http.StatusOK, wantCode: "invalid_param"},
+		{name: "First too large", body: `{"query":"{ links(first: 1000) { pageInfo { hasNextPage } } }"}`, wantStatus: http.StatusOK, wantCode: "invalid_param"},
+		{name: "Invalid id", body: `{"query":"{ link(id: \"x\") { id } }"}`, wantStatus: http.StatusOK, wantCode: "invalid_id"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			code, res := exec(t, &fakeStore{}, tc.body)
+			require.Equal(t, tc.wantStatus, code)
+			if tc.wantCode == "" {
+				return
+			}
+
+			require.Len(t, res.Errors, 1)
+			assert.Equal(t, tc.wantCode, res.Errors[0].Extensions["code"])
+		})
+	}
+}
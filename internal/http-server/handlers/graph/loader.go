@@ -0,0 +1,118 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+/*
+loader пакетная загрузка на время одного запроса: ключи, поставленные в очередь через Queue,
+читаются одним вызовом fetch при первом Load любого из них. Повторный Load ждёт уже начатую загрузку
+*/
+type loader[K comparable, V any] struct {
+	fetch func(keys []K) (map[K]V, error)
+
+	mu      sync.Mutex
+	pending map[K]struct{}
+	batches map[K]*batch[K, V]
+}
+
+type batch[K comparable, V any] struct {
+	done   chan struct{}
+	values map[K]V
+	err    error
+}
+
+func newLoader[K comparable, V any](fetch func(keys []K) (map[K]V, error)) *loader[K, V] {
+	return &loader[K, V]{
+		fetch:   fetch,
+		pending: make(map[K]struct{}),
+		batches: make(map[K]*batch[K, V]),
+	}
+}
+
+/*
+Queue откладывает ключи до ближайшей загрузки
+*/
+func (l *loader[K, V]) Queue(keys ...K) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, key := range keys {
+		if _, ok := l.batches[key]; !ok {
+			l.pending[key] = struct{}{}
+		}
+	}
+}
+
+/*
+Prime сохраняет уже известное значение, чтобы не читать его повторно
+*/
+func (l *loader[K, V]) Prime(key K, value V) {
+	done := make(chan struct{})
+	close(done)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.batches[key] = &batch[K, V]{done: done, values: map[K]V{key: value}}
+	delete(l.pending, key)
+}
+
+/*
+Load значение по ключу, false - fetch его не вернул
+*/
+func (l *loader[K, V]) Load(ctx context.Context, key K) (V, bool, error) {
+	l.mu.Lock()
+	b, ok := l.batches[key]
+	if !ok {
+		keys := make([]K, 0, len(l.pending)+1)
+		keys = append(keys, key)
+		for k := range l.pending {
+			if k != key {
+				keys = append(keys, k)
+			}
+		}
+		clear(l.pending)
+
+		b = &batch[K, V]{done: make(chan struct{})}
+		for _, k := range keys {
+			l.batches[k] = b
+		}
+		l.mu.Unlock()
+
+		l.run(b, keys)
+	} else {
+		l.mu.Unlock()
+	}
+
+	var zero V
+	select {
+	case <-b.done:
+	case <-ctx.Done():
+		return zero, false, ctx.Err()
+	}
+
+	if b.err != nil {
+		return zero, false, b.err
+	}
+	value, ok := b.values[key]
+
+	return value, ok, nil
+}
+
+// run загрузка пачки, done закрывается в любом случае. Паника fetch становится ошибкой пачки,
+// иначе остальные ожидающие её ключей висели бы до отмены запроса
+func (l *loader[K, V]) run(b *batch[K, V], keys []K) {
+	const op = "internal.http.handlers.graph.loader.run"
+
+	defer close(b.done)
+	defer func() {
+		if r := recover(); r != nil {
+			b.values, b.err = nil, fmt.Errorf("%s: паника при загрузке: %v", op, r)
+		}
+	}()
+
+	b.values, b.err = l.fetch(keys)
+}
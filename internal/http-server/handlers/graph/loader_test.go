@@ -0,0 +1,49 @@
+package graph
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoaderPanic(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	l := newLoader(func(keys []int) (map[int]string, error) {
+		close(started)
+		<-release
+		panic("сломалось хранилище")
+	})
+	l.Queue(1, 2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var first error
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, _, first = l.Load(ctx, 1)
+	}()
+
+	// второй ключ той же пачки ждёт загрузку, начатую первым
+	<-started
+	var second error
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, _, second = l.Load(ctx, 2)
+	}()
+	close(release)
+	wg.Wait()
+
+	require.Error(t, first)
+	assert.Contains(t, first.Error(), "сломалось хранилище")
+	require.Error(t, second)
+	assert.NotErrorIs(t, second, context.DeadlineExceeded, "ожидающий получает ошибку пачки, а не таймаут")
+}
@@ -0,0 +1,563 @@
+package graph
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	graphqlgo "github.com/graph-gophers/graphql-go"
+
+	resp "url-shoter/internal/lib/api/response"
+	"url-shoter/internal/lib/audit"
+	"url-shoter/internal/lib/domains"
+	"url-shoter/internal/lib/i18n"
+	"url-shoter/internal/lib/logger/sl"
+	"url-shoter/internal/storage"
+)
+
+const (
+	defaultFirst = 20
+	maxFirst     = 100
+
+	cursorPrefix = "link:"
+)
+
+/*
+queryError ошибка резолвера: сообщение на языке запроса, код ошибки REST API в extensions.code
+*/
+type queryError struct {
+	err  *resp.APIError
+	lang i18n.Lang
+}
+
+func (e *queryError) Error() string {
+	return e.err.Message(e.lang)
+}
+
+func (e *queryError) Extensions() map[string]interface{} {
+	return map[string]interface{}{"code": e.err.Code}
+}
+
+func fail(ctx context.Context, e *resp.APIError) error {
+	req := requestFrom(ctx)
+	if e.Code == resp.CodeInternal {
+		req.log.Error("не удалось выполнить запрос GraphQL", sl.Err(e))
+	}
+
+	return &queryError{err: e, lang: req.lang}
+}
+
+type query struct {
+	store    Storage
+	resolver *domains.Resolver
+}
+
+func (q *query) Link(ctx context.Context, args struct{ ID graphqlgo.ID }) (*linkResolver, error) {
+	id, err := strconv.ParseInt(string(args.ID), 10, 64)
+	if err != nil || id < 1 {
+		return nil, fail(ctx, resp.BadRequest(resp.CodeInvalidID, i18n.MsgInvalidID))
+	}
+
+	data, ok, err := requestFrom(ctx).links.Load(ctx, id)
+	if err != nil {
+		return nil, fail(ctx, resp.Internal(i18n.MsgListFailed, err))
+	}
+	if !ok {
+		return nil, nil
+	}
+
+	return &linkResolver{q: q, data: data}, nil
+}
+
+type pageArgs struct {
+	First *int32
+	After *string
+}
+
+func (q *query) Links(ctx context.Context, args struct {
+	First    *int32
+	After    *string
+	Campaign *string
+}) (*connection, error) {
+	first, afterID, err := page(ctx, pageArgs{First: args.First, After: args.After})
+	if err != nil {
+		return nil, err
+	}
+
+	filter := storage.ListFilter{AfterID: afterID, Limit: first + 1}
+	if args.Campaign != nil {
+		filter.Campaign = *args.Campaign
+	}
+
+	list, err := q.store.ListUrls(filter)
+	if err != nil {
+		return nil, fail(ctx, resp.Internal(i18n.MsgListFailed, err))
+	}
+
+	req := requestFrom(ctx)
+	for _, data := range list {
+		req.links.Prime(data.Id, data)
+	}
+
+	return q.connection(ctx, list, first), nil
+}
+
+func (q *query) Owners(ctx context.Context) ([]*ownerResolver, error) {
+	stats, err := requestFrom(ctx).ownerStats(q.store)
+	if err != nil {
+		return nil, fail(ctx, resp.Internal(i18n.MsgListFailed, err))
+	}
+
+	owners := make([]*ownerResolver, 0, len(stats))
+	for _, stat := range stats {
+		owners = append(owners, &ownerResolver{q: q, actor: stat.Actor})
+	}
+
+	return owners, nil
+}
+
+func (q *query) Owner(ctx context.Context, args struct{ ID graphqlgo.ID }) (*ownerResolver, error) {
+	stats, err := requestFrom(ctx).ownerStats(q.store)
+	if err != nil {
+		return nil, fail(ctx, resp.Internal(i18n.MsgListFailed, err))
+	}
+
+	for _, stat := range stats {
+		if stat.Actor == string(args.ID) {
+			return &ownerResolver{q: q, actor: stat.Actor}, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (q *query) Audit(ctx context.Context, args struct {
+	LinkID *graphqlgo.ID
+	Actor  *string
+	First  *int32
+}) ([]*auditResolver, error) {
+	filter := audit.Filter{Limit: defaultFirst}
+
+	if args.First != nil {
+		if *args.First < 1 || *args.First > maxFirst {
+			return nil, fail(ctx, resp.BadRequest(resp.CodeInvalidParam, i18n.MsgInvalidFirst, maxFirst))
+		}
+		filter.Limit = int(*args.First)
+	}
+	if args.LinkID != nil {
+		id, err := strconv.ParseInt(string(*args.LinkID), 10, 64)
+		if err != nil || id < 1 {
+			return nil, fail(ctx, resp.BadRequest(resp.CodeInvalidID, i18n.MsgInvalidID))
+		}
+		filter.LinkID = id
+	}
+	if args.Actor != nil {
+		filter.Actor = *args.Actor
+	}
+
+	entries, err := q.store.AuditLog(filter)
+	if err != nil {
+		return nil, fail(ctx, resp.Internal(i18n.MsgListFailed, err))
+	}
+
+	return auditResolvers(entries), nil
+}
+
+// page размер страницы и id ссылки из курсора, по умолчанию - первая страница из defaultFirst ссылок
+func page(ctx context.Context, args pageArgs) (int, int64, error) {
+	first := defaultFirst
+	if args.First != nil {
+		if *args.First < 1 || *args.First > maxFirst {
+			return 0, 0, fail(ctx, resp.BadRequest(resp.CodeInvalidParam, i18n.MsgInvalidFirst, maxFirst))
+		}
+		first = int(*args.First)
+	}
+
+	var afterID int64
+	if args.After != nil {
+		id, err := decodeCursor(*args.After)
+		if err != nil {
+			return 0, 0, fail(ctx, resp.BadRequest(resp.CodeInvalidParam, i18n.MsgInvalidPageToken))
+		}
+		afterID = id
+	}
+
+	return first, afterID, nil
+}
+
+func encodeCursor(id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(cursorPrefix + strconv.FormatInt(id, 10)))
+}
+
+func decodeCursor(cursor string) (int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := strconv.ParseInt(strings.TrimPrefix(string(raw), cursorPrefix), 10, 64)
+	if err != nil || !strings.HasPrefix(string(raw), cursorPrefix) || id < 1 {
+		return 0, errors.New("некорректный курсор")
+	}
+
+	return id, nil
+}
+
+/*
+connection страница ссылок. list прочитан с запасом в одну ссылку - по ней видно, есть ли следующая страница.
+Id ссылок страницы ставятся в очередь загрузчиков, чтобы вложенные поля всех ссылок читались одним запросом
+*/
+func (q *query) connection(ctx context.Context, list []storage.URLData, first int) *connection {
+	c := &connection{hasNext: len(list) > first}
+	if c.hasNext {
+		list = list[:first]
+	}
+
+	ids := make([]int64, 0, len(list))
+	for _, data := range list {
+		ids = append(ids, data.Id)
+		c.edges = append(c.edges, &edge{cursor: encodeCursor(data.Id), node: &linkResolver{q: q, data: data}})
+	}
+
+	req := requestFrom(ctx)
+	req.clicks.Queue(ids...)
+	req.audit.Queue(ids...)
+
+	return c
+}
+
+type connection struct {
+	edges   []*edge
+	hasNext bool
+}
+
+func (c *connection) Edges() []*edge {
+	return c.edges
+}
+
+func (c *connection) PageInfo() *pageInfo {
+	info := &pageInfo{HasNextPage: c.hasNext}
+	if len(c.edges) > 0 {
+		info.EndCursor = &c.edges[len(c.edges)-1].cursor
+	}
+
+	return info
+}
+
+type edge struct {
+	cursor string
+	node   *linkResolver
+}
+
+func (e *edge) Cursor() string {
+	return e.cursor
+}
+
+func (e *edge) Node() *linkResolver {
+	return e.node
+}
+
+type pageInfo struct {
+	HasNextPage bool
+	EndCursor   *string
+}
+
+type linkResolver struct {
+	q    *query
+	data storage.URLData
+}
+
+func (l *linkResolver) ID() graphqlgo.ID {
+	return graphqlgo.ID(strconv.FormatInt(l.data.Id, 10))
+}
+
+func (l *linkResolver) Alias() string {
+	return l.data.Alias
+}
+
+func (l *linkResolver) URL() string {
+	return l.data.Url
+}
+
+func (l *linkResolver) Domain() *string {
+	return optional(l.data.Domain)
+}
+
+func (l *linkResolver) ShortURL() string {
+	return l.q.resolver.ShortURL(l.data.Domain, l.data.Alias)
+}
+
+func (l *linkResolver) QRCodeURL() string {
+	return l.q.resolver.QRCodeURL(l.data.Domain, l.data.Alias)
+}
+
+func (l *linkResolver) Title() *string {
+	return optional(l.data.Title)
+}
+
+func (l *linkResolver) Campaign() *string {
+	return optional(l.data.Campaign)
+}
+
+func (l *linkResolver) CreatedAt() graphqlgo.Time {
+	return graphqlgo.Time{Time: l.data.CreatedAt}
+}
+
+func (l *linkResolver) ExpiresAt() *graphqlgo.Time {
+	if l.data.ExpiresAt == nil {
+		return nil
+	}
+
+	return &graphqlgo.Time{Time: *l.data.ExpiresAt}
+}
+
+func (l *linkResolver) DeletedAt() *graphqlgo.Time {
+	if l.data.DeletedAt == nil {
+		return nil
+	}
+
+	return &graphqlgo.Time{Time: *l.data.DeletedAt}
+}
+
+func (l *linkResolver) Protected() bool {
+	return l.data.PasswordHash != ""
+}
+
+func (l *linkResolver) Clicks(ctx context.Context) (*clicksResolver, error) {
+	counts, _, err := requestFrom(ctx).clicks.Load(ctx, l.data.Id)
+	if err != nil {
+		return nil, fail(ctx, resp.Internal(i18n.MsgStatsFailed, err))
+	}
+
+	c := &clicksResolver{total: l.data.Clicks}
+	for i, v := range l.data.Variants {
+		c.variants = append(c.variants, &variantClicks{
+			Variant: int32(i),
+			URL:     v.URL,
+			Weight:  int32(v.Weight),
+			Clicks:  float64(counts[i]),
+		})
+	}
+
+	return c, nil
+}
+
+func (l *linkResolver) Owner(ctx context.Context) (*ownerResolver, error) {
+	entries, err := l.entries(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if entry.Action == audit.ActionCreate {
+			return &ownerResolver{q: l.q, actor: entry.Actor}, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (l *linkResolver) AliasHistory(ctx context.Context) ([]*aliasChange, error) {
+	entries, err := l.entries(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	history := []*aliasChange{}
+	for _, entry := range entries {
+		if entry.Action != audit.ActionEditAlias {
+			continue
+		}
+
+		var before, after struct {
+			Alias string `json:"alias"`
+		}
+		if json.Unmarshal(entry.Before, &before) != nil || json.Unmarshal(entry.After, &after) != nil {
+			requestFrom(ctx).log.Warn("не удалось прочитать алиас из записи аудита",
+				slog.Int64("audit_id", entry.ID))
+
+			continue
+		}
+
+		history = append(history, &aliasChange{
+			From:  before.Alias,
+			To:    after.Alias,
+			At:    graphqlgo.Time{Time: entry.CreatedAt},
+			Actor: entry.Actor,
+		})
+	}
+
+	return history, nil
+}
+
+func (l *linkResolver) Audit(ctx context.Context) ([]*auditResolver, error) {
+	entries, err := l.entries(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return auditResolvers(entries), nil
+}
+
+// entries журнал аудита ссылки от старых записей к новым
+func (l *linkResolver) entries(ctx context.Context) ([]audit.Entry, error) {
+	entries, _, err := requestFrom(ctx).audit.Load(ctx, l.data.Id)
+	if err != nil {
+		return nil, fail(ctx, resp.Internal(i18n.MsgListFailed, err))
+	}
+
+	return entries, nil
+}
+
+type clicksResolver struct {
+	total    int64
+	variants []*variantClicks
+}
+
+// Total во Float: Int в GraphQL 32-битный, а счётчик переходов int64. Float точен до 2^53
+func (c *clicksResolver) Total() float64 {
+	return float64(c.total)
+}
+
+func (c *clicksResolver) Variants() []*variantClicks {
+	if c.variants == nil {
+		return []*variantClicks{}
+	}
+
+	return c.variants
+}
+
+type variantClicks struct {
+	Variant int32
+	URL     string
+	Weight  int32
+	Clicks  float64
+}
+
+type aliasChange struct {
+	From  string
+	To    string
+	At    graphqlgo.Time
+	Actor string
+}
+
+type ownerResolver struct {
+	q     *query
+	actor string
+}
+
+func (o *ownerResolver) ID() graphqlgo.ID {
+	return graphqlgo.ID(o.actor)
+}
+
+func (o *ownerResolver) LinkCount(ctx context.Context) (int32, error) {
+	stats, err := requestFrom(ctx).ownerStats(o.q.store)
+	if err != nil {
+		return 0, fail(ctx, resp.Internal(i18n.MsgListFailed, err))
+	}
+
+	for _, stat := range stats {
+		if stat.Actor == o.actor {
+			return int32(stat.Links), nil
+		}
+	}
+
+	return 0, nil
+}
+
+/*
+Links ссылки владельца по возрастанию id. Окончательно удалённые из корзины ссылки пропускаются
+*/
+func (o *ownerResolver) Links(ctx context.Context, args pageArgs) (*connection, error) {
+	first, afterID, err := page(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+
+	ids, err := o.q.store.OwnerLinkIDs(o.actor, afterID, first+1)
+	if err != nil {
+		return nil, fail(ctx, resp.Internal(i18n.MsgListFailed, err))
+	}
+
+	req := requestFrom(ctx)
+	req.links.Queue(ids...)
+
+	list := make([]storage.URLData, 0, len(ids))
+	for _, id := range ids {
+		data, ok, err := req.links.Load(ctx, id)
+		if err != nil {
+			return nil, fail(ctx, resp.Internal(i18n.MsgListFailed, err))
+		}
+		if ok {
+			list = append(list, data)
+		}
+	}
+
+	return o.q.connection(ctx, list, first), nil
+}
+
+type auditResolver struct {
+	entry audit.Entry
+}
+
+func auditResolvers(entries []audit.Entry) []*auditResolver {
+	list := make([]*auditResolver, 0, len(entries))
+	for _, entry := range entries {
+		list = append(list, &auditResolver{entry: entry})
+	}
+
+	return list
+}
+
+func (a *auditResolver) ID() graphqlgo.ID {
+	return graphqlgo.ID(strconv.FormatInt(a.entry.ID, 10))
+}
+
+func (a *auditResolver) LinkID() *graphqlgo.ID {
+	if a.entry.LinkID == 0 {
+		return nil
+	}
+	id := graphqlgo.ID(strconv.FormatInt(a.entry.LinkID, 10))
+
+	return &id
+}
+
+func (a *auditResolver) Actor() string {
+	return a.entry.Actor
+}
+
+func (a *auditResolver) Action() string {
+	return a.entry.Action
+}
+
+func (a *auditResolver) Before() *string {
+	return optional(string(a.entry.Before))
+}
+
+func (a *auditResolver) After() *string {
+	return optional(string(a.entry.After))
+}
+
+func (a *auditResolver) RequestID() *string {
+	return optional(a.entry.RequestID)
+}
+
+func (a *auditResolver) IP() *string {
+	return optional(a.entry.IP)
+}
+
+func (a *auditResolver) CreatedAt() graphqlgo.Time {
+	return graphqlgo.Time{Time: a.entry.CreatedAt}
+}
+
+func optional(s string) *string {
+	if s == "" {
+		return nil
+	}
+
+	return &s
+}
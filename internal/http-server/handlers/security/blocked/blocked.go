@@ -0,0 +1,72 @@
+package blocked
+
+import (
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"log/slog"
+	"net/http"
+	"strconv"
+	resp "url-shoter/internal/lib/api/response"
+	"url-shoter/internal/lib/i18n"
+	"url-shoter/internal/lib/logger/sl"
+	"url-shoter/internal/lib/scan"
+)
+
+const (
+	defaultLimit = 100
+	maxLimit     = 1000
+)
+
+type BlocksGetter interface {
+	BlockedClients(client string, limit int) ([]scan.Block, error)
+}
+
+type Response struct {
+	resp.Response
+	Blocks []scan.Block `json:"blocks"`
+}
+
+/*
+New журнал блокировок за перебор алиасов, новые первыми. ?client= отбирает один адрес, ?limit= до 1000
+*/
+func New(log *slog.Logger, getter BlocksGetter) http.HandlerFunc {
+	const op = "internal.http.handlers.security.blocked.New"
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		limit := defaultLimit
+		if raw := r.URL.Query().Get("limit"); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n < 1 || n > maxLimit {
+				log.Info("некорректный limit", slog.String("limit", raw))
+
+				resp.Render(w, r, resp.BadRequest(resp.CodeInvalidParam, i18n.MsgInvalidLimit, maxLimit))
+
+				return
+			}
+			limit = n
+		}
+
+		blocks, err := getter.BlockedClients(r.URL.Query().Get("client"), limit)
+		if err != nil {
+			log.Error("не удалось получить блокировки", sl.Err(err))
+
+			resp.Render(w, r, resp.Internal(i18n.MsgListFailed, err))
+
+			return
+		}
+
+		if blocks == nil {
+			blocks = []scan.Block{}
+		}
+
+		render.JSON(w, r, Response{
+			Response: resp.OK(),
+			Blocks:   blocks,
+		})
+	}
+}
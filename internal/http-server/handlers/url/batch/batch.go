@@ -0,0 +1,466 @@
+package batch
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"url-shoter/internal/http-server/handlers/url/save"
+	"url-shoter/internal/lib/aliasfilter"
+	resp "url-shoter/internal/lib/api/response"
+	"url-shoter/internal/lib/audit"
+	"url-shoter/internal/lib/domains"
+	"url-shoter/internal/lib/i18n"
+	"url-shoter/internal/lib/logger/sl"
+	"url-shoter/internal/lib/password"
+	"url-shoter/internal/lib/random"
+	"url-shoter/internal/storage"
+)
+
+// максимальная длина одной строки NDJSON
+const maxLineSize = 1 << 20
+
+var errBatchTooLarge = errors.New("batch too large")
+
+// generateRetries сколько раз перегенерировать алиас, который при сохранении оказался занят в базе
+const generateRetries = 3
+
+type Result struct {
+	Index    int       `json:"index"`
+	Alias    string    `json:"alias,omitempty"`
+	ShortURL string    `json:"short_url,omitempty"`
+	ID       int64     `json:"id,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Code     resp.Code `json:"code,omitempty"`
+}
+
+type Response struct {
+	resp.Response
+	Results []Result `json:"results"`
+	Created int      `json:"created"`
+	Failed  int      `json:"failed"`
+}
+
+type URLBatchSaver interface {
+	SaveUrlBatch(items []storage.URLData, trail *audit.Trail) ([]storage.SaveResult, error)
+}
+
+// item элемент пачки, ошибка разбора или валидации сохраняется в результат и не прерывает обработку
+type item struct {
+	req    save.Request
+	opts   storage.Options
+	domain string
+	err    string
+	code   resp.Code
+
+	generated bool // алиас сгенерирован, при занятом в базе его можно заменить
+}
+
+func New(log *slog.Logger, saver URLBatchSaver, aliasLength int64, maxSize int, chunkSize int, resolver *domains.Resolver,
+	filter *aliasfilter.Filter, auditor *audit.Logger) http.HandlerFunc {
+	const op = "internal.http.handlers.url.batch.New"
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		var items []item
+		var err error
+
+		if isNDJSON(r) {
+			items, err = decodeNDJSON(r.Body, maxSize)
+		} else {
+			items, err = decodeJSON(r.Body, maxSize)
+		}
+		if errors.Is(err, errBatchTooLarge) {
+			log.Info("превышен размер пачки", slog.Int("max_size", maxSize))
+
+			resp.Render(w, r, resp.NewError(http.StatusRequestEntityTooLarge, resp.CodeBatchTooLarge, i18n.MsgBatchTooLarge, maxSize))
+
+			return
+		}
+		if err != nil {
+			log.Error("Не удалось расшифровать тело запроса", sl.Err(err))
+
+			resp.Render(w, r, resp.BadRequest(resp.CodeInvalidJSON, i18n.MsgInvalidJSON))
+
+			return
+		}
+
+		log.Info("пачка получена", slog.Int("count", len(items)))
+
+		results, _ := process(log, i18n.FromRequest(r), saver, items, aliasLength, chunkSize, resolver, filter, auditor.Trail(r))
+
+		responseOk(w, r, results)
+	}
+}
+
+/*
+Save проверка и сохранение пачки запросов без HTTP, по тем же правилам, что и POST /url/batch.
+saved - сохранённые записи по индексам results, у несохранённых Id равен 0.
+Сохранённые записи попадают в журнал аудита по trail в транзакции своей порции
+*/
+func Save(log *slog.Logger, lang i18n.Lang, saver URLBatchSaver, reqs []save.Request, aliasLength int64, chunkSize int,
+	resolver *domains.Resolver, filter *aliasfilter.Filter, trail *audit.Trail) ([]Result, []storage.URLData) {
+	items := make([]item, len(reqs))
+	for i, req := range reqs {
+		items[i].req = req
+	}
+
+	return process(log, lang, saver, items, aliasLength, chunkSize, resolver, filter, trail)
+}
+
+// process подготовка и сохранение разобранных элементов
+func process(log *slog.Logger, lang i18n.Lang, saver URLBatchSaver, items []item, aliasLength int64, chunkSize int,
+	resolver *domains.Resolver, filter *aliasfilter.Filter, trail *audit.Trail) ([]Result, []storage.URLData) {
+	results, seen := prepare(log, lang, items, aliasLength, resolver, filter)
+
+	var pending []int
+	for i, it := range items {
+		if it.err == "" {
+			pending = append(pending, i)
+		}
+	}
+
+	for attempt := 0; len(pending) > 0; attempt++ {
+		conflicts := saveChunks(log, lang, saver, items, results, pending, chunkSize, resolver, trail)
+		if attempt == generateRetries {
+			for _, idx := range conflicts {
+				log.Error("сгенерированный alias снова занят", slog.String("alias", items[idx].req.Alias))
+				results[idx].Error = i18n.T(lang, i18n.MsgCreateFailed)
+				results[idx].Code = resp.CodeInternal
+			}
+			break
+		}
+		pending = regenerate(log, lang, items, results, conflicts, seen, aliasLength, filter)
+	}
+
+	saved := make([]storage.URLData, len(items))
+	for i, res := range results {
+		if res.ID == 0 {
+			continue
+		}
+		saved[i] = items[i].urlData()
+		saved[i].Id, saved[i].Options = res.ID, saved[i].Options.Normalize()
+	}
+
+	return results, saved
+}
+
+// prepare валидирует элементы и генерирует недостающие алиасы, алиасы уникальны в пределах домена в пачке.
+// seen - занятые пачкой алиасы в виде домен/алиас
+func prepare(log *slog.Logger, lang i18n.Lang, items []item, aliasLength int64, resolver *domains.Resolver,
+	filter *aliasfilter.Filter) (results []Result, seen map[string]struct{}) {
+	validate := validator.New()
+	results = make([]Result, len(items))
+	seen = make(map[string]struct{}, len(items))
+
+	for i := range items {
+		results[i].Index = i
+
+		if items[i].code == resp.CodeInvalidJSON {
+			items[i].err = i18n.T(lang, i18n.MsgInvalidJSON)
+		}
+		if items[i].err != "" {
+			results[i].Error = items[i].err
+			results[i].Code = items[i].code
+			continue
+		}
+
+		if err := validate.Struct(items[i].req); err != nil {
+			var validateErr validator.ValidationErrors
+			errors.As(err, &validateErr)
+			items[i].err = resp.ValidationError(lang, validateErr).Error
+			items[i].code = resp.CodeValidation
+			results[i].Error = items[i].err
+			results[i].Code = items[i].code
+			continue
+		}
+
+		if password.TooLong(items[i].req.Password) {
+			items[i].err = i18n.T(lang, i18n.MsgPasswordTooLong, password.MaxBytes)
+			items[i].code = resp.CodeValidation
+			results[i].Error = items[i].err
+			results[i].Code = items[i].code
+			continue
+		}
+
+		destination, err := items[i].req.Destination()
+		if err != nil {
+			items[i].err = i18n.T(lang, i18n.MsgFieldURL, "URL")
+			items[i].code = resp.CodeValidation
+			results[i].Error = items[i].err
+			results[i].Code = items[i].code
+			continue
+		}
+		items[i].req.URL = destination
+
+		items[i].opts, err = items[i].req.Options()
+		if err != nil {
+			items[i].err = i18n.T(lang, i18n.MsgCreateFailed)
+			items[i].code = resp.CodeInternal
+			results[i].Error = items[i].err
+			results[i].Code = items[i].code
+			continue
+		}
+
+		domain, err := resolver.Key(items[i].req.Domain)
+		if err != nil {
+			items[i].err = i18n.T(lang, i18n.MsgDomainNotAllowed)
+			items[i].code = resp.CodeDomainNotAllowed
+			results[i].Error = items[i].err
+			results[i].Code = items[i].code
+			continue
+		}
+
+		alias := items[i].req.Alias
+		if alias == "" {
+			items[i].generated = true
+			alias, err = generate(domain, seen, aliasLength, filter)
+			if err != nil {
+				log.Error("не удалось сгенерировать alias", sl.Err(err))
+
+				items[i].err = i18n.T(lang, i18n.MsgCreateFailed)
+				items[i].code = resp.CodeInternal
+				results[i].Error = items[i].err
+				results[i].Code = items[i].code
+				continue
+			}
+		} else if alias, err = filter.Check(alias); err != nil {
+			apiErr := resp.InvalidAlias(err)
+			items[i].err = apiErr.Message(lang)
+			items[i].code = apiErr.Code
+			results[i].Alias = alias
+			results[i].Error = items[i].err
+			results[i].Code = items[i].code
+			continue
+		} else if _, ok := seen[domain+"/"+alias]; ok {
+			items[i].err = i18n.T(lang, i18n.MsgBatchDuplicateAlias)
+			items[i].code = resp.CodeAliasExists
+			results[i].Alias = alias
+			results[i].Error = items[i].err
+			results[i].Code = items[i].code
+			continue
+		}
+
+		seen[domain+"/"+alias] = struct{}{}
+		items[i].req.Alias = alias
+		items[i].domain = domain
+		results[i].Alias = alias
+	}
+
+	return results, seen
+}
+
+// generate новый алиас, не занятый пачкой в домене
+func generate(domain string, seen map[string]struct{}, aliasLength int64, filter *aliasfilter.Filter) (string, error) {
+	for {
+		alias, err := filter.Generate(func() string { return random.NewRandomStringFrom(aliasLength, filter.Alphabet()) })
+		if err != nil {
+			return "", err
+		}
+		if _, ok := seen[domain+"/"+alias]; !ok {
+			seen[domain+"/"+alias] = struct{}{}
+			return alias, nil
+		}
+	}
+}
+
+// regenerate новые алиасы элементам conflicts, сгенерированный алиас которых занят в базе,
+// возвращает элементы, которые нужно сохранить снова
+func regenerate(log *slog.Logger, lang i18n.Lang, items []item, results []Result, conflicts []int, seen map[string]struct{},
+	aliasLength int64, filter *aliasfilter.Filter) []int {
+	retry := make([]int, 0, len(conflicts))
+	for _, idx := range conflicts {
+		alias, err := generate(items[idx].domain, seen, aliasLength, filter)
+		if err != nil {
+			log.Error("не удалось сгенерировать alias", sl.Err(err))
+
+			items[idx].err = i18n.T(lang, i18n.MsgCreateFailed)
+			items[idx].code = resp.CodeInternal
+			results[idx].Error = items[idx].err
+			results[idx].Code = items[idx].code
+			continue
+		}
+
+		items[idx].req.Alias = alias
+		results[idx].Alias = alias
+		retry = append(retry, idx)
+	}
+
+	return retry
+}
+
+// saveChunks сохраняет элементы pending порциями по chunkSize, каждая порция в своей транзакции.
+// Возвращает элементы со сгенерированным алиасом, занятым в базе, их результат не заполняется
+func saveChunks(log *slog.Logger, lang i18n.Lang, saver URLBatchSaver, items []item, results []Result, pending []int,
+	chunkSize int, resolver *domains.Resolver, trail *audit.Trail) (conflicts []int) {
+	if chunkSize <= 0 {
+		chunkSize = len(pending)
+	}
+
+	chunk := make([]storage.URLData, 0, chunkSize)
+	indexes := make([]int, 0, chunkSize)
+
+	flush := func() {
+		if len(chunk) == 0 {
+			return
+		}
+
+		saved, err := saver.SaveUrlBatch(chunk, trail)
+		if err != nil {
+			log.Error("не удалось сохранить пачку URL", sl.Err(err))
+		}
+
+		for j, idx := range indexes {
+			switch {
+			case err != nil:
+				results[idx].Error = i18n.T(lang, i18n.MsgCreateFailed)
+				results[idx].Code = resp.CodeInternal
+			case errors.Is(saved[j].Err, storage.ErrURLExists) && items[idx].generated && items[idx].req.ID == 0:
+				// занят алиас, который клиент не выбирал: элемент сохраняется ещё раз с новым алиасом
+				conflicts = append(conflicts, idx)
+			case errors.Is(saved[j].Err, storage.ErrURLExists):
+				results[idx].Error = i18n.T(lang, i18n.MsgBatchExists)
+				results[idx].Code = resp.FromStorage(saved[j].Err, "").Code
+			case saved[j].Err != nil:
+				results[idx].Error = i18n.T(lang, i18n.MsgCreateFailed)
+				results[idx].Code = resp.CodeInternal
+			default:
+				results[idx].ID = saved[j].Id
+				results[idx].ShortURL = resolver.ShortURL(chunk[j].Domain, chunk[j].Alias)
+			}
+		}
+
+		chunk = chunk[:0]
+		indexes = indexes[:0]
+	}
+
+	for _, i := range pending {
+		chunk = append(chunk, items[i].urlData())
+		indexes = append(indexes, i)
+
+		if len(chunk) == chunkSize {
+			flush()
+		}
+	}
+	flush()
+
+	return conflicts
+}
+
+// urlData запись для сохранения из подготовленного элемента
+func (it item) urlData() storage.URLData {
+	return storage.URLData{
+		Id:        it.req.ID,
+		Alias:     it.req.Alias,
+		Url:       it.req.URL,
+		Domain:    it.domain,
+		ExpiresAt: it.req.ExpiresAt,
+		Options:   it.opts,
+	}
+}
+
+func isNDJSON(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+
+	return mediaType == "application/x-ndjson" || mediaType == "application/ndjson"
+}
+
+// decodeJSON разбирает JSON массив запросов, не загружая тело целиком
+func decodeJSON(body io.Reader, maxSize int) ([]item, error) {
+	dec := json.NewDecoder(body)
+
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		return nil, errors.New("ожидается JSON массив")
+	}
+
+	var items []item
+	for dec.More() {
+		if len(items) == maxSize {
+			return nil, errBatchTooLarge
+		}
+
+		// элемент читается целиком, чтобы неподходящий по типам не прерывал разбор массива
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, err
+		}
+
+		var it item
+		if err := json.Unmarshal(raw, &it.req); err != nil {
+			// текст ошибки подставляется в prepare на языке запроса
+			it.code = resp.CodeInvalidJSON
+		}
+		items = append(items, it)
+	}
+
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// decodeNDJSON разбирает поток запросов по одному JSON объекту на строку,
+// ошибка в строке попадает в результат этого элемента
+func decodeNDJSON(body io.Reader, maxSize int) ([]item, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+
+	var items []item
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		if len(items) == maxSize {
+			return nil, errBatchTooLarge
+		}
+
+		var it item
+		if err := json.Unmarshal(line, &it.req); err != nil {
+			// текст ошибки подставляется в prepare на языке запроса
+			it.code = resp.CodeInvalidJSON
+		}
+		items = append(items, it)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+func responseOk(w http.ResponseWriter, r *http.Request, results []Result) {
+	var failed int
+	for _, res := range results {
+		if res.Error != "" {
+			failed++
+		}
+	}
+
+	render.JSON(w, r, Response{
+		Response: resp.OK(),
+		Results:  results,
+		Created:  len(results) - failed,
+		Failed:   failed,
+	})
+}
@@ -0,0 +1,167 @@
+package batch_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"url-shoter/internal/http-server/handlers/url/batch"
+	"url-shoter/internal/lib/aliasfilter"
+	"url-shoter/internal/lib/audit"
+	"url-shoter/internal/lib/domains"
+	"url-shoter/internal/lib/logger/handlers/slogdiscard"
+	"url-shoter/internal/storage"
+)
+
+// fakeSaver сохраняет всё кроме алиасов из taken, первые busy записей считает занятыми, запоминает размеры порций
+type fakeSaver struct {
+	taken  map[string]bool
+	busy   int
+	chunks []int
+	nextID int64
+}
+
+func (f *fakeSaver) SaveUrlBatch(items []storage.URLData, _ *audit.Trail) ([]storage.SaveResult, error) {
+	f.chunks = append(f.chunks, len(items))
+
+	results := make([]storage.SaveResult, len(items))
+	for i, item := range items {
+		if f.taken[item.Alias] || f.busy > 0 {
+			f.busy--
+			results[i].Err = storage.ErrURLExists
+			continue
+		}
+		f.nextID++
+		results[i].Id = f.nextID
+	}
+
+	return results, nil
+}
+
+func TestBatchHandler(t *testing.T) {
+	cases := []struct {
+		name        string
+		contentType string
+		body        string
+		maxSize     int
+		busy        int
+		wantErrors  []bool
+		wantChunks  []int
+		respError   string
+		wantStatus  int
+	}{
+		{
+			name:       "JSON array",
+			body:       `[{"url":"https://google.com","alias":"g"},{"url":"https://ya.ru"},{"url":"https://go.dev","alias":"taken"}]`,
+			maxSize:    10,
+			wantErrors: []bool{false, false, true},
+			wantChunks: []int{2, 1},
+		},
+		{
+			name:       "JSON array with mistyped element",
+			body:       `[{"url":"https://google.com"},{"url":5},{"url":"https://ya.ru"}]`,
+			maxSize:    10,
+			wantErrors: []bool{false, true, false},
+			wantChunks: []int{2},
+		},
+		{
+			name:       "Generated alias taken in storage",
+			body:       `[{"url":"https://google.com"},{"url":"https://go.dev","alias":"taken"}]`,
+			maxSize:    10,
+			busy:       1,
+			wantErrors: []bool{false, true},
+			wantChunks: []int{2, 1},
+		},
+		{
+			name:        "NDJSON with broken line",
+			contentType: "application/x-ndjson",
+			body:        "{\"url\":\"https://google.com\"}\nnot json\n\n{\"url\":\"bad url\"}\n",
+			maxSize:     10,
+			wantErrors:  []bool{false, true, true},
+			wantChunks:  []int{1},
+		},
+		{
+			name:       "Same alias in different domains",
+			body:       `[{"url":"https://google.com","alias":"a"},{"url":"https://ya.ru","alias":"a","domain":"brand.io"},{"url":"https://go.dev","domain":"evil.com"}]`,
+			maxSize:    10,
+			wantErrors: []bool{false, false, true},
+			wantChunks: []int{2},
+		},
+		{
+			name:       "Duplicate alias in batch",
+			body:       `[{"url":"https://google.com","alias":"a"},{"url":"https://ya.ru","alias":"a"}]`,
+			maxSize:    10,
+			wantErrors: []bool{false, true},
+			wantChunks: []int{1},
+		},
+		{
+			name:       "Reserved and malformed alias",
+			body:       `[{"url":"https://google.com","alias":"Admin"},{"url":"https://ya.ru","alias":"ok"},{"url":"https://go.dev","alias":"a b"}]`,
+			maxSize:    10,
+			wantErrors: []bool{true, false, true},
+			wantChunks: []int{1},
+		},
+		{
+			name:       "Password over bcrypt bytes",
+			body:       `[{"url":"https://google.com","password":"парольпарольпарольпарольпарольпарольпароль"},{"url":"https://ya.ru","password":"секретно"}]`,
+			maxSize:    10,
+			wantErrors: []bool{true, false},
+			wantChunks: []int{1},
+		},
+		{
+			name:       "Too large",
+			body:       `[{"url":"https://google.com"},{"url":"https://ya.ru"}]`,
+			maxSize:    1,
+			respError:  "превышен максимальный размер пачки: 1",
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			saver := &fakeSaver{taken: map[string]bool{"taken": true}, busy: tc.busy}
+			filter, err := aliasfilter.New(aliasfilter.DefaultRules, []string{"admin"}, nil)
+			require.NoError(t, err)
+			resolver, err := domains.New("", "sho.rt", []string{"brand.io"}, "https")
+			require.NoError(t, err)
+			handler := batch.New(slogdiscard.NewDiscardLogger(), saver, 6, tc.maxSize, 2, resolver, filter, nil)
+
+			req := httptest.NewRequest(http.MethodPost, "/url/batch", strings.NewReader(tc.body))
+			if tc.contentType != "" {
+				req.Header.Set("Content-Type", tc.contentType)
+			}
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			wantStatus := tc.wantStatus
+			if wantStatus == 0 {
+				wantStatus = http.StatusOK
+			}
+			require.Equal(t, wantStatus, rr.Code)
+
+			var resp batch.Response
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+
+			require.Equal(t, tc.respError, resp.Error)
+			require.Len(t, resp.Results, len(tc.wantErrors))
+			assert.Equal(t, tc.wantChunks, saver.chunks)
+
+			for i, res := range resp.Results {
+				assert.Equal(t, i, res.Index)
+				assert.Equal(t, tc.wantErrors[i], res.Error != "", "элемент %d: %s", i, res.Error)
+				assert.Equal(t, tc.wantErrors[i], res.Code != "", "элемент %d: код ошибки", i)
+				if !tc.wantErrors[i] {
+					assert.NotEmpty(t, res.Alias)
+					assert.NotZero(t, res.ID)
+					assert.Contains(t, res.ShortURL, "/"+res.Alias)
+				}
+			}
+		})
+	}
+}
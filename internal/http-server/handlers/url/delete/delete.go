@@ -1,17 +1,23 @@
 package delete
 
 import (
+	"errors"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/render"
 	"log/slog"
 	"net/http"
 	"strconv"
+	"url-shoter/internal/lib/actor"
 	resp "url-shoter/internal/lib/api/response"
+	"url-shoter/internal/lib/audit"
+	"url-shoter/internal/lib/i18n"
+	"url-shoter/internal/lib/logger/sl"
+	"url-shoter/internal/storage"
 )
 
 type UrlDeleter interface {
-	DeleteById(id int64) error
+	DeleteById(id int64, actor string, trail *audit.Trail) error
 	ExistUrlById(id int64) (bool, error)
 }
 
@@ -21,35 +27,49 @@ type Request struct {
 
 type Response struct {
 	resp.Response
-	Error error `json:"error,omitempty"`
 }
 
-func Delete(log *slog.Logger, deleter UrlDeleter) http.HandlerFunc {
+/*
+Delete перенос ссылки в корзину, окончательно она удаляется очисткой корзины по сроку.
+Ссылка до удаления записывается в журнал аудита auditor вместе с удалением, без записи ссылка не удаляется
+*/
+func Delete(log *slog.Logger, deleter UrlDeleter, auditor *audit.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "internal.http.handlers.url.delete.Delete"
 
-		log = log.With(
+		log := log.With(
 			slog.String("op", op),
 			slog.String("request_id", middleware.GetReqID(r.Context())),
 		)
 
 		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
 		if err != nil {
-			log.Error(op, "не верно передан id, он должен быть типа int64", id, err)
-			responseError(w, r, err)
+			log.Error("не верно передан id, он должен быть типа int64", sl.Err(err))
+			resp.Render(w, r, resp.BadRequest(resp.CodeInvalidID, i18n.MsgInvalidID))
+			return
 		}
 
 		exist, err := deleter.ExistUrlById(id)
-		if err != nil || !exist {
-			log.Error(op, "не удалось найти урл с соотвествующим id", id, err)
-			responseError(w, r, err)
+		if err != nil {
+			log.Error("не удалось проверить урл по id", slog.Int64("id", id), sl.Err(err))
+			resp.Render(w, r, resp.FromStorage(err, i18n.MsgDeleteFailed))
+			return
+		}
+		if !exist {
+			log.Info("не удалось найти урл с соотвествующим id", slog.Int64("id", id))
+			resp.Render(w, r, resp.FromStorage(storage.ErrURLNotFound, i18n.MsgIDNotFound))
 			return
 		}
 
-		err = deleter.DeleteById(id)
+		err = deleter.DeleteById(id, actor.FromRequest(r), auditor.Trail(r))
+		if errors.Is(err, storage.ErrURLNotFound) {
+			log.Info("ссылка уже в корзине", slog.Int64("id", id))
+			resp.Render(w, r, resp.FromStorage(err, i18n.MsgIDNotFound))
+			return
+		}
 		if err != nil {
-			log.Error(op, "Не удалось удалить url по id", id, err)
-			responseError(w, r, err)
+			log.Error("Не удалось удалить url по id", slog.Int64("id", id), sl.Err(err))
+			resp.Render(w, r, resp.FromStorage(err, i18n.MsgDeleteFailed))
 			return
 		}
 
@@ -61,13 +81,5 @@ func Delete(log *slog.Logger, deleter UrlDeleter) http.HandlerFunc {
 func responseOk(w http.ResponseWriter, r *http.Request) {
 	render.JSON(w, r, Response{
 		Response: resp.OK(),
-		Error:    nil,
-	})
-}
-
-func responseError(w http.ResponseWriter, r *http.Request, err error) {
-	render.JSON(w, r, Response{
-		Response: resp.Error("id not exist"),
-		Error:    err,
 	})
 }
@@ -7,29 +7,41 @@ import (
 	"github.com/go-playground/validator/v10"
 	"log/slog"
 	"net/http"
+	"url-shoter/internal/lib/aliasfilter"
+	"url-shoter/internal/lib/api/link"
 	resp "url-shoter/internal/lib/api/response"
+	"url-shoter/internal/lib/audit"
+	"url-shoter/internal/lib/domains"
+	"url-shoter/internal/lib/i18n"
 	"url-shoter/internal/lib/logger/sl"
+	"url-shoter/internal/storage"
 )
 
 type Request struct {
-	Alias string `json:"alias,omitempty"`
-	ID    int64  `json:"id,omitempty"`
+	Alias string `json:"alias,omitempty" validate:"required"`
+	ID    int64  `json:"id,omitempty" validate:"required"`
 }
 
 type Response struct {
 	resp.Response
 	Info string `json:"info,omitempty"`
+	*link.Link
 }
 
 type editorAlias interface {
-	ReplacementAliasByID(id int64, alias string) (int64, error)
+	ReplacementAliasByID(id int64, alias string, trail *audit.Trail) (int64, error)
+	GetUrlDataById(id int64) (storage.URLData, error)
 }
 
-func New(log *slog.Logger, editor editorAlias) http.HandlerFunc {
-	const op = "internal.http.handlers.url.save.New"
+/*
+New смена алиаса ссылки, новый алиас проверяется фильтром filter, nil - без фильтра.
+Ссылка до и после смены записывается в журнал аудита auditor вместе со сменой, без записи алиас не меняется
+*/
+func New(log *slog.Logger, editor editorAlias, resolver *domains.Resolver, filter *aliasfilter.Filter, auditor *audit.Logger) http.HandlerFunc {
+	const op = "internal.http.handlers.url.editAlias.New"
 
 	return func(w http.ResponseWriter, r *http.Request) {
-		log = log.With(
+		log := log.With(
 			slog.String("op", op),
 			slog.String("request_id", middleware.GetReqID(r.Context())),
 		)
@@ -40,7 +52,7 @@ func New(log *slog.Logger, editor editorAlias) http.HandlerFunc {
 		if err != nil {
 			log.Error("Не удалось расшифровать тело запроса", sl.Err(err))
 
-			render.JSON(w, r, resp.Error("не удалось расшифровать запрос"))
+			resp.Render(w, r, resp.BadRequest(resp.CodeInvalidJSON, i18n.MsgInvalidJSON))
 
 			return
 		}
@@ -52,34 +64,42 @@ func New(log *slog.Logger, editor editorAlias) http.HandlerFunc {
 			errors.As(err, &validateErr)
 			log.Error("invalid request", sl.Err(err))
 
-			render.JSON(w, r, resp.ValidationError(validateErr))
+			resp.Render(w, r, resp.Validation(validateErr))
 
 			return
 		}
 
 		id := req.ID
-		alias := req.Alias
+		alias, err := filter.Check(req.Alias)
+		if err != nil {
+			log.Info("alias не прошёл проверку", slog.String("alias", alias), sl.Err(err))
+
+			resp.Render(w, r, resp.InvalidAlias(err))
+
+			return
+		}
 
-		_, err = editor.ReplacementAliasByID(id, alias)
+		_, err = editor.ReplacementAliasByID(id, alias, auditor.Trail(r))
 		if err != nil {
 			log.Error("не удалось сменить алиас", sl.Err(err))
-			responseError(w, r, "не удалось сменить алиас")
+			resp.Render(w, r, resp.FromStorage(err, i18n.MsgEditAliasFailed))
 			return
 		}
 
-		responseOk(w, r, "success")
+		data, err := editor.GetUrlDataById(id)
+		if err != nil {
+			log.Error("не удалось прочитать URL после смены алиаса", sl.Err(err))
+			data = storage.URLData{Id: id, Alias: alias}
+		}
+
+		responseOk(w, r, "success", link.New(data, resolver))
 	}
 }
 
-func responseOk(w http.ResponseWriter, r *http.Request, info string) {
+func responseOk(w http.ResponseWriter, r *http.Request, info string, l *link.Link) {
 	render.JSON(w, r, Response{
 		Response: resp.OK(),
 		Info:     info,
-	})
-}
-
-func responseError(w http.ResponseWriter, r *http.Request, error string) {
-	render.JSON(w, r, Response{
-		Response: resp.Error(error),
+		Link:     l,
 	})
 }
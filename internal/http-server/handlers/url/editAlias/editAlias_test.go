@@ -0,0 +1,96 @@
+package editAlias_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"url-shoter/internal/http-server/handlers/url/editAlias"
+	resp "url-shoter/internal/lib/api/response"
+	"url-shoter/internal/lib/audit"
+	"url-shoter/internal/lib/domains"
+	"url-shoter/internal/lib/logger/handlers/slogdiscard"
+	"url-shoter/internal/storage"
+)
+
+// fakeEditor ведёт себя как хранилище: ссылка в корзине не находится, занятый алиас не выдаётся
+type fakeEditor struct {
+	links map[int64]storage.URLData
+}
+
+func (f *fakeEditor) ReplacementAliasByID(id int64, alias string, _ *audit.Trail) (int64, error) {
+	data, ok := f.links[id]
+	if !ok || data.DeletedAt != nil {
+		return 0, storage.ErrURLNotFound
+	}
+	for _, other := range f.links {
+		if other.Id != id && other.Alias == alias {
+			return 0, storage.ErrAliasExists
+		}
+	}
+
+	data.Alias = alias
+	f.links[id] = data
+
+	return id, nil
+}
+
+func (f *fakeEditor) GetUrlDataById(id int64) (storage.URLData, error) {
+	data, ok := f.links[id]
+	if !ok {
+		return storage.URLData{}, storage.ErrURLNotFound
+	}
+
+	return data, nil
+}
+
+func TestEditAlias(t *testing.T) {
+	deletedAt := time.Now().Add(-time.Hour)
+
+	cases := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantCode   resp.Code
+		wantAlias  string
+	}{
+		{"Success", `{"id":1,"alias":"fresh"}`, http.StatusOK, "", "fresh"},
+		{"Alias taken", `{"id":1,"alias":"other"}`, http.StatusConflict, resp.CodeAliasExists, ""},
+		{"Trashed link", `{"id":2,"alias":"revived"}`, http.StatusNotFound, resp.CodeURLNotFound, ""},
+		{"Missing link", `{"id":9,"alias":"ghost"}`, http.StatusNotFound, resp.CodeURLNotFound, ""},
+	}
+
+	resolver, err := domains.New("", "sho.rt", nil, "https")
+	require.NoError(t, err)
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			editor := &fakeEditor{links: map[int64]storage.URLData{
+				1: {Id: 1, Alias: "old", Url: "https://go.dev"},
+				2: {Id: 2, Alias: "trashed", Url: "https://ya.ru", DeletedAt: &deletedAt},
+				3: {Id: 3, Alias: "other", Url: "https://google.com"},
+			}}
+			handler := editAlias.New(slogdiscard.NewDiscardLogger(), editor, resolver, nil, nil)
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/url/edit", strings.NewReader(tc.body)))
+
+			require.Equal(t, tc.wantStatus, rr.Code)
+
+			var body editAlias.Response
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+			assert.Equal(t, tc.wantCode, body.Code)
+			if tc.wantAlias != "" {
+				assert.Equal(t, tc.wantAlias, body.Alias)
+				assert.Equal(t, "https://sho.rt/"+tc.wantAlias, body.ShortURL)
+			}
+			assert.Equal(t, "trashed", editor.links[2].Alias, "алиас ссылки в корзине не меняется")
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package exportUrls
+
+import (
+	"fmt"
+	"github.com/go-chi/chi/v5/middleware"
+	"log/slog"
+	"net/http"
+	resp "url-shoter/internal/lib/api/response"
+	"url-shoter/internal/lib/i18n"
+	"url-shoter/internal/lib/linkio"
+	"url-shoter/internal/lib/logger/sl"
+	"url-shoter/internal/storage"
+)
+
+type URLsExporter interface {
+	IterateUrls(fn func(storage.URLData) error) error
+}
+
+func New(log *slog.Logger, exporter URLsExporter) http.HandlerFunc {
+	const op = "internal.http.handlers.url.exportUrls.New"
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = linkio.FormatJSON
+		}
+
+		writer, err := linkio.NewWriter(format, w)
+		if err != nil {
+			log.Info("неизвестный формат выгрузки", slog.String("format", format))
+
+			resp.Render(w, r, resp.BadRequest(resp.CodeInvalidParam, i18n.MsgExportFormat))
+
+			return
+		}
+
+		w.Header().Set("Content-Type", linkio.ContentType(format))
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="urls.%s"`, format))
+
+		var count int
+		err = exporter.IterateUrls(func(data storage.URLData) error {
+			count++
+			return writer.Write(data)
+		})
+		if err == nil {
+			err = writer.Close()
+		}
+		if err != nil {
+			// заголовки и часть данных уже отправлены, остаётся только залогировать
+			log.Error("выгрузка прервана", slog.Int("count", count), sl.Err(err))
+
+			return
+		}
+
+		log.Info("выгрузка завершена", slog.Int("count", count))
+	}
+}
@@ -0,0 +1,186 @@
+package importUrls
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"url-shoter/internal/http-server/handlers/url/save"
+	"url-shoter/internal/lib/aliasfilter"
+	resp "url-shoter/internal/lib/api/response"
+	"url-shoter/internal/lib/audit"
+	"url-shoter/internal/lib/domains"
+	"url-shoter/internal/lib/i18n"
+	"url-shoter/internal/lib/linkio"
+	"url-shoter/internal/lib/logger/sl"
+	"url-shoter/internal/storage"
+)
+
+type URLsImporter interface {
+	ImportUrls(next func() (storage.URLData, error), mode storage.ConflictMode, dryRun bool, trail *audit.Trail) (storage.ImportReport, error)
+}
+
+type Response struct {
+	resp.Response
+	Report *storage.ImportReport `json:"report,omitempty"`
+}
+
+/*
+New импорт ссылок из тела запроса. Итог импорта, кроме пробного, записывается в журнал аудита auditor
+одной записью без ссылки, заменённые ссылки - каждая своей записью, всё в транзакции импорта.
+Записи проверяются как в POST /url: адрес и параметры перехода валидатором, алиас фильтром filter, nil - без фильтра.
+Не прошедшие проверку записи пропускаются и перечисляются в отчёте
+*/
+func New(log *slog.Logger, importer URLsImporter, resolver *domains.Resolver, filter *aliasfilter.Filter,
+	auditor *audit.Logger) http.HandlerFunc {
+	const op = "internal.http.handlers.url.importUrls.New"
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		query := r.URL.Query()
+
+		format := query.Get("format")
+		if format == "" {
+			mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			format = linkio.FormatByContentType(mediaType)
+		}
+
+		mode, err := storage.ParseConflictMode(query.Get("conflict"))
+		if err != nil {
+			log.Info("неизвестный режим конфликта", slog.String("conflict", query.Get("conflict")))
+
+			resp.Render(w, r, resp.BadRequest(resp.CodeInvalidParam, i18n.MsgConflictMode))
+
+			return
+		}
+
+		var dryRun bool
+		if v := query.Get("dry_run"); v != "" {
+			dryRun, err = strconv.ParseBool(v)
+			if err != nil {
+				resp.Render(w, r, resp.BadRequest(resp.CodeInvalidParam, i18n.MsgInvalidDryRun))
+
+				return
+			}
+		}
+
+		// домен для записей, у которых он не указан, например для выгрузок других сервисов
+		domain, err := resolver.Key(query.Get("domain"))
+		if err != nil {
+			log.Info("домен не разрешён", slog.String("domain", query.Get("domain")))
+
+			resp.Render(w, r, resp.Unprocessable(resp.CodeDomainNotAllowed, i18n.MsgDomainNotAllowed))
+
+			return
+		}
+
+		reader, err := linkio.NewReader(format, r.Body)
+		if err != nil {
+			log.Error("Не удалось расшифровать тело запроса", sl.Err(err))
+
+			if errors.Is(err, linkio.ErrUnknownFormat) {
+				resp.Render(w, r, resp.BadRequest(resp.CodeInvalidParam, i18n.MsgImportFormat))
+
+				return
+			}
+			resp.Render(w, r, resp.BadRequest(resp.CodeInvalidJSON, i18n.MsgInvalidJSON))
+
+			return
+		}
+
+		lang := i18n.FromRequest(r)
+		validate := validator.New()
+
+		next := func() (storage.URLData, error) {
+			data, err := reader.Read()
+			if err != nil {
+				return data, err
+			}
+
+			if err := check(validate, filter, lang, &data); err != nil {
+				return data, err
+			}
+
+			if data.Domain == "" {
+				data.Domain = domain
+				return data, nil
+			}
+
+			data.Domain, err = resolver.Key(data.Domain)
+			if err != nil {
+				return data, fmt.Errorf("%w: %s: %s", linkio.ErrInvalidRecord, data.Domain, i18n.T(lang, i18n.MsgDomainNotAllowed))
+			}
+
+			return data, nil
+		}
+
+		report, err := importer.ImportUrls(next, mode, dryRun, auditor.Trail(r))
+		if errors.Is(err, storage.ErrImportConflict) {
+			log.Info("импорт прерван на конфликте", sl.Err(err))
+
+			responseError(w, r, resp.FromStorage(err, i18n.MsgImportConflict), &report)
+
+			return
+		}
+		if err != nil {
+			log.Error("не удалось импортировать URL", sl.Err(err))
+
+			responseError(w, r, resp.Internal(i18n.MsgImportFailed, err), nil)
+
+			return
+		}
+
+		log.Info("импорт завершён",
+			slog.Bool("dry_run", dryRun),
+			slog.Int("total", report.Total),
+			slog.Int("created", report.Created),
+			slog.Int("overwritten", report.Overwritten),
+			slog.Int("skipped", report.Skipped),
+			slog.Int("invalid", report.Invalid),
+		)
+
+		responseOk(w, r, &report)
+	}
+}
+
+// check проверка записи по правилам создания ссылки, алиас приводится фильтром к сохраняемому виду
+func check(validate *validator.Validate, filter *aliasfilter.Filter, lang i18n.Lang, data *storage.URLData) error {
+	req := save.Request{URL: data.Url, RedirectType: data.RedirectType, Rules: data.Rules, Variants: data.Variants,
+		Sticky: data.Sticky}
+	if err := validate.Struct(req); err != nil {
+		var validateErr validator.ValidationErrors
+		errors.As(err, &validateErr)
+		return fmt.Errorf("%w: %s", linkio.ErrInvalidRecord, resp.ValidationError(lang, validateErr).Error)
+	}
+
+	alias, err := filter.Check(data.Alias)
+	if err != nil {
+		return fmt.Errorf("%w: %s", linkio.ErrInvalidRecord, resp.InvalidAlias(err).Message(lang))
+	}
+	data.Alias = alias
+
+	return nil
+}
+
+func responseOk(w http.ResponseWriter, r *http.Request, report *storage.ImportReport) {
+	render.JSON(w, r, Response{
+		Response: resp.OK(),
+		Report:   report,
+	})
+}
+
+func responseError(w http.ResponseWriter, r *http.Request, apiErr *resp.APIError, report *storage.ImportReport) {
+	resp.RenderWith(w, r, apiErr, Response{
+		Response: resp.Fail(r, apiErr),
+		Report:   report,
+	})
+}
@@ -0,0 +1,82 @@
+package importUrls_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"url-shoter/internal/http-server/handlers/url/importUrls"
+	"url-shoter/internal/lib/aliasfilter"
+	"url-shoter/internal/lib/audit"
+	"url-shoter/internal/lib/domains"
+	"url-shoter/internal/lib/logger/handlers/slogdiscard"
+	"url-shoter/internal/storage"
+)
+
+// fakeImporter принимает записи как хранилище: некорректные пропускает, остальные запоминает
+type fakeImporter struct {
+	saved []storage.URLData
+}
+
+func (f *fakeImporter) ImportUrls(next func() (storage.URLData, error), _ storage.ConflictMode, dryRun bool,
+	_ *audit.Trail) (storage.ImportReport, error) {
+	report := storage.ImportReport{DryRun: dryRun}
+	for line := 1; ; line++ {
+		data, err := next()
+		if errors.Is(err, io.EOF) {
+			return report, nil
+		}
+		if errors.Is(err, storage.ErrInvalidRecord) {
+			report.Reject(line, data.Alias, err)
+			continue
+		}
+		if err != nil {
+			return report, err
+		}
+		report.Total++
+		report.Created++
+		f.saved = append(f.saved, data)
+	}
+}
+
+func TestImportRejectsInvalidRecords(t *testing.T) {
+	importer := &fakeImporter{}
+	filter, err := aliasfilter.New(aliasfilter.DefaultRules, []string{"all"}, nil)
+	require.NoError(t, err)
+	resolver, err := domains.New("", "sho.rt", nil, "https")
+	require.NoError(t, err)
+	handler := importUrls.New(slogdiscard.NewDiscardLogger(), importer, resolver, filter, nil)
+
+	body := strings.Join([]string{
+		`{"alias":"go","url":"https://go.dev"}`,
+		`{"alias":"xss","url":"javascript:alert(1)"}`,
+		`{"alias":"all","url":"https://example.com"}`,
+		`{"alias":"bad","url":"https://example.com","variants":[{"url":"ftp://example.com","weight":1}]}`,
+	}, "\n")
+	req := httptest.NewRequest(http.MethodPost, "/url/import?format=ndjson", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var res importUrls.Response
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &res))
+	require.NotNil(t, res.Report)
+	assert.Equal(t, 4, res.Report.Total)
+	assert.Equal(t, 1, res.Report.Created)
+	assert.Equal(t, 3, res.Report.Invalid)
+	require.Len(t, res.Report.Rejected, 3)
+	assert.Equal(t, 2, res.Report.Rejected[0].Line)
+	assert.Equal(t, "all", res.Report.Rejected[1].Alias)
+	assert.Equal(t, 4, res.Report.Rejected[2].Line)
+
+	require.Len(t, importer.saved, 1)
+	assert.Equal(t, "go", importer.saved[0].Alias)
+}
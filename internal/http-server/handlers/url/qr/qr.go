@@ -0,0 +1,118 @@
+package qr
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"log/slog"
+	"net/http"
+	"strings"
+	resp "url-shoter/internal/lib/api/response"
+	"url-shoter/internal/lib/domains"
+	"url-shoter/internal/lib/i18n"
+	"url-shoter/internal/lib/logger/sl"
+	"url-shoter/internal/lib/qr"
+	"url-shoter/internal/storage"
+)
+
+// cacheControl короткий срок кэша: ссылку могут удалить или сменить ей алиас, после этого
+// кэш должен перепроверить картинку по ETag и получить 404
+const cacheControl = "public, max-age=300, must-revalidate"
+
+type URLGetter interface {
+	GetURL(domain string, alias string) (string, error)
+}
+
+func New(log *slog.Logger, urlGetter URLGetter, resolver *domains.Resolver) http.HandlerFunc {
+	const op = "internal.http.handlers.url.qr.New"
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		alias := chi.URLParam(r, "alias")
+
+		query := r.URL.Query()
+		// формат можно передать и расширением: /url/{alias}/qr.svg, для этого маршрут содержит {format}
+		if format := chi.URLParam(r, "format"); format != "" && query.Get("format") == "" {
+			query.Set("format", format)
+		}
+
+		opts, err := qr.ParseOptions(query)
+		if err != nil {
+			log.Info("некорректные параметры QR кода", sl.Err(err))
+
+			resp.Render(w, r, resp.BadRequest(resp.CodeInvalidParam, i18n.MsgQROptions))
+
+			return
+		}
+
+		domain, err := resolver.Key(query.Get("domain"))
+		if err != nil {
+			log.Info("домен не разрешён", slog.String("domain", query.Get("domain")))
+
+			resp.Render(w, r, resp.BadRequest(resp.CodeDomainNotAllowed, i18n.MsgDomainNotAllowed))
+
+			return
+		}
+
+		_, err = urlGetter.GetURL(domain, alias)
+		if errors.Is(err, storage.ErrURLNotFound) || errors.Is(err, storage.ErrURLExpired) || errors.Is(err, storage.ErrURLDeleted) {
+			log.Info("url не обнаружен", slog.String("domain", domain), slog.String("alias", alias))
+
+			resp.Render(w, r, resp.FromStorage(err, i18n.MsgNotFound))
+
+			return
+		}
+		if err != nil {
+			log.Error("не удалось получить URL", sl.Err(err))
+
+			resp.Render(w, r, resp.Internal(i18n.MsgInternal, err))
+
+			return
+		}
+
+		shortURL := resolver.ShortURL(domain, alias)
+
+		// картинка зависит только от короткой ссылки и параметров, поэтому ETag считается без кодирования
+		sum := sha256.Sum256([]byte(shortURL + "|" + opts.Key()))
+		etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", cacheControl)
+
+		if match := r.Header.Get("If-None-Match"); match != "" && etagMatch(match, etag) {
+			w.WriteHeader(http.StatusNotModified)
+
+			return
+		}
+
+		image, err := qr.Encode(shortURL, opts)
+		if err != nil {
+			log.Error("не удалось сформировать QR код", sl.Err(err))
+
+			w.Header().Del("ETag")
+			resp.Render(w, r, resp.Internal(i18n.MsgQRFailed, err))
+
+			return
+		}
+
+		w.Header().Set("Content-Type", opts.ContentType())
+		_, _ = w.Write(image)
+	}
+}
+
+func etagMatch(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,63 @@
+package qr_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"url-shoter/internal/http-server/handlers/url/qr"
+	"url-shoter/internal/lib/domains"
+	"url-shoter/internal/lib/logger/handlers/slogdiscard"
+	"url-shoter/internal/storage"
+)
+
+type fakeGetter map[string]string
+
+func (f fakeGetter) GetURL(domain string, alias string) (string, error) {
+	if url, ok := f[alias]; ok {
+		return url, nil
+	}
+
+	return "", storage.ErrURLNotFound
+}
+
+func TestQRFormat(t *testing.T) {
+	cases := []struct {
+		name        string
+		path        string
+		wantStatus  int
+		contentType string
+	}{
+		{"Default", "/url/abc/qr", http.StatusOK, "image/png"},
+		{"Query", "/url/abc/qr?format=svg", http.StatusOK, "image/svg+xml"},
+		{"Extension", "/url/abc/qr.svg", http.StatusOK, "image/svg+xml"},
+		{"Query wins", "/url/abc/qr.svg?format=png", http.StatusOK, "image/png"},
+		{"Unknown extension", "/url/abc/qr.gif", http.StatusBadRequest, ""},
+		{"Alias with dot", "/url/a.b/qr", http.StatusOK, "image/png"},
+		{"Missing", "/url/nope/qr.svg", http.StatusNotFound, ""},
+	}
+
+	resolver, err := domains.New("", "sho.rt", nil, "https")
+	require.NoError(t, err)
+
+	handler := qr.New(slogdiscard.NewDiscardLogger(), fakeGetter{"abc": "https://google.com", "a.b": "https://go.dev"}, resolver)
+	router := chi.NewRouter()
+	router.Get("/url/{alias}/qr", handler)
+	router.Get("/url/{alias}/qr.{format}", handler)
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tc.path, nil))
+
+			require.Equal(t, tc.wantStatus, rr.Code)
+			if tc.contentType != "" {
+				assert.Equal(t, tc.contentType, rr.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
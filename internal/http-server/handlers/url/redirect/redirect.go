@@ -1,59 +1,455 @@
 package redirect
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
-	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/render"
 	"log/slog"
+	"math"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"url-shoter/internal/lib/api/link"
 	resp "url-shoter/internal/lib/api/response"
+	"url-shoter/internal/lib/domains"
+	"url-shoter/internal/lib/i18n"
 	"url-shoter/internal/lib/logger/sl"
+	pg "url-shoter/internal/lib/pages"
+	"url-shoter/internal/lib/password"
+	"url-shoter/internal/lib/rules"
+	"url-shoter/internal/lib/variants"
 	"url-shoter/internal/storage"
 )
 
 //go:generate go run github.com/vektra/mockery/v2@v2.42.1 --name=URLGetter
 
 type URLGetter interface {
-	GetURL(alias string) (string, error)
+	GetRedirect(domain string, alias string) (storage.URLData, error)
 }
 
-func New(log *slog.Logger, urlGetter URLGetter) http.HandlerFunc {
+//go:generate go run github.com/vektra/mockery/v2@v2.42.1 --name=ClickCounter
+
+/*
+ClickCounter учёт переходов, variant -1 для ссылки без A/B теста
+*/
+type ClickCounter interface {
+	RecordClick(id int64, variant int) error
+}
+
+/*
+CountryLocator страна по IP адресу для правил ссылки, nil если база GeoIP не подключена
+*/
+type CountryLocator interface {
+	Country(ip net.IP) (string, error)
+}
+
+/*
+SafetyChecker проверка адреса назначения по списку опасных сайтов, nil если список не задан
+*/
+type SafetyChecker interface {
+	Unsafe(url string) bool
+}
+
+type Response struct {
+	resp.Response
+	*link.Link
+}
+
+/*
+New редирект по короткой ссылке с кодом, заданным у ссылки. Алиас с + на конце или флаг preview у ссылки
+вместо редиректа показывают адрес назначения. Правила ссылки выбирают адрес по платформе, языку, стране и времени,
+если ни одно не сработало и у ссылки есть варианты A/B теста, адрес выбирается по весам вариантов.
+Ссылка с паролем открывается после проверки пароля из заголовка X-Link-Password или формы (POST на тот же адрес),
+guard выдаёт cookie доступа и ограничивает неверные попытки. Переход на адрес, который safety считает опасным,
+не выполняется: браузер получает страницу предупреждения, остальные клиенты ошибку 403.
+Если pages задан, браузеры вместо JSON получают HTML страницы
+*/
+func New(log *slog.Logger, urlGetter URLGetter, counter ClickCounter, resolver *domains.Resolver, pages *pg.Renderer,
+	locator CountryLocator, safety SafetyChecker, guard *password.Guard) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "internal.http.handlers.url.redirect.New"
 
-		log = log.With(
+		log := log.With(
 			slog.String("op", op),
 			slog.String("request_id", middleware.GetReqID(r.Context())),
 		)
 
-		alias := chi.URLParam(r, "alias")
-		if alias == "" {
-			log.Info("%s, alias ек обнаружен", op)
+		alias, rest, err := splitPath(r.URL)
+		if err != nil || alias == "" {
+			log.Info("alias не обнаружен", slog.String("path", r.URL.Path))
 
-			render.JSON(w, r, resp.Error("не найдено"))
+			renderError(log, w, r, pages, resp.NotFound(i18n.MsgNotFound), pg.Data{})
 
 			return
 		}
 
-		resURL, err := urlGetter.GetURL(alias)
+		alias, preview := strings.CutSuffix(alias, link.PreviewSuffix)
+		domain := resolver.FromHost(r.Host)
+
+		data, err := urlGetter.GetRedirect(domain, alias)
 		if errors.Is(err, storage.ErrURLNotFound) {
-			log.Info("url не обнаружен", "alias", alias)
+			log.Info("url не обнаружен", slog.String("domain", domain), slog.String("alias", alias))
+
+			renderError(log, w, r, pages, resp.FromStorage(err, i18n.MsgNotFound), pg.Data{
+				Alias:    alias,
+				ShortURL: resolver.ShortURL(domain, alias),
+			})
+
+			return
+		}
+		if errors.Is(err, storage.ErrURLExpired) {
+			log.Info("срок жизни ссылки истёк", slog.String("domain", domain), slog.String("alias", alias))
+
+			renderError(log, w, r, pages, resp.FromStorage(err, i18n.MsgURLExpired), pg.Data{
+				Alias:    alias,
+				ShortURL: resolver.ShortURL(domain, alias),
+			})
+
+			return
+		}
+		if errors.Is(err, storage.ErrURLDeleted) {
+			log.Info("ссылка удалена", slog.String("domain", domain), slog.String("alias", alias))
 
-			render.JSON(w, r, resp.Error("не обнаружено"))
+			renderError(log, w, r, pages, resp.FromStorage(err, i18n.MsgURLDeleted), pg.Data{
+				Alias:    alias,
+				ShortURL: resolver.ShortURL(domain, alias),
+			})
 
 			return
 		}
 		if err != nil {
 			log.Error("не удалось создать URL", sl.Err(err))
 
-			render.JSON(w, r, resp.Error("Другая ошибка"))
+			resp.Render(w, r, resp.Internal(i18n.MsgInternal, err))
+
+			return
+		}
+
+		if rest != "" && !data.ForwardPath {
+			log.Info("путь после алиаса не пробрасывается", slog.String("alias", alias), slog.String("path", rest))
+
+			renderError(log, w, r, pages, resp.NotFound(i18n.MsgNotFound), pg.Data{
+				Alias:    alias,
+				ShortURL: resolver.ShortURL(domain, alias),
+			})
+
+			return
+		}
+
+		if data.PasswordHash != "" && !unlock(log, w, r, pages, guard, data, pg.Data{
+			Alias:    alias,
+			ShortURL: resolver.ShortURL(domain, alias),
+		}) {
+			return
+		}
+
+		variant := -1
+		target, matched := "", false
+		if len(data.Rules) > 0 {
+			target, matched = rules.Match(data.Rules, ruleRequest(log, r, locator))
+		}
+
+		switch {
+		case matched:
+			log.Info("сработало правило ссылки", slog.String("url", target))
+			data.Url = target
+		case len(data.Variants) > 0:
+			variant = pickVariant(w, r, data)
+			log.Info("выбран вариант ссылки", slog.Int("variant", variant))
+			data.Url = data.Variants[variant].URL
+		}
+
+		data.Url, err = destination(data, rest, r.URL.RawQuery)
+		if err != nil {
+			log.Error("некорректный адрес назначения", slog.String("url", data.Url), sl.Err(err))
+
+			resp.Render(w, r, resp.Internal(i18n.MsgInternal, err))
+
+			return
+		}
+
+		if safety != nil && safety.Unsafe(data.Url) {
+			log.Warn("адрес назначения в списке опасных", slog.String("alias", alias), slog.String("url", data.Url))
+
+			renderError(log, w, r, pages, resp.NewError(http.StatusForbidden, resp.CodeURLUnsafe, i18n.MsgURLUnsafe), pg.Data{
+				Alias:    alias,
+				ShortURL: resolver.ShortURL(domain, alias),
+				URL:      data.Url,
+			})
+
+			return
+		}
+
+		if preview || data.Preview {
+			log.Info("предпросмотр ссылки", slog.String("url", data.Url))
+
+			renderPreview(log, w, r, pages, link.New(data, resolver))
 
 			return
 		}
 
-		log.Info("редирект по урлу", slog.String("url", resURL))
+		// ошибка учёта не должна ломать переход
+		if err := counter.RecordClick(data.Id, variant); err != nil {
+			log.Error("не удалось учесть переход", sl.Err(err))
+		}
+
+		log.Info("редирект по урлу", slog.String("url", data.Url), slog.Int("status", redirectStatus(data.RedirectType)))
+
+		http.Redirect(w, r, data.Url, redirectStatus(data.RedirectType))
+	}
+}
+
+// unlock доступ к ссылке с паролем по cookie, заголовку или форме. false означает, что ответ уже отправлен
+func unlock(log *slog.Logger, w http.ResponseWriter, r *http.Request, pages *pg.Renderer, guard *password.Guard,
+	data storage.URLData, pageData pg.Data) bool {
+	// ответ зависит от cookie и пароля, кешировать его нельзя
+	w.Header().Set("Cache-Control", "no-store")
+
+	if guard.Valid(r, data.Id, data.PasswordHash) {
+		return true
+	}
+
+	secret := r.Header.Get(password.HeaderName)
+	form := false
+	if secret == "" && r.Method == http.MethodPost {
+		r.Body = http.MaxBytesReader(w, r.Body, maxFormSize)
+		secret = r.PostFormValue("password")
+		form = true
+	}
+
+	if secret == "" {
+		renderPassword(log, w, r, pages, resp.NewError(http.StatusUnauthorized, resp.CodePasswordRequired, i18n.MsgPasswordRequired), pageData)
+
+		return false
+	}
+
+	key := data.Domain + "/" + data.Alias + "|" + clientIP(r)
+	if retry, blocked := guard.Blocked(key); blocked {
+		log.Warn("превышено число попыток ввода пароля", slog.String("key", key))
+
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+		renderPassword(log, w, r, pages, resp.NewError(http.StatusTooManyRequests, resp.CodeTooManyRequests, i18n.MsgTooManyAttempts), pageData)
+
+		return false
+	}
+
+	if !password.Verify(data.PasswordHash, secret) {
+		log.Info("неверный пароль ссылки", slog.String("alias", data.Alias))
+
+		guard.Fail(key)
+		renderPassword(log, w, r, pages, resp.NewError(http.StatusUnauthorized, resp.CodeInvalidPassword, i18n.MsgPasswordInvalid), pageData)
+
+		return false
+	}
+
+	guard.Reset(key)
+	http.SetCookie(w, guard.Cookie(data.Id, data.PasswordHash))
+
+	if form {
+		// браузер повторит запрос GET уже с cookie, обновление страницы не отправит пароль ещё раз
+		http.Redirect(w, r, r.URL.RequestURI(), http.StatusSeeOther)
+
+		return false
+	}
+
+	return true
+}
+
+// maxFormSize предел тела формы с паролем
+const maxFormSize = 4 << 10
+
+// renderPassword форма ввода пароля для браузера, JSON ошибка для остальных клиентов
+func renderPassword(log *slog.Logger, w http.ResponseWriter, r *http.Request, pages *pg.Renderer, apiErr *resp.APIError, data pg.Data) {
+	if pages == nil || !pg.WantsHTML(r) {
+		resp.Render(w, r, apiErr)
+
+		return
+	}
+
+	if apiErr.Code != resp.CodePasswordRequired {
+		data.Notice = apiErr.Key
+	}
+
+	if err := pages.Render(w, r, apiErr.HTTPStatus, pg.StatePassword, data); err != nil {
+		log.Error("не удалось отрисовать страницу", sl.Err(err))
+	}
+}
+
+// ruleRequest признаки запроса для правил, страна определяется только при подключённой базе GeoIP
+func ruleRequest(log *slog.Logger, r *http.Request, locator CountryLocator) rules.Request {
+	req := rules.Request{
+		Platform:  rules.Platform(r.UserAgent()),
+		Languages: rules.Languages(r.Header.Get("Accept-Language")),
+		Now:       time.Now(),
+	}
+
+	if locator == nil {
+		return req
+	}
+
+	if ip := net.ParseIP(clientIP(r)); ip != nil {
+		var err error
+		req.Country, err = locator.Country(ip)
+		if err != nil {
+			log.Error("не удалось определить страну", sl.Err(err))
+		}
+	}
+
+	return req
+}
+
+// clientIP адрес клиента: RemoteAddr уже заменён middleware.RealIP, порт может отсутствовать
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// variantCookieMaxAge срок, на который вариант закрепляется за браузером
+const variantCookieMaxAge = 30 * 24 * 60 * 60
+
+// pickVariant номер варианта A/B теста с учётом закрепления за посетителем. IP используется
+// только в виде хеша вместе с id ссылки, чтобы в разных тестах посетитель попадал в разные группы
+func pickVariant(w http.ResponseWriter, r *http.Request, data storage.URLData) int {
+	switch data.Sticky {
+	case variants.StickyCookie:
+		name := "ab_" + strconv.FormatInt(data.Id, 10)
+		if cookie, err := r.Cookie(name); err == nil {
+			if n, err := strconv.Atoi(cookie.Value); err == nil && n >= 0 && n < len(data.Variants) {
+				return n
+			}
+		}
+
+		n := variants.Pick(data.Variants, "")
+		http.SetCookie(w, &http.Cookie{
+			Name:     name,
+			Value:    strconv.Itoa(n),
+			Path:     "/",
+			MaxAge:   variantCookieMaxAge,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+
+		return n
+	case variants.StickyIP:
+		sum := sha256.Sum256([]byte(strconv.FormatInt(data.Id, 10) + "|" + clientIP(r)))
+
+		return variants.Pick(data.Variants, hex.EncodeToString(sum[:]))
+	default:
+		return variants.Pick(data.Variants, "")
+	}
+}
+
+// splitPath алиас и оставшийся путь из исходного URL запроса. Маршрут /* отдаёт путь целиком и уже
+// раскодированным, а экранированный / внутри пути должен остаться частью остатка, поэтому путь
+// разбирается по EscapedPath. Оставшийся путь возвращается в экранированном виде, чтобы передать его дальше без изменений
+func splitPath(u *url.URL) (string, string, error) {
+	escapedAlias, rest, found := strings.Cut(strings.TrimPrefix(u.EscapedPath(), "/"), "/")
+
+	alias, err := url.PathUnescape(escapedAlias)
+	if err != nil {
+		return "", "", err
+	}
+
+	if found {
+		rest = "/" + rest
+	}
+
+	return alias, rest, nil
+}
+
+// destination адрес назначения с учётом проброса пути и query. При совпадении параметров
+// приоритет у адреса назначения, чтобы нельзя было подменить заданные в ссылке метки
+func destination(data storage.URLData, rest string, rawQuery string) (string, error) {
+	if (!data.ForwardPath || rest == "") && (!data.ForwardQuery || rawQuery == "") {
+		return data.Url, nil
+	}
+
+	target, err := url.Parse(data.Url)
+	if err != nil {
+		return data.Url, err
+	}
+
+	if data.ForwardPath && rest != "" && rest != "/" {
+		target = target.JoinPath(rest)
+	}
+
+	if data.ForwardQuery && rawQuery != "" {
+		incoming, err := url.ParseQuery(rawQuery)
+		if err != nil {
+			return data.Url, err
+		}
+
+		query := target.Query()
+		for key, values := range incoming {
+			if _, ok := query[key]; !ok {
+				query[key] = values
+			}
+		}
+		target.RawQuery = query.Encode()
+	}
+
+	return target.String(), nil
+}
+
+// redirectStatus код редиректа ссылки, неизвестные значения считаются 302
+func redirectStatus(redirectType int) int {
+	switch redirectType {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return redirectType
+	default:
+		return storage.DefaultRedirectType
+	}
+}
+
+// renderPreview страница с адресом назначения для браузера, данные ссылки для остальных клиентов
+func renderPreview(log *slog.Logger, w http.ResponseWriter, r *http.Request, pages *pg.Renderer, l *link.Link) {
+	if pages == nil || !pg.WantsHTML(r) {
+		render.JSON(w, r, Response{
+			Response: resp.OK(),
+			Link:     l,
+		})
+
+		return
+	}
+
+	err := pages.Render(w, r, http.StatusOK, pg.StatePreview, pg.Data{
+		Alias:    l.Alias,
+		ShortURL: l.ShortURL,
+		URL:      l.URL,
+	})
+	if err != nil {
+		log.Error("не удалось отрисовать страницу", sl.Err(err))
+	}
+}
+
+// renderError HTML страница для браузера, JSON для остальных клиентов
+func renderError(log *slog.Logger, w http.ResponseWriter, r *http.Request, pages *pg.Renderer, apiErr *resp.APIError, data pg.Data) {
+	if pages == nil || !pg.WantsHTML(r) {
+		resp.Render(w, r, apiErr)
+
+		return
+	}
+
+	state := pg.StateNotFound
+	switch apiErr.Code {
+	case resp.CodeURLExpired:
+		state = pg.StateExpired
+	case resp.CodeURLDeleted:
+		state = pg.StateDisabled
+	case resp.CodeURLUnsafe:
+		state = pg.StateMalware
+	}
 
-		http.Redirect(w, r, resURL, http.StatusFound)
+	if err := pages.Render(w, r, apiErr.HTTPStatus, state, data); err != nil {
+		log.Error("не удалось отрисовать страницу", sl.Err(err))
 	}
 }
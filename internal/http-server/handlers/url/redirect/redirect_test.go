@@ -0,0 +1,441 @@
+package redirect_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"url-shoter/internal/http-server/handlers/url/redirect"
+	"url-shoter/internal/http-server/handlers/url/redirect/mocks"
+	resp "url-shoter/internal/lib/api/response"
+	"url-shoter/internal/lib/blocklist"
+	"url-shoter/internal/lib/domains"
+	"url-shoter/internal/lib/logger/handlers/slogdiscard"
+	"url-shoter/internal/lib/pages"
+	"url-shoter/internal/lib/password"
+	"url-shoter/internal/lib/rules"
+	"url-shoter/internal/lib/variants"
+	"url-shoter/internal/storage"
+)
+
+var appRules = []rules.Rule{
+	{URL: "https://apps.apple.com/app", Platforms: []string{rules.PlatformIOS}},
+	{URL: "https://play.google.com/app", Platforms: []string{rules.PlatformAndroid}},
+}
+
+func testGuard() *password.Guard {
+	return password.NewGuard([]byte("test"), time.Hour, 2, time.Minute)
+}
+
+func TestRedirectHandler(t *testing.T) {
+	cases := []struct {
+		name       string
+		alias      string
+		path       string
+		accept     string
+		userAgent  string
+		data       storage.URLData
+		mockError  error
+		wantStatus int
+		wantCode   resp.Code
+		wantHTML   string
+		wantLink   bool
+
+		wantLocation string
+	}{
+		{
+			name:       "Success",
+			alias:      "ok",
+			data:       storage.URLData{Url: "https://google.com"},
+			wantStatus: http.StatusFound,
+		},
+		{
+			name:       "Permanent",
+			alias:      "seo",
+			data:       storage.URLData{Url: "https://google.com", Options: storage.Options{RedirectType: 301}},
+			wantStatus: http.StatusMovedPermanently,
+		},
+		{
+			name:       "Temporary keeps method",
+			alias:      "post",
+			data:       storage.URLData{Url: "https://google.com", Options: storage.Options{RedirectType: 307}},
+			wantStatus: http.StatusTemporaryRedirect,
+		},
+		{
+			name:       "Preview suffix JSON",
+			alias:      "ok",
+			path:       "/ok+",
+			data:       storage.URLData{Alias: "ok", Url: "https://google.com"},
+			wantStatus: http.StatusOK,
+			wantLink:   true,
+		},
+		{
+			name:       "Preview flag browser",
+			alias:      "careful",
+			accept:     "text/html",
+			data:       storage.URLData{Alias: "careful", Url: "https://google.com/very/long", Options: storage.Options{Preview: true}},
+			wantStatus: http.StatusOK,
+			wantHTML:   "https://google.com/very/long",
+		},
+		{
+			name:       "Alias with extension",
+			alias:      "report.pdf",
+			data:       storage.URLData{Url: "https://google.com/report"},
+			wantStatus: http.StatusFound,
+		},
+		{
+			name:         "Forward query",
+			alias:        "camp",
+			path:         "/camp?ref=x&utm_source=evil",
+			data:         storage.URLData{Url: "https://google.com/?utm_source=mail", Options: storage.Options{ForwardQuery: true}},
+			wantStatus:   http.StatusFound,
+			wantLocation: "https://google.com/?ref=x&utm_source=mail",
+		},
+		{
+			name:         "Query not forwarded",
+			alias:        "camp",
+			path:         "/camp?ref=x",
+			data:         storage.URLData{Url: "https://google.com/?utm_source=mail"},
+			wantStatus:   http.StatusFound,
+			wantLocation: "https://google.com/?utm_source=mail",
+		},
+		{
+			name:         "Forward path",
+			alias:        "docs",
+			path:         "/docs/guide/intro%20page?x=1",
+			data:         storage.URLData{Url: "https://go.dev/doc", Options: storage.Options{ForwardPath: true, ForwardQuery: true}},
+			wantStatus:   http.StatusFound,
+			wantLocation: "https://go.dev/doc/guide/intro%20page?x=1",
+		},
+		{
+			name:       "Path not forwarded",
+			alias:      "docs",
+			path:       "/docs/guide",
+			data:       storage.URLData{Url: "https://go.dev/doc"},
+			wantStatus: http.StatusNotFound,
+			wantCode:   resp.CodeNotFound,
+		},
+		{
+			name:       "Not found JSON",
+			alias:      "missing",
+			mockError:  storage.ErrURLNotFound,
+			wantStatus: http.StatusNotFound,
+			wantCode:   resp.CodeURLNotFound,
+		},
+		{
+			name:       "Not found browser",
+			alias:      "missing",
+			accept:     "text/html,application/xhtml+xml,*/*;q=0.8",
+			mockError:  storage.ErrURLNotFound,
+			wantStatus: http.StatusNotFound,
+			wantHTML:   "Ссылка не найдена",
+		},
+		{
+			name:       "Expired JSON",
+			alias:      "old",
+			accept:     "application/json",
+			mockError:  storage.ErrURLExpired,
+			wantStatus: http.StatusGone,
+			wantCode:   resp.CodeURLExpired,
+		},
+		{
+			name:       "Expired browser",
+			alias:      "old",
+			accept:     "text/html",
+			mockError:  storage.ErrURLExpired,
+			wantStatus: http.StatusGone,
+			wantHTML:   "Срок действия ссылки истёк",
+		},
+		{
+			name:       "Deleted JSON",
+			alias:      "gone",
+			accept:     "application/json",
+			mockError:  storage.ErrURLDeleted,
+			wantStatus: http.StatusGone,
+			wantCode:   resp.CodeURLDeleted,
+		},
+		{
+			name:       "Deleted browser",
+			alias:      "gone",
+			accept:     "text/html",
+			mockError:  storage.ErrURLDeleted,
+			wantStatus: http.StatusGone,
+			wantHTML:   "Ссылка отключена",
+		},
+		{
+			name:         "Rule by platform",
+			alias:        "app",
+			userAgent:    "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X)",
+			data:         storage.URLData{Url: "https://example.com", Options: storage.Options{Rules: appRules}},
+			wantStatus:   http.StatusFound,
+			wantLocation: "https://apps.apple.com/app",
+		},
+		{
+			name:       "Unsafe JSON",
+			alias:      "bad",
+			data:       storage.URLData{Url: "https://evil.example/login"},
+			wantStatus: http.StatusForbidden,
+			wantCode:   resp.CodeURLUnsafe,
+		},
+		{
+			name:       "Unsafe browser",
+			alias:      "bad",
+			accept:     "text/html",
+			data:       storage.URLData{Url: "https://cdn.evil.example/login"},
+			wantStatus: http.StatusForbidden,
+			wantHTML:   "https://cdn.evil.example/login",
+		},
+		{
+			name:       "Unsafe preview",
+			alias:      "bad",
+			path:       "/bad+",
+			data:       storage.URLData{Url: "https://evil.example"},
+			wantStatus: http.StatusForbidden,
+			wantCode:   resp.CodeURLUnsafe,
+		},
+		{
+			name:       "Unsafe rule target",
+			alias:      "app",
+			userAgent:  "Mozilla/5.0 (Linux; Android 14)",
+			data:       storage.URLData{Url: "https://example.com", Options: storage.Options{Rules: []rules.Rule{{URL: "https://evil.example/apk", Platforms: []string{rules.PlatformAndroid}}}}},
+			wantStatus: http.StatusForbidden,
+			wantCode:   resp.CodeURLUnsafe,
+		},
+		{
+			name:         "Rule fallback",
+			alias:        "app",
+			userAgent:    "Mozilla/5.0 (Windows NT 10.0; Win64; x64)",
+			data:         storage.URLData{Url: "https://example.com", Options: storage.Options{Rules: appRules}},
+			wantStatus:   http.StatusFound,
+			wantLocation: "https://example.com",
+		},
+	}
+
+	resolver, err := domains.New("", "sho.rt", nil, "https")
+	require.NoError(t, err)
+	errorPages, err := pages.New("")
+	require.NoError(t, err)
+	unsafe := blocklist.New([]string{"evil.example"})
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			getter := mocks.NewURLGetter(t)
+			getter.On("GetRedirect", "", tc.alias).Return(tc.data, tc.mockError).Once()
+			counter := mocks.NewClickCounter(t)
+			if tc.wantCode != resp.CodeURLUnsafe {
+				counter.On("RecordClick", tc.data.Id, -1).Return(nil).Maybe()
+			}
+
+			router := chi.NewRouter()
+			router.Get("/*", redirect.New(slogdiscard.NewDiscardLogger(), getter, counter, resolver, errorPages, nil, unsafe, testGuard()))
+
+			path := tc.path
+			if path == "" {
+				path = "/" + tc.alias
+			}
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			req.Host = "sho.rt"
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+			if tc.userAgent != "" {
+				req.Header.Set("User-Agent", tc.userAgent)
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.wantStatus, rr.Code)
+
+			switch {
+			case tc.wantHTML != "":
+				assert.Contains(t, rr.Header().Get("Content-Type"), "text/html")
+				assert.Contains(t, rr.Body.String(), tc.wantHTML)
+			case tc.wantLink:
+				var body redirect.Response
+				require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+				assert.Equal(t, tc.data.Url, body.URL)
+				assert.Equal(t, "https://sho.rt/"+tc.alias, body.ShortURL)
+			case tc.wantLocation != "":
+				assert.Equal(t, tc.wantLocation, rr.Header().Get("Location"))
+			case tc.mockError == nil && tc.wantCode == "":
+				assert.Equal(t, tc.data.Url, rr.Header().Get("Location"))
+			default:
+				var body resp.Response
+				require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+				assert.Equal(t, tc.wantCode, body.Code)
+			}
+		})
+	}
+}
+
+func TestRedirectVariants(t *testing.T) {
+	abVariants := []variants.Variant{
+		{URL: "https://a.example.com", Weight: 1},
+		{URL: "https://b.example.com", Weight: 1},
+	}
+
+	cases := []struct {
+		name        string
+		sticky      string
+		cookie      *http.Cookie
+		wantVariant int
+		wantCookie  bool
+	}{
+		{
+			name:        "Cookie keeps variant",
+			sticky:      variants.StickyCookie,
+			cookie:      &http.Cookie{Name: "ab_7", Value: "1"},
+			wantVariant: 1,
+		},
+		{
+			name:        "Cookie out of range",
+			sticky:      variants.StickyCookie,
+			cookie:      &http.Cookie{Name: "ab_7", Value: "5"},
+			wantVariant: -1,
+			wantCookie:  true,
+		},
+		{
+			name:        "Random",
+			wantVariant: -1,
+		},
+	}
+
+	resolver, err := domains.New("", "sho.rt", nil, "https")
+	require.NoError(t, err)
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			data := storage.URLData{Id: 7, Url: "https://example.com", Options: storage.Options{Variants: abVariants, Sticky: tc.sticky}}
+
+			getter := mocks.NewURLGetter(t)
+			getter.On("GetRedirect", "", "ab").Return(data, nil).Once()
+
+			var recorded int
+			counter := mocks.NewClickCounter(t)
+			counter.On("RecordClick", int64(7), mock.AnythingOfType("int")).
+				Run(func(args mock.Arguments) { recorded = args.Int(1) }).
+				Return(nil).Once()
+
+			handler := redirect.New(slogdiscard.NewDiscardLogger(), getter, counter, resolver, nil, nil, nil, testGuard())
+
+			req := httptest.NewRequest(http.MethodGet, "/ab", nil)
+			req.Host = "sho.rt"
+			if tc.cookie != nil {
+				req.AddCookie(tc.cookie)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, http.StatusFound, rr.Code)
+			require.True(t, recorded == 0 || recorded == 1)
+			assert.Equal(t, abVariants[recorded].URL, rr.Header().Get("Location"))
+			if tc.wantVariant >= 0 {
+				assert.Equal(t, tc.wantVariant, recorded)
+			}
+			if tc.wantCookie {
+				assert.Contains(t, rr.Header().Get("Set-Cookie"), "ab_7=")
+			}
+		})
+	}
+}
+
+func TestRedirectPassword(t *testing.T) {
+	hash, err := password.Hash("s3cret")
+	require.NoError(t, err)
+	data := storage.URLData{Id: 3, Alias: "doc", Url: "https://docs.example.com", Options: storage.Options{PasswordHash: hash}}
+
+	resolver, err := domains.New("", "sho.rt", nil, "https")
+	require.NoError(t, err)
+	errorPages, err := pages.New("")
+	require.NoError(t, err)
+
+	guard := testGuard()
+
+	getter := mocks.NewURLGetter(t)
+	getter.On("GetRedirect", "", "doc").Return(data, nil)
+	counter := mocks.NewClickCounter(t)
+	counter.On("RecordClick", int64(3), -1).Return(nil).Maybe()
+
+	router := chi.NewRouter()
+	handler := redirect.New(slogdiscard.NewDiscardLogger(), getter, counter, resolver, errorPages, nil, nil, guard)
+	router.Get("/*", handler)
+	router.Post("/*", handler)
+
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		req.Host = "sho.rt"
+		req.RemoteAddr = "203.0.113.7:5000"
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	code := func(rr *httptest.ResponseRecorder) resp.Code {
+		var body resp.Response
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+		return body.Code
+	}
+
+	t.Run("Password required", func(t *testing.T) {
+		rr := serve(httptest.NewRequest(http.MethodGet, "/doc", nil))
+		require.Equal(t, http.StatusUnauthorized, rr.Code)
+		assert.Equal(t, resp.CodePasswordRequired, code(rr))
+	})
+
+	t.Run("Browser gets form", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/doc", nil)
+		req.Header.Set("Accept", "text/html")
+		rr := serve(req)
+		require.Equal(t, http.StatusUnauthorized, rr.Code)
+		assert.Contains(t, rr.Body.String(), `<form method="post">`)
+	})
+
+	t.Run("Header and cookie", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/doc", nil)
+		req.Header.Set(password.HeaderName, "s3cret")
+		rr := serve(req)
+		require.Equal(t, http.StatusFound, rr.Code)
+		assert.Equal(t, data.Url, rr.Header().Get("Location"))
+
+		cookies := rr.Result().Cookies()
+		require.Len(t, cookies, 1)
+
+		req = httptest.NewRequest(http.MethodGet, "/doc", nil)
+		req.AddCookie(cookies[0])
+		rr = serve(req)
+		require.Equal(t, http.StatusFound, rr.Code)
+	})
+
+	t.Run("Form", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/doc?ref=mail", strings.NewReader(url.Values{"password": {"s3cret"}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := serve(req)
+		require.Equal(t, http.StatusSeeOther, rr.Code)
+		assert.Equal(t, "/doc?ref=mail", rr.Header().Get("Location"))
+		assert.NotEmpty(t, rr.Result().Cookies())
+	})
+
+	t.Run("Wrong password is limited", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			req := httptest.NewRequest(http.MethodGet, "/doc", nil)
+			req.Header.Set(password.HeaderName, "wrong")
+			rr := serve(req)
+			require.Equal(t, http.StatusUnauthorized, rr.Code)
+			assert.Equal(t, resp.CodeInvalidPassword, code(rr))
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/doc", nil)
+		req.Header.Set(password.HeaderName, "s3cret")
+		rr := serve(req)
+		require.Equal(t, http.StatusTooManyRequests, rr.Code)
+		assert.Equal(t, resp.CodeTooManyRequests, code(rr))
+		assert.NotEmpty(t, rr.Header().Get("Retry-After"))
+	})
+}
@@ -2,38 +2,117 @@ package save
 
 import (
 	"errors"
+	"fmt"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/render"
 	"github.com/go-playground/validator/v10"
 	"log/slog"
 	"net/http"
+	"time"
+	"url-shoter/internal/lib/aliasfilter"
+	"url-shoter/internal/lib/api/link"
 	resp "url-shoter/internal/lib/api/response"
+	"url-shoter/internal/lib/audit"
+	"url-shoter/internal/lib/domains"
+	"url-shoter/internal/lib/i18n"
 	"url-shoter/internal/lib/logger/sl"
+	"url-shoter/internal/lib/password"
 	"url-shoter/internal/lib/random"
+	"url-shoter/internal/lib/rules"
+	"url-shoter/internal/lib/utm"
+	"url-shoter/internal/lib/variants"
 	"url-shoter/internal/storage"
 )
 
 type Request struct {
-	URL   string `json:"url" validate:"required,url"`
-	Alias string `json:"alias,omitempty"`
-	ID    int64  `json:"id,omitempty"`
+	URL       string     `json:"url" validate:"required,http_url"`
+	Alias     string     `json:"alias,omitempty"`
+	ID        int64      `json:"id,omitempty"`
+	Domain    string     `json:"domain,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+	RedirectType int  `json:"redirect_type,omitempty" validate:"omitempty,oneof=301 302 307 308"`
+	Preview      bool `json:"preview,omitempty"`
+	ForwardQuery bool `json:"forward_query,omitempty"`
+	ForwardPath  bool `json:"forward_path,omitempty"`
+
+	UTM   *utm.Params  `json:"utm,omitempty"`                          // метки добавляются к url при сохранении
+	Rules []rules.Rule `json:"rules,omitempty" validate:"max=20,dive"` // условные адреса, url - адрес по умолчанию
+
+	Variants []variants.Variant `json:"variants,omitempty" validate:"max=10,dive"`             // адреса A/B теста вместо url
+	Sticky   string             `json:"sticky,omitempty" validate:"omitempty,oneof=cookie ip"` // закрепление варианта
+
+	Password string `json:"password,omitempty" validate:"omitempty,min=4,max=72"` // хранится только bcrypt хеш, длина в байтах проверяется отдельно
+}
+
+/*
+LogValue запрос для логов без пароля
+*/
+func (r Request) LogValue() slog.Value {
+	type plain Request
+	if r.Password != "" {
+		r.Password = "***"
+	}
+	return slog.AnyValue(plain(r))
+}
+
+/*
+Destination адрес назначения с UTM метками из запроса
+*/
+func (r Request) Destination() (string, error) {
+	if r.UTM == nil {
+		return r.URL, nil
+	}
+	return utm.Apply(r.URL, *r.UTM)
+}
+
+/*
+Options поведение ссылки при переходе из запроса, пароль заменяется хешем
+*/
+func (r Request) Options() (storage.Options, error) {
+	opts := storage.Options{
+		RedirectType: r.RedirectType,
+		Preview:      r.Preview,
+		ForwardQuery: r.ForwardQuery,
+		ForwardPath:  r.ForwardPath,
+		Rules:        r.Rules,
+		Variants:     r.Variants,
+		Sticky:       r.Sticky,
+	}
+
+	if r.Password != "" {
+		hash, err := password.Hash(r.Password)
+		if err != nil {
+			return opts, fmt.Errorf("не удалось захешировать пароль: %w", err)
+		}
+		opts.PasswordHash = hash
+	}
+
+	return opts, nil
 }
 
 type Response struct {
 	resp.Response
-	Alias string `json:"alias,omitempty"`
+	*link.Link
 }
 
 type URLSaver interface {
-	SaveUrl(urlToSave string, alias string, id *int64) (int64, error)
-	ExistUrlByAlias(alias string) (bool, error)
+	SaveUrl(urlToSave string, domain string, alias string, id *int64, expiresAt *time.Time, opts storage.Options,
+		trail *audit.Trail) (int64, error)
+	ExistUrlByAlias(domain string, alias string) (bool, error)
+	GetUrlDataById(id int64) (storage.URLData, error)
 }
 
-func New(log *slog.Logger, urlSaver URLSaver, aliasLength int64) http.HandlerFunc {
+/*
+New создание короткой ссылки. Свой и сгенерированный алиас проверяются фильтром filter, nil - без фильтра.
+Созданная ссылка записывается в журнал аудита auditor в транзакции сохранения
+*/
+func New(log *slog.Logger, urlSaver URLSaver, aliasLength int64, resolver *domains.Resolver, filter *aliasfilter.Filter,
+	auditor *audit.Logger) http.HandlerFunc {
 	const op = "internal.http.handlers.url.save.New"
 
 	return func(w http.ResponseWriter, r *http.Request) {
-		log = log.With(
+		log := log.With(
 			slog.String("op", op),
 			slog.String("request_id", middleware.GetReqID(r.Context())),
 		)
@@ -44,7 +123,7 @@ func New(log *slog.Logger, urlSaver URLSaver, aliasLength int64) http.HandlerFun
 		if err != nil {
 			log.Error("Не удалось расшифровать тело запроса", sl.Err(err))
 
-			render.JSON(w, r, resp.Error("не удалось расшифровать запрос"))
+			resp.Render(w, r, resp.BadRequest(resp.CodeInvalidJSON, i18n.MsgInvalidJSON))
 
 			return
 		}
@@ -56,20 +135,84 @@ func New(log *slog.Logger, urlSaver URLSaver, aliasLength int64) http.HandlerFun
 			errors.As(err, &validateErr)
 			log.Error("invalid request", sl.Err(err))
 
-			render.JSON(w, r, resp.ValidationError(validateErr))
+			resp.Render(w, r, resp.Validation(validateErr))
+
+			return
+		}
+
+		if password.TooLong(req.Password) {
+			log.Info("пароль длиннее предела bcrypt", slog.Int("bytes", len(req.Password)))
+
+			resp.Render(w, r, resp.BadRequest(resp.CodeValidation, i18n.MsgPasswordTooLong, password.MaxBytes))
+
+			return
+		}
+
+		if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+			log.Info("срок жизни ссылки в прошлом", slog.Time("expires_at", *req.ExpiresAt))
+
+			resp.Render(w, r, resp.Unprocessable(resp.CodeInvalidExpiry, i18n.MsgExpiryInPast))
+
+			return
+		}
+
+		req.URL, err = req.Destination()
+		if err != nil {
+			log.Info("не удалось добавить UTM метки", sl.Err(err))
+
+			resp.Render(w, r, resp.Unprocessable(resp.CodeValidation, i18n.MsgFieldURL, "URL"))
+
+			return
+		}
+
+		domain, err := resolver.Key(req.Domain)
+		if err != nil {
+			log.Info("домен не разрешён", slog.String("domain", req.Domain))
+
+			resp.Render(w, r, resp.Unprocessable(resp.CodeDomainNotAllowed, i18n.MsgDomainNotAllowed))
 
 			return
 		}
 
 		alias := req.Alias
 		if alias == "" {
-			alias = random.NewRandomString(aliasLength)
+			alias, err = filter.Generate(func() string { return random.NewRandomStringFrom(aliasLength, filter.Alphabet()) })
+			if err != nil {
+				log.Error("не удалось сгенерировать alias", sl.Err(err))
+
+				resp.Render(w, r, resp.Internal(i18n.MsgCreateFailed, err))
+
+				return
+			}
+		} else if alias, err = filter.Check(alias); err != nil {
+			log.Info("alias не прошёл проверку", slog.String("alias", alias), sl.Err(err))
+
+			responseError(w, r, alias, resp.InvalidAlias(err))
+
+			return
 		}
 
-		isSetAlias, err := urlSaver.ExistUrlByAlias(alias)
-		if isSetAlias || err != nil {
-			log.Info("Не удалось сохранить url, Alias: ", alias, " уже существует")
-			responseError(w, r, alias, "alias already exists")
+		isSetAlias, err := urlSaver.ExistUrlByAlias(domain, alias)
+		if err != nil {
+			log.Error("не удалось проверить alias", sl.Err(err))
+
+			responseError(w, r, alias, resp.FromStorage(err, i18n.MsgCreateFailed))
+
+			return
+		}
+		if isSetAlias {
+			log.Info("alias уже существует", slog.String("alias", alias))
+
+			responseError(w, r, alias, resp.FromStorage(storage.ErrAliasExists, i18n.MsgAliasExists))
+
+			return
+		}
+
+		opts, err := req.Options()
+		if err != nil {
+			log.Error("не удалось подготовить параметры ссылки", sl.Err(err))
+
+			resp.Render(w, r, resp.Internal(i18n.MsgCreateFailed, err))
 
 			return
 		}
@@ -77,42 +220,57 @@ func New(log *slog.Logger, urlSaver URLSaver, aliasLength int64) http.HandlerFun
 		var id int64
 
 		if req.ID != 0 {
-			id, err = urlSaver.SaveUrl(req.URL, alias, &req.ID)
+			id, err = urlSaver.SaveUrl(req.URL, domain, alias, &req.ID, req.ExpiresAt, opts, auditor.Trail(r))
 		} else {
-			id, err = urlSaver.SaveUrl(req.URL, alias, nil)
+			id, err = urlSaver.SaveUrl(req.URL, domain, alias, nil, req.ExpiresAt, opts, auditor.Trail(r))
 		}
 
 		if errors.Is(err, storage.ErrURLExists) {
 			log.Info("URL уже существует", slog.String("url", req.URL))
 
-			responseError(w, r, alias, "url уже существует")
+			msg := i18n.MsgURLExists
+			if errors.Is(err, storage.ErrAliasExists) {
+				msg = i18n.MsgAliasExists
+			}
+			responseError(w, r, alias, resp.FromStorage(err, msg))
 
 			return
 		}
 		if err != nil {
 			log.Error("не удалось создать URL", sl.Err(err))
 
-			render.JSON(w, r, resp.Error("не удалось создать URL"))
+			resp.Render(w, r, resp.Internal(i18n.MsgCreateFailed, err))
 
 			return
 		}
 
 		log.Info("добавлен url", slog.Int64("id", id))
 
-		responseOk(w, r, alias)
+		data, err := urlSaver.GetUrlDataById(id)
+		if err != nil {
+			// ссылка уже сохранена, отвечаем тем что известно без даты создания
+			log.Error("не удалось прочитать сохранённый URL", sl.Err(err))
+			data = storage.URLData{Id: id, Alias: alias, Url: req.URL, Domain: domain, ExpiresAt: req.ExpiresAt,
+				Campaign: utm.Campaign(req.URL), Options: opts.Normalize()}
+		}
+
+		responseCreated(w, r, link.New(data, resolver))
 	}
 }
 
-func responseOk(w http.ResponseWriter, r *http.Request, alias string) {
+func responseCreated(w http.ResponseWriter, r *http.Request, l *link.Link) {
+	w.Header().Set("Location", l.ShortURL)
+	render.Status(r, http.StatusCreated)
+
 	render.JSON(w, r, Response{
 		Response: resp.OK(),
-		Alias:    alias,
+		Link:     l,
 	})
 }
 
-func responseError(w http.ResponseWriter, r *http.Request, alias string, error string) {
-	render.JSON(w, r, Response{
-		Response: resp.Error(error),
-		Alias:    alias,
+func responseError(w http.ResponseWriter, r *http.Request, alias string, apiErr *resp.APIError) {
+	resp.RenderWith(w, r, apiErr, Response{
+		Response: resp.Fail(r, apiErr),
+		Link:     &link.Link{Alias: alias},
 	})
 }
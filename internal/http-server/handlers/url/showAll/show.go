@@ -4,41 +4,48 @@ import (
 	"github.com/go-chi/render"
 	"log/slog"
 	"net/http"
+	"url-shoter/internal/lib/api/link"
 	resp "url-shoter/internal/lib/api/response"
-	"url-shoter/internal/storage/pgsql"
+	"url-shoter/internal/lib/domains"
+	"url-shoter/internal/lib/i18n"
+	"url-shoter/internal/lib/logger/sl"
+	"url-shoter/internal/storage"
 )
 
 type URLsViewer interface {
-	CheckAllUrls() (pgsql.URLData, error)
+	ListUrls(filter storage.ListFilter) ([]storage.URLData, error)
 }
 
 type Response struct {
 	resp.Response
-	List  []pgsql.URLData `json:"list,omitempty"`
-	Count int             `json:"count,omitempty"`
+	List  []*link.Link `json:"list,omitempty"`
+	Count int          `json:"count,omitempty"`
 }
 
-func New(log *slog.Logger, viewer *pgsql.Storage) http.HandlerFunc {
+func New(log *slog.Logger, viewer URLsViewer, resolver *domains.Resolver) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "internal.http.handlers.url.showAll.New"
 
-		log = log.With(
+		log := log.With(
 			slog.String("op", op),
 		)
 
-		urls, err := showAllUrls(w, r, viewer)
+		urls, err := showAllUrls(w, r, viewer, storage.ListFilter{Campaign: r.URL.Query().Get("campaign")})
 		if err != nil {
-			responseErr(w, r)
+			log.Error("не удалось получить список урлов", sl.Err(err))
+			resp.Render(w, r, resp.Internal(i18n.MsgListFailed, err))
+
+			return
 		}
 
-		responseOk(w, r, urls)
+		responseOk(w, r, urls, resolver)
 	}
 }
 
-func showAllUrls(w http.ResponseWriter, r *http.Request, viewer *pgsql.Storage) ([]pgsql.URLData, error) {
+func showAllUrls(w http.ResponseWriter, r *http.Request, viewer URLsViewer, filter storage.ListFilter) ([]storage.URLData, error) {
 	const op = "internal.http.handlers.url.showAll.showAllUrls"
 
-	urls, err := viewer.CheckAllUrls()
+	urls, err := viewer.ListUrls(filter)
 	if err != nil {
 		slog.String("%s, Данные по урлам не обнаружены", op)
 		return nil, err
@@ -48,15 +55,11 @@ func showAllUrls(w http.ResponseWriter, r *http.Request, viewer *pgsql.Storage)
 
 }
 
-func responseOk(w http.ResponseWriter, r *http.Request, data []pgsql.URLData) {
+func responseOk(w http.ResponseWriter, r *http.Request, data []storage.URLData, resolver *domains.Resolver) {
 
-	var urlDataList []pgsql.URLData
+	var urlDataList []*link.Link
 	for _, i := range data {
-		urlDataList = append(urlDataList, pgsql.URLData{
-			Id:    i.Id,
-			Alias: i.Alias,
-			Url:   i.Url,
-		})
+		urlDataList = append(urlDataList, link.New(i, resolver))
 	}
 
 	render.JSON(w, r, Response{
@@ -65,11 +68,3 @@ func responseOk(w http.ResponseWriter, r *http.Request, data []pgsql.URLData) {
 		Count:    len(urlDataList),
 	})
 }
-
-func responseErr(w http.ResponseWriter, r *http.Request) {
-	render.JSON(w, r, Response{
-		Response: resp.Error("Данные по урлам не обнаружены"),
-		List:     nil,
-		Count:    0,
-	})
-}
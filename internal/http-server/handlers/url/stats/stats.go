@@ -0,0 +1,53 @@
+package stats
+
+import (
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"log/slog"
+	"net/http"
+	resp "url-shoter/internal/lib/api/response"
+	"url-shoter/internal/lib/i18n"
+	"url-shoter/internal/lib/logger/sl"
+	"url-shoter/internal/storage"
+)
+
+type StatsGetter interface {
+	CampaignStats(campaign string) ([]storage.CampaignStat, error)
+}
+
+type Response struct {
+	resp.Response
+	Campaigns []storage.CampaignStat `json:"campaigns"`
+}
+
+/*
+New сводка ссылок и переходов по кампаниям, ?campaign= ограничивает одной кампанией
+*/
+func New(log *slog.Logger, getter StatsGetter) http.HandlerFunc {
+	const op = "internal.http.handlers.url.stats.New"
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		campaigns, err := getter.CampaignStats(r.URL.Query().Get("campaign"))
+		if err != nil {
+			log.Error("не удалось получить статистику", sl.Err(err))
+
+			resp.Render(w, r, resp.Internal(i18n.MsgStatsFailed, err))
+
+			return
+		}
+
+		if campaigns == nil {
+			campaigns = []storage.CampaignStat{}
+		}
+
+		render.JSON(w, r, Response{
+			Response:  resp.OK(),
+			Campaigns: campaigns,
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package stats
+
+import (
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"log/slog"
+	"net/http"
+	"strconv"
+	resp "url-shoter/internal/lib/api/response"
+	"url-shoter/internal/lib/i18n"
+	"url-shoter/internal/lib/logger/sl"
+	"url-shoter/internal/storage"
+)
+
+type VariantStatsGetter interface {
+	VariantStats(id int64) ([]storage.VariantStat, error)
+}
+
+type VariantsResponse struct {
+	resp.Response
+	Variants []storage.VariantStat `json:"variants"`
+}
+
+/*
+NewVariants переходы по вариантам A/B теста ссылки с id из пути
+*/
+func NewVariants(log *slog.Logger, getter VariantStatsGetter) http.HandlerFunc {
+	const op = "internal.http.handlers.url.stats.NewVariants"
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			log.Info("некорректный id", sl.Err(err))
+
+			resp.Render(w, r, resp.BadRequest(resp.CodeInvalidID, i18n.MsgInvalidID))
+
+			return
+		}
+
+		stats, err := getter.VariantStats(id)
+		if errors.Is(err, storage.ErrURLNotFound) {
+			log.Info("ссылка не найдена", slog.Int64("id", id))
+
+			resp.Render(w, r, resp.FromStorage(err, i18n.MsgIDNotFound))
+
+			return
+		}
+		if err != nil {
+			log.Error("не удалось получить статистику вариантов", sl.Err(err))
+
+			resp.Render(w, r, resp.Internal(i18n.MsgStatsFailed, err))
+
+			return
+		}
+
+		render.JSON(w, r, VariantsResponse{
+			Response: resp.OK(),
+			Variants: stats,
+		})
+	}
+}
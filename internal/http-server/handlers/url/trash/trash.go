@@ -0,0 +1,110 @@
+package trash
+
+import (
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"url-shoter/internal/lib/api/link"
+	resp "url-shoter/internal/lib/api/response"
+	"url-shoter/internal/lib/audit"
+	"url-shoter/internal/lib/domains"
+	"url-shoter/internal/lib/i18n"
+	"url-shoter/internal/lib/logger/sl"
+	"url-shoter/internal/storage"
+)
+
+type TrashLister interface {
+	ListUrls(filter storage.ListFilter) ([]storage.URLData, error)
+}
+
+type Restorer interface {
+	RestoreById(id int64, trail *audit.Trail) error
+}
+
+type Response struct {
+	resp.Response
+	List  []*link.Link `json:"list"`
+	Count int          `json:"count"`
+}
+
+/*
+List ссылки в корзине, начиная с последних удалённых, ?campaign= отбирает ссылки кампании
+*/
+func List(log *slog.Logger, lister TrashLister, resolver *domains.Resolver) http.HandlerFunc {
+	const op = "internal.http.handlers.url.trash.List"
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		urls, err := lister.ListUrls(storage.ListFilter{Campaign: r.URL.Query().Get("campaign"), Deleted: true})
+		if err != nil {
+			log.Error("не удалось получить корзину", sl.Err(err))
+
+			resp.Render(w, r, resp.Internal(i18n.MsgListFailed, err))
+
+			return
+		}
+
+		list := make([]*link.Link, 0, len(urls))
+		for _, data := range urls {
+			list = append(list, link.New(data, resolver))
+		}
+
+		render.JSON(w, r, Response{
+			Response: resp.OK(),
+			List:     list,
+			Count:    len(list),
+		})
+	}
+}
+
+/*
+Restore возврат ссылки с id из пути из корзины, алиас за ней сохраняется до очистки корзины.
+Восстановленная ссылка записывается в журнал аудита auditor вместе с восстановлением
+*/
+func Restore(log *slog.Logger, restorer Restorer, auditor *audit.Logger) http.HandlerFunc {
+	const op = "internal.http.handlers.url.trash.Restore"
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			log.Info("некорректный id", sl.Err(err))
+
+			resp.Render(w, r, resp.BadRequest(resp.CodeInvalidID, i18n.MsgInvalidID))
+
+			return
+		}
+
+		err = restorer.RestoreById(id, auditor.Trail(r))
+		if errors.Is(err, storage.ErrURLNotFound) {
+			log.Info("ссылки нет в корзине", slog.Int64("id", id))
+
+			resp.Render(w, r, resp.FromStorage(err, i18n.MsgNotInTrash))
+
+			return
+		}
+		if err != nil {
+			log.Error("не удалось восстановить ссылку", slog.Int64("id", id), sl.Err(err))
+
+			resp.Render(w, r, resp.FromStorage(err, i18n.MsgRestoreFailed))
+
+			return
+		}
+
+		log.Info("ссылка восстановлена", slog.Int64("id", id))
+
+		render.JSON(w, r, resp.OK())
+	}
+}
@@ -0,0 +1,288 @@
+package webhooks
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	resp "url-shoter/internal/lib/api/response"
+	"url-shoter/internal/lib/i18n"
+	"url-shoter/internal/lib/logger/sl"
+	"url-shoter/internal/lib/webhook"
+	"url-shoter/internal/storage"
+)
+
+const (
+	defaultLimit = 100
+	maxLimit     = 1000
+)
+
+type Request struct {
+	URL    string   `json:"url" validate:"required,url"`
+	Events []string `json:"events,omitempty" validate:"max=10"`           // пусто - все события
+	Secret string   `json:"secret,omitempty" validate:"omitempty,min=16"` // пусто - генерируется
+}
+
+type Manager interface {
+	CreateWebhook(hook webhook.Webhook) (webhook.Webhook, error)
+	Webhooks() ([]webhook.Webhook, error)
+	DeleteWebhook(id int64) error
+}
+
+type DeliveryLog interface {
+	WebhookDeliveries(filter webhook.DeliveryFilter) ([]webhook.Delivery, error)
+	RetryDelivery(id int64) error
+}
+
+type Response struct {
+	resp.Response
+	Webhook *webhook.Webhook `json:"webhook,omitempty"`
+}
+
+type ListResponse struct {
+	resp.Response
+	Webhooks []webhook.Webhook `json:"webhooks"`
+}
+
+type DeliveriesResponse struct {
+	resp.Response
+	Deliveries []webhook.Delivery `json:"deliveries"`
+}
+
+/*
+Create подписка на события ссылок. Секрет для проверки подписи возвращается только в этом ответе
+*/
+func Create(log *slog.Logger, manager Manager) http.HandlerFunc {
+	const op = "internal.http.handlers.webhooks.Create"
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		var req Request
+		if err := render.DecodeJSON(r.Body, &req); err != nil {
+			log.Error("Не удалось расшифровать тело запроса", sl.Err(err))
+
+			resp.Render(w, r, resp.BadRequest(resp.CodeInvalidJSON, i18n.MsgInvalidJSON))
+
+			return
+		}
+
+		if err := validator.New().Struct(req); err != nil {
+			var validateErr validator.ValidationErrors
+			errors.As(err, &validateErr)
+			log.Info("invalid request", sl.Err(err))
+
+			resp.Render(w, r, resp.Validation(validateErr))
+
+			return
+		}
+
+		if u, err := url.Parse(req.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			resp.Render(w, r, resp.Unprocessable(resp.CodeValidation, i18n.MsgFieldURL, "URL"))
+
+			return
+		}
+
+		for _, event := range req.Events {
+			if !webhook.ValidEvent(event) {
+				log.Info("неизвестное событие", slog.String("event", event))
+
+				resp.Render(w, r, resp.Unprocessable(resp.CodeValidation, i18n.MsgWebhookEvent, event))
+
+				return
+			}
+		}
+
+		if req.Secret == "" {
+			buf := make([]byte, 32)
+			if _, err := rand.Read(buf); err != nil {
+				resp.Render(w, r, resp.Internal(i18n.MsgWebhookFailed, err))
+
+				return
+			}
+			req.Secret = hex.EncodeToString(buf)
+		}
+
+		hook, err := manager.CreateWebhook(webhook.Webhook{URL: req.URL, Events: req.Events, Secret: req.Secret})
+		if err != nil {
+			log.Error("не удалось создать подписку", sl.Err(err))
+
+			resp.Render(w, r, resp.Internal(i18n.MsgWebhookFailed, err))
+
+			return
+		}
+
+		log.Info("подписка создана", slog.Int64("id", hook.ID), slog.String("url", hook.URL))
+
+		render.Status(r, http.StatusCreated)
+		render.JSON(w, r, Response{Response: resp.OK(), Webhook: &hook})
+	}
+}
+
+/*
+List подписки без секретов
+*/
+func List(log *slog.Logger, manager Manager) http.HandlerFunc {
+	const op = "internal.http.handlers.webhooks.List"
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		hooks, err := manager.Webhooks()
+		if err != nil {
+			log.Error("не удалось получить подписки", sl.Err(err))
+
+			resp.Render(w, r, resp.Internal(i18n.MsgListFailed, err))
+
+			return
+		}
+
+		if hooks == nil {
+			hooks = []webhook.Webhook{}
+		}
+
+		render.JSON(w, r, ListResponse{Response: resp.OK(), Webhooks: hooks})
+	}
+}
+
+/*
+Delete удаление подписки с id из пути вместе с журналом её доставок
+*/
+func Delete(log *slog.Logger, manager Manager) http.HandlerFunc {
+	const op = "internal.http.handlers.webhooks.Delete"
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			resp.Render(w, r, resp.BadRequest(resp.CodeInvalidID, i18n.MsgInvalidID))
+
+			return
+		}
+
+		if err := manager.DeleteWebhook(id); err != nil {
+			if !errors.Is(err, storage.ErrNotFound) {
+				log.Error("не удалось удалить подписку", sl.Err(err))
+			}
+
+			resp.Render(w, r, resp.FromStorage(err, i18n.MsgWebhookNotFound))
+
+			return
+		}
+
+		render.JSON(w, r, resp.OK())
+	}
+}
+
+/*
+Deliveries журнал доставок, новые первыми: ?webhook_id=, ?status=pending|delivered|dead, ?limit= до 1000.
+status=dead - список недоставленных событий
+*/
+func Deliveries(log *slog.Logger, deliveries DeliveryLog) http.HandlerFunc {
+	const op = "internal.http.handlers.webhooks.Deliveries"
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		query := r.URL.Query()
+		filter := webhook.DeliveryFilter{Status: query.Get("status"), Limit: defaultLimit}
+
+		switch filter.Status {
+		case "", webhook.StatusPending, webhook.StatusDelivered, webhook.StatusDead:
+		default:
+			resp.Render(w, r, resp.BadRequest(resp.CodeInvalidParam, i18n.MsgFieldInvalid, "status"))
+
+			return
+		}
+
+		if raw := query.Get("webhook_id"); raw != "" {
+			id, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil {
+				resp.Render(w, r, resp.BadRequest(resp.CodeInvalidParam, i18n.MsgFieldInvalid, "webhook_id"))
+
+				return
+			}
+			filter.WebhookID = id
+		}
+
+		if raw := query.Get("limit"); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n < 1 || n > maxLimit {
+				resp.Render(w, r, resp.BadRequest(resp.CodeInvalidParam, i18n.MsgInvalidLimit, maxLimit))
+
+				return
+			}
+			filter.Limit = n
+		}
+
+		list, err := deliveries.WebhookDeliveries(filter)
+		if err != nil {
+			log.Error("не удалось получить журнал доставок", sl.Err(err))
+
+			resp.Render(w, r, resp.Internal(i18n.MsgListFailed, err))
+
+			return
+		}
+
+		if list == nil {
+			list = []webhook.Delivery{}
+		}
+
+		render.JSON(w, r, DeliveriesResponse{Response: resp.OK(), Deliveries: list})
+	}
+}
+
+/*
+Retry повторная отправка недоставленного события с id доставки из пути
+*/
+func Retry(log *slog.Logger, deliveries DeliveryLog) http.HandlerFunc {
+	const op = "internal.http.handlers.webhooks.Retry"
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			resp.Render(w, r, resp.BadRequest(resp.CodeInvalidID, i18n.MsgInvalidID))
+
+			return
+		}
+
+		if err := deliveries.RetryDelivery(id); err != nil {
+			if !errors.Is(err, storage.ErrNotFound) {
+				log.Error("не удалось вернуть доставку в очередь", sl.Err(err))
+			}
+
+			resp.Render(w, r, resp.FromStorage(err, i18n.MsgDeliveryNotDead))
+
+			return
+		}
+
+		log.Info("доставка возвращена в очередь", slog.Int64("delivery", id))
+
+		render.JSON(w, r, resp.OK())
+	}
+}
@@ -0,0 +1,134 @@
+package webhooks_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"url-shoter/internal/http-server/handlers/webhooks"
+	"url-shoter/internal/lib/logger/handlers/slogdiscard"
+	"url-shoter/internal/lib/webhook"
+	"url-shoter/internal/storage"
+)
+
+// fakeStore запоминает созданную подписку и фильтр журнала, недоставленной считается только доставка 1
+type fakeStore struct {
+	created webhook.Webhook
+	filter  webhook.DeliveryFilter
+}
+
+func (f *fakeStore) CreateWebhook(hook webhook.Webhook) (webhook.Webhook, error) {
+	hook.ID = 1
+	f.created = hook
+	return hook, nil
+}
+
+func (f *fakeStore) Webhooks() ([]webhook.Webhook, error) { return nil, nil }
+
+func (f *fakeStore) DeleteWebhook(id int64) error { return storage.ErrNotFound }
+
+func (f *fakeStore) WebhookDeliveries(filter webhook.DeliveryFilter) ([]webhook.Delivery, error) {
+	f.filter = filter
+	return nil, nil
+}
+
+func (f *fakeStore) RetryDelivery(id int64) error {
+	if id != 1 {
+		return storage.ErrNotFound
+	}
+	return nil
+}
+
+func TestCreate(t *testing.T) {
+	cases := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantSecret string
+	}{
+		{name: "Generated secret", body: `{"url":"https://hooks.example.com","events":["link.created"]}`, wantStatus: http.StatusCreated},
+		{name: "Own secret", body: `{"url":"https://hooks.example.com","secret":"0123456789abcdef"}`, wantStatus: http.StatusCreated, wantSecret: "0123456789abcdef"},
+		{name: "Unknown event", body: `{"url":"https://hooks.example.com","events":["link.viewed"]}`, wantStatus: http.StatusUnprocessableEntity},
+		{name: "Not http", body: `{"url":"ftp://hooks.example.com"}`, wantStatus: http.StatusUnprocessableEntity},
+		{name: "Short secret", body: `{"url":"https://hooks.example.com","secret":"123"}`, wantStatus: http.StatusUnprocessableEntity},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := &fakeStore{}
+			rr := httptest.NewRecorder()
+			webhooks.Create(slogdiscard.NewDiscardLogger(), store).
+				ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/webhooks", strings.NewReader(tc.body)))
+
+			require.Equal(t, tc.wantStatus, rr.Code, rr.Body.String())
+			if tc.wantStatus != http.StatusCreated {
+				return
+			}
+
+			var body webhooks.Response
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+			require.NotNil(t, body.Webhook)
+			assert.Equal(t, store.created.Secret, body.Webhook.Secret)
+			if tc.wantSecret != "" {
+				assert.Equal(t, tc.wantSecret, body.Webhook.Secret)
+			} else {
+				assert.Len(t, body.Webhook.Secret, 64)
+			}
+		})
+	}
+}
+
+func TestDeliveries(t *testing.T) {
+	cases := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantFilter webhook.DeliveryFilter
+	}{
+		{name: "Defaults", wantStatus: http.StatusOK, wantFilter: webhook.DeliveryFilter{Limit: 100}},
+		{
+			name:       "Dead letters",
+			query:      "?webhook_id=3&status=dead&limit=10",
+			wantStatus: http.StatusOK,
+			wantFilter: webhook.DeliveryFilter{WebhookID: 3, Status: webhook.StatusDead, Limit: 10},
+		},
+		{name: "Bad status", query: "?status=lost", wantStatus: http.StatusBadRequest},
+		{name: "Bad limit", query: "?limit=0", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := &fakeStore{}
+			rr := httptest.NewRecorder()
+			webhooks.Deliveries(slogdiscard.NewDiscardLogger(), store).
+				ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/webhooks/deliveries"+tc.query, nil))
+
+			require.Equal(t, tc.wantStatus, rr.Code)
+			if tc.wantStatus == http.StatusOK {
+				assert.Equal(t, tc.wantFilter, store.filter)
+				assert.Contains(t, rr.Body.String(), `"deliveries":[]`)
+			}
+		})
+	}
+}
+
+func TestRetry(t *testing.T) {
+	router := chi.NewRouter()
+	router.Post("/webhooks/deliveries/{id}/retry", webhooks.Retry(slogdiscard.NewDiscardLogger(), &fakeStore{}))
+
+	for path, want := range map[string]int{
+		"/webhooks/deliveries/1/retry":   http.StatusOK,
+		"/webhooks/deliveries/2/retry":   http.StatusNotFound,
+		"/webhooks/deliveries/abc/retry": http.StatusBadRequest,
+	} {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, path, nil))
+		assert.Equal(t, want, rr.Code, path)
+	}
+}
@@ -0,0 +1,75 @@
+package apikey
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+
+	"url-shoter/internal/lib/actor"
+	resp "url-shoter/internal/lib/api/response"
+	"url-shoter/internal/lib/i18n"
+)
+
+/*
+Key ключ клиента, Name попадает в журнал аудита вместо самого ключа
+*/
+type Key struct {
+	Name  string
+	Value string
+}
+
+/*
+New проверка заголовка X-API-Key: без ключа или с неизвестным ключом 401, с известным
+имя ключа сохраняется в контексте запроса для журнала аудита. Пустой список ключей
+отключает проверку, запросы пропускаются как есть
+*/
+func New(log *slog.Logger, keys []Key) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if len(keys) == 0 {
+			return next
+		}
+
+		log := log.With(
+			slog.String("component", "middleware/apikey"),
+		)
+
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			value := r.Header.Get(actor.APIKeyHeader)
+			if value == "" {
+				log.Info("запрос без API ключа", slog.String("path", r.URL.Path))
+
+				resp.Render(w, r, resp.NewError(http.StatusUnauthorized, resp.CodeUnauthorized, i18n.MsgAPIKeyRequired))
+
+				return
+			}
+
+			name, ok := Lookup(keys, value)
+			if !ok {
+				log.Warn("неизвестный API ключ", slog.String("path", r.URL.Path), slog.String("key", actor.Fingerprint(value)))
+
+				resp.Render(w, r, resp.NewError(http.StatusUnauthorized, resp.CodeUnauthorized, i18n.MsgAPIKeyInvalid))
+
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(actor.WithName(r.Context(), name)))
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+/*
+Lookup имя ключа value. Сравниваются все ключи за постоянное время, чтобы не подсказывать совпадение по времени ответа
+*/
+func Lookup(keys []Key, value string) (string, bool) {
+	var name string
+	var found bool
+	for _, key := range keys {
+		if subtle.ConstantTimeCompare([]byte(key.Value), []byte(value)) == 1 && !found {
+			name, found = key.Name, true
+		}
+	}
+
+	return name, found
+}
@@ -0,0 +1,59 @@
+package apikey
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"url-shoter/internal/lib/actor"
+	"url-shoter/internal/lib/logger/handlers/slogdiscard"
+)
+
+func TestNew(t *testing.T) {
+	var seen string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = actor.FromRequest(r)
+	})
+
+	keys := []Key{{Name: "ci", Value: "secret-1"}, {Name: "admin", Value: "secret-2"}}
+	handler := New(slogdiscard.NewDiscardLogger(), keys)(next)
+
+	cases := []struct {
+		name       string
+		key        string
+		wantStatus int
+		wantActor  string
+	}{
+		{name: "No key", wantStatus: http.StatusUnauthorized},
+		{name: "Unknown key", key: "nope", wantStatus: http.StatusUnauthorized},
+		{name: "Known key", key: "secret-2", wantStatus: http.StatusOK, wantActor: "key:admin"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			seen = ""
+			req := httptest.NewRequest(http.MethodPost, "/url", nil)
+			if tc.key != "" {
+				req.Header.Set(actor.APIKeyHeader, tc.key)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.wantStatus, rr.Code)
+			assert.Equal(t, tc.wantActor, seen)
+		})
+	}
+}
+
+func TestNewWithoutKeys(t *testing.T) {
+	called := false
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true })
+
+	rr := httptest.NewRecorder()
+	New(slogdiscard.NewDiscardLogger(), nil)(next).ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/url", nil))
+
+	assert.True(t, called)
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
@@ -0,0 +1,25 @@
+package lang
+
+import (
+	"net/http"
+
+	"url-shoter/internal/lib/i18n"
+)
+
+/*
+New выбирает язык сообщений по Accept-Language, def если клиент не указал поддерживаемый язык
+*/
+func New(def i18n.Lang) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			lang := i18n.Match(r.Header.Get("Accept-Language"), def)
+
+			w.Header().Set("Content-Language", string(lang))
+			w.Header().Add("Vary", "Accept-Language")
+
+			next.ServeHTTP(w, r.WithContext(i18n.WithLang(r.Context(), lang)))
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
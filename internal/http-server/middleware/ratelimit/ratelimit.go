@@ -0,0 +1,160 @@
+package ratelimit
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"url-shoter/internal/http-server/middleware/apikey"
+	"url-shoter/internal/lib/actor"
+	resp "url-shoter/internal/lib/api/response"
+	"url-shoter/internal/lib/i18n"
+	"url-shoter/internal/lib/logger/sl"
+)
+
+/*
+Способы определения клиента для лимита
+*/
+const (
+	KeyIP     = "ip"      // адрес клиента, уже заменённый middleware.RealIP
+	KeyAPIKey = "api_key" // известный ключ из X-API-Key, без него или с неизвестным ключом адрес клиента
+	KeyRoute  = "route"   // один общий лимит на маршрут
+)
+
+/*
+APIKeyHeader заголовок с ключом API
+*/
+const APIKeyHeader = actor.APIKeyHeader
+
+/*
+KeyFunc ключ корзины для запроса
+*/
+type KeyFunc func(r *http.Request) string
+
+/*
+Policy ограничение для группы маршрутов: Rate токенов в секунду, не больше Burst подряд
+*/
+type Policy struct {
+	Name  string
+	Rate  float64
+	Burst int
+	Key   KeyFunc
+}
+
+/*
+ParseKey KeyFunc по названию из конфига, keys - известные ключи API для KeyAPIKey
+*/
+func ParseKey(name string, keys []apikey.Key) (KeyFunc, error) {
+	switch name {
+	case KeyIP, "":
+		return ByIP, nil
+	case KeyAPIKey:
+		return ByAPIKey(keys), nil
+	case KeyRoute:
+		return ByRoute, nil
+	default:
+		return nil, fmt.Errorf("неизвестный ключ лимита %q, доступны: ip, api_key, route", name)
+	}
+}
+
+func ByIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	return "ip:" + host
+}
+
+/*
+ByAPIKey корзина на известный ключ API, названная отпечатком ключа, а не им самим.
+Непроверенный ключ корзину не даёт: иначе случайный ключ в каждом запросе обходил бы лимит
+*/
+func ByAPIKey(keys []apikey.Key) KeyFunc {
+	return func(r *http.Request) string {
+		if key := r.Header.Get(APIKeyHeader); key != "" {
+			if _, ok := apikey.Lookup(keys, key); ok {
+				return "key:" + actor.Fingerprint(key)
+			}
+		}
+
+		return ByIP(r)
+	}
+}
+
+func ByRoute(r *http.Request) string {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+		return "route:" + r.Method + " " + rctx.RoutePattern()
+	}
+
+	return "route:" + r.Method + " " + r.URL.Path
+}
+
+/*
+New ограничение частоты запросов по корзине токенов. Ответы получают заголовки RateLimit-Limit,
+RateLimit-Remaining и RateLimit-Reset, отклонённые запросы - 429 и Retry-After.
+Если хранилище недоступно, запрос пропускается: лимит не должен ронять сервис
+*/
+func New(log *slog.Logger, store Store, policy Policy) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		log := log.With(
+			slog.String("component", "middleware/ratelimit"),
+			slog.String("policy", policy.Name),
+		)
+
+		log.Info("ограничение частоты запросов включено",
+			slog.Float64("rate", policy.Rate),
+			slog.Int("burst", policy.Burst),
+		)
+
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			client := policy.Key(r)
+			key := policy.Name + "|" + client
+
+			res, err := store.Take(r.Context(), key, policy.Rate, policy.Burst)
+			if err != nil {
+				log.Error("хранилище лимитов недоступно", sl.Err(err))
+
+				next.ServeHTTP(w, r)
+
+				return
+			}
+
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+			w.Header().Set("RateLimit-Policy", policyHeader(policy))
+
+			if !res.Allowed {
+				log.Warn("превышен лимит запросов", slog.String("client", client))
+
+				w.Header().Set("Retry-After", strconv.Itoa(max(1, ceilSeconds(res.RetryAfter))))
+				resp.Render(w, r, resp.NewError(http.StatusTooManyRequests, resp.CodeTooManyRequests, i18n.MsgRateLimited))
+
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+// policyHeader описание политики: ёмкость и окно, за которое она полностью восстанавливается
+func policyHeader(policy Policy) string {
+	window := ceilSeconds(time.Duration(float64(policy.Burst) / policy.Rate * float64(time.Second)))
+
+	return strings.Join([]string{strconv.Itoa(policy.Burst), "w=" + strconv.Itoa(window)}, ";")
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
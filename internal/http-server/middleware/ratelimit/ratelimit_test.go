@@ -0,0 +1,77 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"url-shoter/internal/http-server/middleware/apikey"
+	"url-shoter/internal/lib/logger/handlers/slogdiscard"
+)
+
+func TestMemoryStore(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	s := NewMemoryStore()
+	s.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		res, err := s.Take(context.Background(), "a", 1, 3)
+		require.NoError(t, err)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, 2-i, res.Remaining)
+	}
+
+	res, err := s.Take(context.Background(), "a", 1, 3)
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, time.Second, res.RetryAfter)
+	assert.Equal(t, 3*time.Second, res.Reset)
+
+	res, _ = s.Take(context.Background(), "b", 1, 3)
+	assert.True(t, res.Allowed, "у другого ключа своя корзина")
+
+	now = now.Add(time.Second)
+	res, _ = s.Take(context.Background(), "a", 1, 3)
+	assert.True(t, res.Allowed, "токен восстановился")
+}
+
+func TestMiddleware(t *testing.T) {
+	handler := New(slogdiscard.NewDiscardLogger(), NewMemoryStore(), Policy{Name: "save", Rate: 0.5, Burst: 2,
+		Key: ByAPIKey([]apikey.Key{{Name: "ci", Value: "k1"}, {Name: "bot", Value: "k2"}})})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusCreated) }),
+	)
+
+	serve := func(apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/url", nil)
+		req.RemoteAddr = "203.0.113.7:5000"
+		if apiKey != "" {
+			req.Header.Set(APIKeyHeader, apiKey)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := serve("k1")
+	require.Equal(t, http.StatusCreated, rr.Code)
+	assert.Equal(t, "2", rr.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", rr.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "2;w=4", rr.Header().Get("RateLimit-Policy"))
+
+	require.Equal(t, http.StatusCreated, serve("k1").Code)
+
+	rr = serve("k1")
+	require.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, "2", rr.Header().Get("Retry-After"))
+	assert.Contains(t, rr.Body.String(), `"code":"too_many_requests"`)
+
+	assert.Equal(t, http.StatusCreated, serve("k2").Code, "другой ключ API")
+	assert.Equal(t, http.StatusCreated, serve("").Code, "без ключа лимит по IP")
+	assert.Equal(t, http.StatusCreated, serve("").Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve("random").Code, "неизвестный ключ не даёт новую корзину")
+}
@@ -0,0 +1,105 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+/*
+Result итог попытки взять токен из корзины
+*/
+type Result struct {
+	Allowed    bool
+	Limit      int           // ёмкость корзины
+	Remaining  int           // целых токенов после попытки
+	Reset      time.Duration // через сколько корзина снова будет полной
+	RetryAfter time.Duration // через сколько появится токен, если запрос отклонён
+}
+
+/*
+Store хранилище корзин токенов. MemoryStore работает в пределах одного процесса,
+для нескольких реплик нужна реализация поверх общего хранилища (Redis, Postgres),
+которая атомарно выполняет то же пополнение и списание
+*/
+type Store interface {
+	Take(ctx context.Context, key string, rate float64, burst int) (Result, error)
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	rate   float64
+	burst  int
+}
+
+/*
+MemoryStore корзины токенов в памяти процесса
+*/
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// sweepInterval как часто удаляются корзины, которые успели наполниться и ничего не ограничивают
+const sweepInterval = time.Minute
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+/*
+Take списание одного токена: корзина ёмкостью burst пополняется со скоростью rate токенов в секунду
+*/
+func (s *MemoryStore) Take(_ context.Context, key string, rate float64, burst int) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.Sub(s.lastSweep) >= sweepInterval {
+		s.sweep(now)
+		s.lastSweep = now
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(burst), last: now}
+		s.buckets[key] = b
+	}
+	b.rate, b.burst = rate, burst
+
+	b.tokens = math.Min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	res := Result{Limit: burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - b.tokens) / rate)
+	}
+
+	res.Remaining = int(b.tokens)
+	res.Reset = seconds((float64(burst) - b.tokens) / rate)
+
+	return res, nil
+}
+
+// sweep удаление полных корзин: для них новая корзина ничем не отличается от старой
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, b := range s.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*b.rate >= float64(b.burst) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+func seconds(v float64) time.Duration {
+	return time.Duration(v * float64(time.Second))
+}
@@ -0,0 +1,83 @@
+package scanguard
+
+import (
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	resp "url-shoter/internal/lib/api/response"
+	"url-shoter/internal/lib/i18n"
+	"url-shoter/internal/lib/logger/sl"
+	"url-shoter/internal/lib/scan"
+)
+
+/*
+BlockRecorder журнал блокировок клиентов
+*/
+type BlockRecorder interface {
+	RecordBlock(block scan.Block) error
+}
+
+/*
+New защита переходов от перебора алиасов: клиент с большой долей 404 блокируется
+с нарастающей длительностью, каждая блокировка пишется в журнал. recorder может быть nil
+*/
+func New(log *slog.Logger, detector *scan.Detector, recorder BlockRecorder) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		log := log.With(
+			slog.String("component", "middleware/scanguard"),
+		)
+
+		log.Info("защита от перебора алиасов включена")
+
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			client := clientIP(r)
+
+			if retry, blocked := detector.Blocked(client); blocked {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+				resp.Render(w, r, resp.NewError(http.StatusTooManyRequests, resp.CodeTooManyRequests, i18n.MsgRateLimited))
+
+				return
+			}
+
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r)
+
+			block, blocked := detector.Observe(client, ww.Status() == http.StatusNotFound)
+			if !blocked {
+				return
+			}
+
+			log.Warn("клиент заблокирован за перебор алиасов",
+				slog.String("client", block.Client),
+				slog.Int("level", block.Level),
+				slog.Int("not_found", block.NotFound),
+				slog.Int("total", block.Total),
+				slog.Time("until", block.Until),
+				slog.String("request_id", middleware.GetReqID(r.Context())),
+			)
+
+			if recorder != nil {
+				if err := recorder.RecordBlock(block); err != nil {
+					log.Error("не удалось записать блокировку", sl.Err(err))
+				}
+			}
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+// clientIP адрес клиента: RemoteAddr уже заменён middleware.RealIP, порт может отсутствовать
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
@@ -0,0 +1,63 @@
+package scanguard
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"url-shoter/internal/lib/logger/handlers/slogdiscard"
+	"url-shoter/internal/lib/scan"
+)
+
+type recorder struct {
+	blocks []scan.Block
+}
+
+func (r *recorder) RecordBlock(block scan.Block) error {
+	r.blocks = append(r.blocks, block)
+	return nil
+}
+
+func TestScanGuard(t *testing.T) {
+	detector := scan.New(scan.Config{
+		Window:        time.Minute,
+		MinRequests:   3,
+		NotFoundRatio: 0.5,
+		BaseBlock:     time.Minute,
+		MaxBlock:      time.Hour,
+		ResetAfter:    time.Hour,
+	})
+	audit := &recorder{}
+
+	handler := New(slogdiscard.NewDiscardLogger(), detector, audit)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ok" {
+			w.WriteHeader(http.StatusFound)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+
+	serve := func(path string, ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = ip + ":5000"
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	for _, path := range []string{"/aaaaaa", "/aaaaab", "/aaaaac"} {
+		assert.Equal(t, http.StatusNotFound, serve(path, "203.0.113.7").Code)
+	}
+	require.Len(t, audit.blocks, 1)
+	assert.Equal(t, "203.0.113.7", audit.blocks[0].Client)
+
+	rr := serve("/ok", "203.0.113.7")
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, "60", rr.Header().Get("Retry-After"))
+
+	assert.Equal(t, http.StatusFound, serve("/ok", "198.51.100.1").Code)
+}
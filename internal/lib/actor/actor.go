@@ -0,0 +1,68 @@
+package actor
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+)
+
+/*
+APIKeyHeader заголовок с API ключом клиента
+*/
+const APIKeyHeader = "X-API-Key"
+
+type ctxKey struct{}
+
+/*
+WithName запрос от известного клиента, имя выставляет проверка API ключа
+*/
+func WithName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, name)
+}
+
+/*
+FromRequest кто выполняет запрос, для записи в хранилище: имя ключа после проверки API ключа,
+иначе отпечаток ключа из заголовка, без ключа IP клиента.
+Сам ключ не сохраняется, по отпечатку его можно сверить, но не восстановить
+*/
+func FromRequest(r *http.Request) string {
+	if name, ok := Name(r.Context()); ok {
+		return "key:" + name
+	}
+
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		return "key:" + Fingerprint(key)
+	}
+
+	return "ip:" + IP(r)
+}
+
+/*
+Name имя клиента, сохранённое WithName
+*/
+func Name(ctx context.Context) (string, bool) {
+	name, ok := ctx.Value(ctxKey{}).(string)
+	return name, ok && name != ""
+}
+
+/*
+IP адрес клиента без порта
+*/
+func IP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+/*
+Fingerprint первые 12 символов sha256 ключа в hex
+*/
+func Fingerprint(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])[:12]
+}
@@ -0,0 +1,23 @@
+package actor
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFromRequest(t *testing.T) {
+	req := httptest.NewRequest("DELETE", "/url/1", nil)
+	req.RemoteAddr = "10.0.0.1:4321"
+	assert.Equal(t, "ip:10.0.0.1", FromRequest(req))
+
+	req.Header.Set(APIKeyHeader, "secret")
+	got := FromRequest(req)
+	assert.Equal(t, "key:"+Fingerprint("secret"), got)
+	assert.NotContains(t, got, "secret")
+	assert.Len(t, Fingerprint("secret"), 12)
+
+	req = req.WithContext(WithName(req.Context(), "ci"))
+	assert.Equal(t, "key:ci", FromRequest(req))
+}
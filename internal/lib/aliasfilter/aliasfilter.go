@@ -0,0 +1,278 @@
+package aliasfilter
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"url-shoter/internal/lib/i18n"
+	"url-shoter/internal/lib/random"
+)
+
+/*
+Политики регистра своих алиасов
+*/
+const (
+	CasePreserve  = "preserve"   // алиас сохраняется как есть
+	CaseFold      = "fold"       // алиас приводится к нижнему регистру
+	CaseLowerOnly = "lower_only" // алиас с заглавными буквами отклоняется
+)
+
+var (
+	ErrCharset  = errors.New("alias contains forbidden characters")
+	ErrLength   = errors.New("alias length out of range")
+	ErrCase     = errors.New("alias must be lower case")
+	ErrReserved = errors.New("alias is reserved")
+	ErrBlocked  = errors.New("alias contains blocked word")
+
+	ErrGenerate = errors.New("no allowed alias generated")
+)
+
+/*
+Error причина отказа с ключом сообщения для клиента, сравнивается с Err* через errors.Is
+*/
+type Error struct {
+	Err  error
+	Key  i18n.Key
+	Args []any
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+/*
+Rules ограничения формы алиаса. Charset - содержимое класса символов регулярного выражения,
+пустые поля берутся из DefaultRules
+*/
+type Rules struct {
+	Charset   string
+	MinLength int
+	MaxLength int
+	Case      string
+
+	CaseInsensitive bool // алиасы ищутся без учёта регистра, генерируются только в нижнем регистре
+}
+
+/*
+DefaultRules буквы, цифры, _ и -, от 1 до 64 символов, регистр сохраняется
+*/
+var DefaultRules = Rules{Charset: "A-Za-z0-9_-", MinLength: 1, MaxLength: 64, Case: CasePreserve}
+
+/*
+Filter проверка алиасов: форма по Rules, зарезервированные слова совпадают целиком без учёта регистра,
+нежелательные слова ищутся внутри алиаса с учётом регистра, разделителей и замены букв цифрами
+*/
+type Filter struct {
+	rules    Rules
+	charset  *regexp.Regexp
+	reserved map[string]struct{}
+	words    []string
+}
+
+func New(rules Rules, reserved []string, blockedWords []string) (*Filter, error) {
+	const op = "lib.aliasfilter.New"
+
+	if rules.Charset == "" {
+		rules.Charset = DefaultRules.Charset
+	}
+	if rules.Case == "" {
+		rules.Case = CasePreserve
+	}
+	if rules.MinLength == 0 {
+		rules.MinLength = DefaultRules.MinLength
+	}
+	if rules.MaxLength == 0 {
+		rules.MaxLength = DefaultRules.MaxLength
+	}
+
+	switch rules.Case {
+	case CasePreserve, CaseFold, CaseLowerOnly:
+	default:
+		return nil, fmt.Errorf("%s: неизвестная политика регистра %q, доступны: preserve, fold, lower_only", op, rules.Case)
+	}
+
+	if rules.MinLength < 1 || rules.MaxLength < rules.MinLength {
+		return nil, fmt.Errorf("%s: некорректные границы длины алиаса %d..%d", op, rules.MinLength, rules.MaxLength)
+	}
+
+	charset, err := regexp.Compile("^[" + rules.Charset + "]+$")
+	if err != nil {
+		return nil, fmt.Errorf("%s: некорректный набор символов %q: %w", op, rules.Charset, err)
+	}
+
+	f := &Filter{rules: rules, charset: charset, reserved: make(map[string]struct{}, len(reserved))}
+
+	f.Reserve(reserved...)
+	for _, word := range blockedWords {
+		if word = normalize(word); word != "" {
+			f.words = append(f.words, word)
+		}
+	}
+
+	return f, nil
+}
+
+/*
+Reserve добавление зарезервированных слов, вызывается до начала обработки запросов
+*/
+func (f *Filter) Reserve(words ...string) {
+	for _, word := range words {
+		f.reserved[strings.ToLower(word)] = struct{}{}
+	}
+}
+
+/*
+Check проверка своего алиаса, возвращает алиас в том виде, в котором его нужно сохранить.
+nil фильтр пропускает всё
+*/
+func (f *Filter) Check(alias string) (string, error) {
+	if f == nil {
+		return alias, nil
+	}
+
+	if f.rules.Case == CaseFold {
+		alias = strings.ToLower(alias)
+	}
+
+	length := len([]rune(alias))
+	if length < f.rules.MinLength || length > f.rules.MaxLength {
+		return alias, &Error{Err: ErrLength, Key: i18n.MsgAliasLength, Args: []any{f.rules.MinLength, f.rules.MaxLength}}
+	}
+
+	if !f.charset.MatchString(alias) {
+		return alias, &Error{Err: ErrCharset, Key: i18n.MsgAliasCharset, Args: []any{f.rules.Charset}}
+	}
+
+	if f.rules.Case == CaseLowerOnly && alias != strings.ToLower(alias) {
+		return alias, &Error{Err: ErrCase, Key: i18n.MsgAliasCase}
+	}
+
+	if _, ok := f.reserved[strings.ToLower(alias)]; ok {
+		return alias, &Error{Err: ErrReserved, Key: i18n.MsgAliasNotAllowed}
+	}
+
+	normalized := normalize(alias)
+	for _, word := range f.words {
+		if strings.Contains(normalized, word) {
+			return alias, &Error{Err: ErrBlocked, Key: i18n.MsgAliasNotAllowed}
+		}
+	}
+
+	return alias, nil
+}
+
+/*
+Allowed алиас проходит проверку без изменений
+*/
+func (f *Filter) Allowed(alias string) bool {
+	checked, err := f.Check(alias)
+	return err == nil && checked == alias
+}
+
+/*
+Alphabet алфавит генератора алиасов: без заглавных букв, если регистр не сохраняется
+или алиасы ищутся без учёта регистра. nil фильтр - полный алфавит
+*/
+func (f *Filter) Alphabet() string {
+	if f != nil && (f.rules.CaseInsensitive || f.rules.Case != CasePreserve) {
+		return random.LowerAlphabet
+	}
+	return random.Alphabet
+}
+
+// maxGenerateAttempts попыток сгенерировать разрешённый алиас, на случай фильтра, запрещающего почти всё
+const maxGenerateAttempts = 100
+
+/*
+Generate алиас из next, прошедший фильтр. При политике регистра, отличной от preserve,
+сгенерированный алиас приводится к нижнему регистру. Если за maxGenerateAttempts попыток
+разрешённый алиас не получился, возвращается ErrGenerate
+*/
+func (f *Filter) Generate(next func() string) (string, error) {
+	gen := next
+	if f != nil && f.rules.Case != CasePreserve {
+		gen = func() string { return strings.ToLower(next()) }
+	}
+
+	for i := 0; i < maxGenerateAttempts; i++ {
+		if alias := gen(); f.Allowed(alias) {
+			return alias, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: %d попыток", ErrGenerate, maxGenerateAttempts)
+}
+
+/*
+RouteWords первые статические сегменты зарегистрированных маршрутов: алиас с таким именем
+перекрыл бы маршрут или был бы им перекрыт
+*/
+func RouteWords(routes chi.Routes) ([]string, error) {
+	seen := make(map[string]struct{})
+	var words []string
+
+	err := chi.Walk(routes, func(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		segment, _, _ := strings.Cut(strings.TrimPrefix(route, "/"), "/")
+		if segment == "" || strings.ContainsAny(segment, "{*") {
+			return nil
+		}
+
+		if _, ok := seen[segment]; !ok {
+			seen[segment] = struct{}{}
+			words = append(words, segment)
+		}
+
+		return nil
+	})
+
+	return words, err
+}
+
+/*
+LoadWords список слов из файла: по слову в строке, пустые строки и строки с # пропускаются
+*/
+func LoadWords(path string) ([]string, error) {
+	const op = "lib.aliasfilter.LoadWords"
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer file.Close()
+
+	var words []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return words, nil
+}
+
+// leet замена цифр и символов похожими буквами, чтобы b4d и b-a-d не обходили фильтр
+var leet = strings.NewReplacer(
+	"0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t", "@", "a", "$", "s",
+	"-", "", "_", "", ".", "", "~", "",
+)
+
+func normalize(s string) string {
+	return leet.Replace(strings.ToLower(strings.TrimSpace(s)))
+}
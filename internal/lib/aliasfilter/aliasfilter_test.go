@@ -0,0 +1,154 @@
+package aliasfilter
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"url-shoter/internal/lib/random"
+)
+
+func TestAllowed(t *testing.T) {
+	f, err := New(DefaultRules, []string{"admin", "url"}, []string{"bad"})
+	require.NoError(t, err)
+
+	cases := []struct {
+		alias string
+		want  bool
+	}{
+		{"promo", true},
+		{"Admin", false},
+		{"admins", true},
+		{"url", false},
+		{"notbad", false},
+		{"B4D", false},
+		{"b-a_d", false},
+		{"bead", true},
+	}
+
+	for _, tc := range cases {
+		assert.Equal(t, tc.want, f.Allowed(tc.alias), tc.alias)
+	}
+
+	var none *Filter
+	assert.True(t, none.Allowed("admin"))
+}
+
+func TestCheck(t *testing.T) {
+	cases := []struct {
+		name    string
+		rules   Rules
+		alias   string
+		want    string
+		wantErr error
+	}{
+		{name: "ok", rules: DefaultRules, alias: "Promo-1", want: "Promo-1"},
+		{name: "too short", rules: Rules{MinLength: 3, MaxLength: 8}, alias: "ab", wantErr: ErrLength},
+		{name: "too long", rules: Rules{MinLength: 1, MaxLength: 4}, alias: "abcde", wantErr: ErrLength},
+		{name: "charset", rules: DefaultRules, alias: "a/b", wantErr: ErrCharset},
+		{name: "preview suffix", rules: DefaultRules, alias: "abc+", wantErr: ErrCharset},
+		{name: "custom charset", rules: Rules{Charset: "a-z", MinLength: 1, MaxLength: 8}, alias: "abc1", wantErr: ErrCharset},
+		{name: "fold", rules: Rules{Case: CaseFold}, alias: "Promo", want: "promo"},
+		{name: "lower only", rules: Rules{Case: CaseLowerOnly}, alias: "Promo", wantErr: ErrCase},
+		{name: "reserved", rules: DefaultRules, alias: "ALL", wantErr: ErrReserved},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := New(tc.rules, []string{"all"}, nil)
+			require.NoError(t, err)
+
+			alias, err := f.Check(tc.alias)
+			if tc.wantErr != nil {
+				require.Error(t, err)
+				assert.True(t, errors.Is(err, tc.wantErr), err)
+
+				var filterErr *Error
+				require.ErrorAs(t, err, &filterErr)
+				assert.NotEmpty(t, filterErr.Key)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, alias)
+		})
+	}
+}
+
+func TestNewInvalidRules(t *testing.T) {
+	_, err := New(Rules{Case: "upper"}, nil, nil)
+	assert.Error(t, err)
+
+	_, err = New(Rules{MinLength: 10, MaxLength: 5}, nil, nil)
+	assert.Error(t, err)
+
+	_, err = New(Rules{Charset: "a-"}, nil, nil)
+	assert.NoError(t, err)
+
+	_, err = New(Rules{Charset: "z-a"}, nil, nil)
+	assert.Error(t, err)
+}
+
+func TestGenerate(t *testing.T) {
+	f, err := New(Rules{Case: CaseFold}, []string{"aaa"}, nil)
+	require.NoError(t, err)
+	candidates := []string{"aaa", "AAA", "BbB"}
+
+	alias, err := f.Generate(func() string {
+		next := candidates[0]
+		candidates = candidates[1:]
+		return next
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "bbb", alias)
+
+	_, err = f.Generate(func() string { return "aaa" })
+	assert.ErrorIs(t, err, ErrGenerate)
+}
+
+func TestAlphabet(t *testing.T) {
+	var nilFilter *Filter
+	assert.Equal(t, random.Alphabet, nilFilter.Alphabet())
+
+	preserve, err := New(DefaultRules, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, random.Alphabet, preserve.Alphabet())
+
+	insensitive, err := New(Rules{CaseInsensitive: true}, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, random.LowerAlphabet, insensitive.Alphabet())
+
+	folded, err := New(Rules{Case: CaseFold}, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, random.LowerAlphabet, folded.Alphabet())
+}
+
+func TestRouteWords(t *testing.T) {
+	noop := func(w http.ResponseWriter, r *http.Request) {}
+
+	router := chi.NewRouter()
+	router.Get("/all", noop)
+	router.Get("/url/{alias}/qr", noop)
+	router.Post("/url", noop)
+	router.Get("/security/blocked", noop)
+	router.Get("/*", noop)
+
+	words, err := RouteWords(router)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"all", "url", "security"}, words)
+}
+
+func TestLoadWords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "words.txt")
+	require.NoError(t, os.WriteFile(path, []byte("# список\nbad\n\n  worse \n"), 0o644))
+
+	words, err := LoadWords(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"bad", "worse"}, words)
+}
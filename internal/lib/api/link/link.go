@@ -0,0 +1,87 @@
+package link
+
+import (
+	"time"
+	"url-shoter/internal/lib/domains"
+	"url-shoter/internal/lib/rules"
+	"url-shoter/internal/lib/variants"
+	"url-shoter/internal/storage"
+)
+
+/*
+Link представление ссылки в ответах API: вместе с данными из хранилища отдаются
+полная короткая ссылка и ссылка на QR код, чтобы клиентам не собирать их самим
+*/
+type Link struct {
+	ID        int64      `json:"id,omitempty"`
+	Alias     string     `json:"alias,omitempty"`
+	URL       string     `json:"url,omitempty"`
+	Domain    string     `json:"domain,omitempty"`
+	ShortURL  string     `json:"short_url,omitempty"`
+	QRCodeURL string     `json:"qr_code_url,omitempty"`
+	Title     string     `json:"title,omitempty"`
+	Clicks    int64      `json:"clicks,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Campaign  string     `json:"campaign,omitempty"`
+
+	RedirectType int    `json:"redirect_type,omitempty"`
+	Preview      bool   `json:"preview,omitempty"`
+	ForwardQuery bool   `json:"forward_query,omitempty"`
+	ForwardPath  bool   `json:"forward_path,omitempty"`
+	PreviewURL   string `json:"preview_url,omitempty"` // короткая ссылка с + на конце, всегда открывает страницу предпросмотра
+
+	Rules    []rules.Rule       `json:"rules,omitempty"`
+	Variants []variants.Variant `json:"variants,omitempty"`
+	Sticky   string             `json:"sticky,omitempty"`
+
+	Protected bool `json:"protected,omitempty"` // ссылка защищена паролем, сам хеш в ответы не попадает
+
+	DeletedAt *time.Time `json:"deleted_at,omitempty"` // только для ссылок в корзине
+	DeletedBy string     `json:"deleted_by,omitempty"`
+}
+
+/*
+PreviewSuffix суффикс алиаса, по которому вместо редиректа показывается страница предпросмотра
+*/
+const PreviewSuffix = "+"
+
+func New(data storage.URLData, resolver *domains.Resolver) *Link {
+	l := &Link{
+		ID:        data.Id,
+		Alias:     data.Alias,
+		URL:       data.Url,
+		Domain:    data.Domain,
+		ShortURL:  resolver.ShortURL(data.Domain, data.Alias),
+		QRCodeURL: resolver.QRCodeURL(data.Domain, data.Alias),
+		Title:     data.Title,
+		Clicks:    data.Clicks,
+		ExpiresAt: data.ExpiresAt,
+		Campaign:  data.Campaign,
+
+		RedirectType: data.RedirectType,
+		Preview:      data.Preview,
+		ForwardQuery: data.ForwardQuery,
+		ForwardPath:  data.ForwardPath,
+
+		Rules:    data.Rules,
+		Variants: data.Variants,
+		Sticky:   data.Sticky,
+
+		Protected: data.PasswordHash != "",
+
+		DeletedAt: data.DeletedAt,
+		DeletedBy: data.DeletedBy,
+	}
+
+	if l.ShortURL != "" && data.Alias != "" {
+		l.PreviewURL = l.ShortURL + PreviewSuffix
+	}
+
+	if !data.CreatedAt.IsZero() {
+		createdAt := data.CreatedAt
+		l.CreatedAt = &createdAt
+	}
+
+	return l
+}
@@ -0,0 +1,228 @@
+package response
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+	"mime"
+	"net/http"
+	"strings"
+	"url-shoter/internal/lib/aliasfilter"
+	"url-shoter/internal/lib/i18n"
+	"url-shoter/internal/storage"
+)
+
+/*
+Code машиночитаемый код ошибки, не зависит от языка сообщения и не меняется между версиями
+*/
+type Code string
+
+const (
+	CodeBadRequest       Code = "bad_request"
+	CodeInvalidJSON      Code = "invalid_json"
+	CodeInvalidID        Code = "invalid_id"
+	CodeInvalidParam     Code = "invalid_param"
+	CodeValidation       Code = "validation_failed"
+	CodeUnauthorized     Code = "unauthorized"
+	CodeNotFound         Code = "not_found"
+	CodeURLNotFound      Code = "url_not_found"
+	CodeAliasExists      Code = "alias_exists"
+	CodeIDExists         Code = "id_exists"
+	CodeConflict         Code = "conflict"
+	CodeImportConflict   Code = "import_conflict"
+	CodeURLExpired       Code = "url_expired"
+	CodeURLDeleted       Code = "url_deleted"
+	CodeURLUnsafe        Code = "url_unsafe"
+	CodeBatchTooLarge    Code = "batch_too_large"
+	CodeDomainNotAllowed Code = "domain_not_allowed"
+	CodeInvalidExpiry    Code = "invalid_expiry"
+	CodePasswordRequired Code = "password_required"
+	CodeInvalidPassword  Code = "invalid_password"
+	CodeTooManyRequests  Code = "too_many_requests"
+	CodeAliasNotAllowed  Code = "alias_not_allowed"
+	CodeInvalidAlias     Code = "invalid_alias"
+	CodeInternal         Code = "internal"
+)
+
+/*
+ProblemContentType тип ответа RFC 7807, отдаётся если клиент указал его в Accept
+*/
+const ProblemContentType = "application/problem+json"
+
+/*
+APIError ошибка обработчика: HTTP статус, код и ключ сообщения для клиента, исходная ошибка для логов.
+Сообщение переводится на язык запроса только при отправке ответа.
+*/
+type APIError struct {
+	HTTPStatus int
+	Code       Code
+	Key        i18n.Key
+	Args       []any
+	Err        error
+
+	validation validator.ValidationErrors
+}
+
+func (e *APIError) Error() string {
+	if e.Err != nil {
+		return string(e.Code) + ": " + e.Err.Error()
+	}
+
+	return string(e.Code)
+}
+
+/*
+Message сообщение об ошибке на языке lang
+*/
+func (e *APIError) Message(lang i18n.Lang) string {
+	if e.validation != nil {
+		return validationMessage(lang, e.validation)
+	}
+
+	return i18n.T(lang, e.Key, e.Args...)
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+func NewError(status int, code Code, key i18n.Key, args ...any) *APIError {
+	return &APIError{HTTPStatus: status, Code: code, Key: key, Args: args}
+}
+
+func BadRequest(code Code, key i18n.Key, args ...any) *APIError {
+	return NewError(http.StatusBadRequest, code, key, args...)
+}
+
+func Unprocessable(code Code, key i18n.Key, args ...any) *APIError {
+	return NewError(http.StatusUnprocessableEntity, code, key, args...)
+}
+
+func NotFound(key i18n.Key) *APIError {
+	return NewError(http.StatusNotFound, CodeNotFound, key)
+}
+
+func Internal(key i18n.Key, err error) *APIError {
+	return &APIError{HTTPStatus: http.StatusInternalServerError, Code: CodeInternal, Key: key, Err: err}
+}
+
+/*
+InvalidAlias отказ фильтра алиасов: зарезервированные и нежелательные алиасы - alias_not_allowed,
+нарушение формы - invalid_alias
+*/
+func InvalidAlias(err error) *APIError {
+	e := &APIError{HTTPStatus: http.StatusUnprocessableEntity, Code: CodeInvalidAlias, Key: i18n.MsgAliasNotAllowed, Err: err}
+
+	var filterErr *aliasfilter.Error
+	if errors.As(err, &filterErr) {
+		e.Key, e.Args = filterErr.Key, filterErr.Args
+	}
+
+	if errors.Is(err, aliasfilter.ErrReserved) || errors.Is(err, aliasfilter.ErrBlocked) {
+		e.Code = CodeAliasNotAllowed
+	}
+
+	return e
+}
+
+/*
+Validation ошибка валидации запроса
+*/
+func Validation(errs validator.ValidationErrors) *APIError {
+	return &APIError{HTTPStatus: http.StatusUnprocessableEntity, Code: CodeValidation, validation: errs}
+}
+
+/*
+FromStorage ошибка хранилища в ошибку API по sentinel ошибкам пакета storage,
+неизвестные ошибки считаются внутренними
+*/
+func FromStorage(err error, key i18n.Key) *APIError {
+	e := &APIError{Key: key, Err: err}
+
+	switch {
+	case errors.Is(err, storage.ErrURLNotFound):
+		e.HTTPStatus, e.Code = http.StatusNotFound, CodeURLNotFound
+	case errors.Is(err, storage.ErrURLExpired):
+		e.HTTPStatus, e.Code = http.StatusGone, CodeURLExpired
+	case errors.Is(err, storage.ErrURLDeleted):
+		e.HTTPStatus, e.Code = http.StatusGone, CodeURLDeleted
+	case errors.Is(err, storage.ErrAliasExists):
+		e.HTTPStatus, e.Code = http.StatusConflict, CodeAliasExists
+	case errors.Is(err, storage.ErrIDExists):
+		e.HTTPStatus, e.Code = http.StatusConflict, CodeIDExists
+	case errors.Is(err, storage.ErrURLExists):
+		e.HTTPStatus, e.Code = http.StatusConflict, CodeConflict
+	case errors.Is(err, storage.ErrNotFound):
+		e.HTTPStatus, e.Code = http.StatusNotFound, CodeNotFound
+	case errors.Is(err, storage.ErrImportConflict):
+		e.HTTPStatus, e.Code = http.StatusConflict, CodeImportConflict
+	default:
+		e.HTTPStatus, e.Code = http.StatusInternalServerError, CodeInternal
+	}
+
+	return e
+}
+
+/*
+Problem тело ответа по RFC 7807
+*/
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	Code      Code   `json:"code"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+/*
+Render ответ с ошибкой: статус из ошибки, тело Response или problem+json по заголовку Accept
+*/
+func Render(w http.ResponseWriter, r *http.Request, e *APIError) {
+	RenderWith(w, r, e, Fail(r, e))
+}
+
+/*
+RenderWith то же что Render, но с собственным телом ответа обработчика вместо Response.
+Если клиент запросил problem+json, тело заменяется на Problem.
+*/
+func RenderWith(w http.ResponseWriter, r *http.Request, e *APIError, body any) {
+	if WantsProblem(r) {
+		// render.JSON выставляет application/json, поэтому тело пишется напрямую
+		buf, _ := json.Marshal(Problem{
+			Type:      "urn:url-shoter:problem:" + string(e.Code),
+			Title:     http.StatusText(e.HTTPStatus),
+			Status:    e.HTTPStatus,
+			Detail:    e.Message(i18n.FromRequest(r)),
+			Instance:  r.URL.Path,
+			Code:      e.Code,
+			RequestID: middleware.GetReqID(r.Context()),
+		})
+
+		w.Header().Set("Content-Type", ProblemContentType)
+		w.WriteHeader(e.HTTPStatus)
+		_, _ = w.Write(buf)
+
+		return
+	}
+
+	render.Status(r, e.HTTPStatus)
+	render.JSON(w, r, body)
+}
+
+/*
+WantsProblem клиент явно принимает application/problem+json
+*/
+func WantsProblem(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err == nil && mediaType == ProblemContentType {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,93 @@
+package response_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	resp "url-shoter/internal/lib/api/response"
+	"url-shoter/internal/lib/i18n"
+	"url-shoter/internal/storage"
+)
+
+func TestFromStorage(t *testing.T) {
+	cases := []struct {
+		err    error
+		status int
+		code   resp.Code
+	}{
+		{storage.ErrURLNotFound, http.StatusNotFound, resp.CodeURLNotFound},
+		{storage.ErrURLExpired, http.StatusGone, resp.CodeURLExpired},
+		{storage.ErrURLDeleted, http.StatusGone, resp.CodeURLDeleted},
+		{storage.ErrAliasExists, http.StatusConflict, resp.CodeAliasExists},
+		{storage.ErrIDExists, http.StatusConflict, resp.CodeIDExists},
+		{storage.ErrURLExists, http.StatusConflict, resp.CodeConflict},
+		{storage.ErrImportConflict, http.StatusConflict, resp.CodeImportConflict},
+		{storage.ErrNotFound, http.StatusNotFound, resp.CodeNotFound},
+		{errors.New("boom"), http.StatusInternalServerError, resp.CodeInternal},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.err.Error(), func(t *testing.T) {
+			e := resp.FromStorage(fmt.Errorf("storage.pgsql.Op: %w", tc.err), i18n.MsgInternal)
+
+			assert.Equal(t, tc.status, e.HTTPStatus)
+			assert.Equal(t, tc.code, e.Code)
+			assert.ErrorIs(t, e, tc.err)
+		})
+	}
+}
+
+func TestRender(t *testing.T) {
+	apiErr := resp.NewError(http.StatusConflict, resp.CodeAliasExists, i18n.MsgAliasExists)
+
+	t.Run("json", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/url", nil)
+		rr := httptest.NewRecorder()
+		resp.Render(rr, req, apiErr)
+
+		require.Equal(t, http.StatusConflict, rr.Code)
+
+		var body resp.Response
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+		assert.Equal(t, resp.StatusError, body.Status)
+		assert.Equal(t, resp.CodeAliasExists, body.Code)
+		assert.Equal(t, "alias уже существует", body.Error)
+	})
+
+	t.Run("problem", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/url", nil)
+		req.Header.Set("Accept", "application/json;q=0.5, application/problem+json")
+		rr := httptest.NewRecorder()
+		resp.Render(rr, req, apiErr)
+
+		require.Equal(t, http.StatusConflict, rr.Code)
+		assert.Equal(t, resp.ProblemContentType, rr.Header().Get("Content-Type"))
+
+		var body resp.Problem
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+		assert.Equal(t, http.StatusConflict, body.Status)
+		assert.Equal(t, "Conflict", body.Title)
+		assert.Equal(t, "alias уже существует", body.Detail)
+		assert.Equal(t, "/url", body.Instance)
+		assert.Equal(t, resp.CodeAliasExists, body.Code)
+	})
+
+	t.Run("english", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/url", nil)
+		req.Header.Set("Accept-Language", "en-GB,en;q=0.9")
+		rr := httptest.NewRecorder()
+		resp.Render(rr, req, apiErr)
+
+		var body resp.Response
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+		assert.Equal(t, resp.CodeAliasExists, body.Code)
+		assert.Equal(t, "alias already exists", body.Error)
+	})
+}
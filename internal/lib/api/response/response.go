@@ -1,14 +1,16 @@
 package response
 
 import (
-	"fmt"
 	"github.com/go-playground/validator/v10"
+	"net/http"
 	"strings"
+	"url-shoter/internal/lib/i18n"
 )
 
 type Response struct {
 	Status string `json:"status"`
 	Error  string `json:"error,omitempty"`
+	Code   Code   `json:"code,omitempty"`
 }
 
 const (
@@ -29,22 +31,38 @@ func Error(msg string) Response {
 	}
 }
 
-func ValidationError(errs validator.ValidationErrors) Response {
+/*
+Fail тело ответа для типизированной ошибки на языке запроса
+*/
+func Fail(r *http.Request, e *APIError) Response {
+	return Response{
+		Status: StatusError,
+		Error:  e.Message(i18n.FromRequest(r)),
+		Code:   e.Code,
+	}
+}
+
+func ValidationError(lang i18n.Lang, errs validator.ValidationErrors) Response {
+	return Response{
+		Status: StatusError,
+		Error:  validationMessage(lang, errs),
+		Code:   CodeValidation,
+	}
+}
+
+func validationMessage(lang i18n.Lang, errs validator.ValidationErrors) string {
 	var errorsMessages []string
 
 	for _, err := range errs {
 		switch err.ActualTag() {
 		case "required":
-			errorsMessages = append(errorsMessages, fmt.Sprintf("поле %s поле не обнаружено", err.Field()))
-		case "url":
-			errorsMessages = append(errorsMessages, fmt.Sprintf("урл %s поле URL не валидно", err.Field()))
+			errorsMessages = append(errorsMessages, i18n.T(lang, i18n.MsgFieldRequired, err.Field()))
+		case "url", "http_url":
+			errorsMessages = append(errorsMessages, i18n.T(lang, i18n.MsgFieldURL, err.Field()))
 		default:
-			errorsMessages = append(errorsMessages, fmt.Sprintf("поле: %s не валидное поле", err.Field()))
+			errorsMessages = append(errorsMessages, i18n.T(lang, i18n.MsgFieldInvalid, err.Field()))
 		}
 	}
 
-	return Response{
-		Status: StatusError,
-		Error:  strings.Join(errorsMessages, ", "),
-	}
+	return strings.Join(errorsMessages, ", ")
 }
@@ -0,0 +1,181 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	"url-shoter/internal/lib/actor"
+	"url-shoter/internal/storage"
+)
+
+/*
+Действия с ссылками, попадающие в журнал
+*/
+const (
+	ActionCreate    = "create"
+	ActionEditAlias = "edit_alias"
+	ActionDelete    = "delete"
+	ActionRestore   = "restore"
+	ActionImport    = "import"
+	ActionPurge     = "purge"     // окончательное удаление из корзины
+	ActionOverwrite = "overwrite" // удаление записи, которую заменил импорт
+)
+
+/*
+Entry запись журнала. Before и After - состояние ссылки до и после изменения в JSON,
+пусто при создании и удалении соответственно. LinkID 0 - действие не над одной ссылкой (импорт)
+*/
+type Entry struct {
+	ID        int64           `json:"id"`
+	LinkID    int64           `json:"link_id,omitempty"`
+	Actor     string          `json:"actor"`
+	Action    string          `json:"action"`
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+	RequestID string          `json:"request_id,omitempty"`
+	IP        string          `json:"ip,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+/*
+Filter отбор записей журнала, пустые поля не ограничивают выборку, To не включается
+*/
+type Filter struct {
+	LinkID int64
+	Actor  string
+	From   time.Time
+	To     time.Time
+	Limit  int
+}
+
+/*
+View вид ссылки в журнале, обычно тот же, что отдаёт API. nil - ссылка пишется как она хранится в базе
+*/
+type View func(data storage.URLData) any
+
+/*
+Logger источник записей журнала для обработчиков. Сами записи делает хранилище в транзакции изменения
+по Trail: журнал только дополняется, и изменение без записи в журнале не фиксируется
+*/
+type Logger struct {
+	view View
+}
+
+func New(view View) *Logger {
+	return &Logger{view: view}
+}
+
+/*
+Source откуда пришло действие: кто, с каким id запроса и с какого адреса
+*/
+type Source struct {
+	Actor     string
+	RequestID string
+	IP        string
+}
+
+/*
+Trail записи журнала от имени HTTP запроса r. nil Logger даёт nil Trail, журнал не ведётся
+*/
+func (l *Logger) Trail(r *http.Request) *Trail {
+	if l == nil {
+		return nil
+	}
+
+	return l.TrailFrom(Source{
+		Actor:     actor.FromRequest(r),
+		RequestID: middleware.GetReqID(r.Context()),
+		IP:        actor.IP(r),
+	})
+}
+
+/*
+TrailFrom записи журнала от источника, который уже известен, для вызовов не по HTTP
+*/
+func (l *Logger) TrailFrom(src Source) *Trail {
+	if l == nil {
+		return nil
+	}
+
+	return &Trail{src: src, view: l.view}
+}
+
+/*
+Trail строит записи журнала для хранилища: хранилище передаёт состояние ссылки из своей транзакции
+и пишет запись в ней же. Ошибка построения или записи откатывает изменение
+*/
+type Trail struct {
+	src  Source
+	view View
+}
+
+/*
+Link запись действия action над ссылкой, before и after - состояние до и после изменения, nil - нет состояния
+*/
+func (t *Trail) Link(action string, before *storage.URLData, after *storage.URLData) (Entry, error) {
+	var linkID int64
+	var beforeView, afterView any
+	if before != nil {
+		linkID, beforeView = before.Id, t.present(*before)
+	}
+	if after != nil {
+		linkID, afterView = after.Id, t.present(*after)
+	}
+
+	return t.entry(action, linkID, beforeView, afterView)
+}
+
+/*
+Summary запись действия не над одной ссылкой (импорт), summary - итог действия
+*/
+func (t *Trail) Summary(action string, summary any) (Entry, error) {
+	return t.entry(action, 0, nil, summary)
+}
+
+func (t *Trail) present(data storage.URLData) any {
+	if t.view == nil {
+		return data
+	}
+	return t.view(data)
+}
+
+func (t *Trail) entry(action string, linkID int64, before any, after any) (Entry, error) {
+	const op = "lib.audit.Trail"
+
+	entry := Entry{
+		LinkID:    linkID,
+		Actor:     t.src.Actor,
+		Action:    action,
+		RequestID: t.src.RequestID,
+		IP:        t.src.IP,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	var err error
+	if entry.Before, err = snapshot(before); err != nil {
+		return entry, fmt.Errorf("%s: %s: %w", op, action, err)
+	}
+	if entry.After, err = snapshot(after); err != nil {
+		return entry, fmt.Errorf("%s: %s: %w", op, action, err)
+	}
+
+	return entry, nil
+}
+
+// snapshot состояние в JSON, nil и nil указатель дают пустое состояние
+func snapshot(v any) (json.RawMessage, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil || string(data) == "null" {
+		return nil, err
+	}
+
+	return data, nil
+}
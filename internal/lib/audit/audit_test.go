@@ -0,0 +1,65 @@
+package audit
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"url-shoter/internal/lib/actor"
+	"url-shoter/internal/storage"
+)
+
+func TestTrailLink(t *testing.T) {
+	logger := New(func(data storage.URLData) any {
+		return map[string]string{"alias": data.Alias}
+	})
+
+	req := httptest.NewRequest("POST", "/url/edit", nil)
+	req.RemoteAddr = "10.0.0.1:5555"
+	ctx := context.WithValue(req.Context(), middleware.RequestIDKey, "req-1")
+	req = req.WithContext(actor.WithName(ctx, "ci"))
+
+	trail := logger.Trail(req)
+	entry, err := trail.Link(ActionEditAlias, &storage.URLData{Id: 7, Alias: "old"}, &storage.URLData{Id: 7, Alias: "new"})
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(7), entry.LinkID)
+	assert.Equal(t, "key:ci", entry.Actor)
+	assert.Equal(t, ActionEditAlias, entry.Action)
+	assert.JSONEq(t, `{"alias":"old"}`, string(entry.Before))
+	assert.JSONEq(t, `{"alias":"new"}`, string(entry.After))
+	assert.Equal(t, "req-1", entry.RequestID)
+	assert.Equal(t, "10.0.0.1", entry.IP)
+	assert.False(t, entry.CreatedAt.IsZero())
+
+	entry, err = trail.Link(ActionDelete, &storage.URLData{Id: 7, Alias: "new"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), entry.LinkID)
+	assert.Nil(t, entry.After)
+}
+
+func TestTrailWithoutView(t *testing.T) {
+	trail := New(nil).TrailFrom(Source{Actor: "system:purge"})
+
+	entry, err := trail.Link(ActionPurge, &storage.URLData{Id: 3, Alias: "gone",
+		Options: storage.Options{PasswordHash: "$2a$hash"}}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "system:purge", entry.Actor)
+	assert.Contains(t, string(entry.Before), `"alias":"gone"`)
+	assert.NotContains(t, string(entry.Before), "$2a$hash")
+
+	entry, err = trail.Summary(ActionImport, map[string]int{"created": 2})
+	require.NoError(t, err)
+	assert.Zero(t, entry.LinkID)
+	assert.JSONEq(t, `{"created":2}`, string(entry.After))
+}
+
+func TestNilLogger(t *testing.T) {
+	var logger *Logger
+	assert.Nil(t, logger.Trail(httptest.NewRequest("DELETE", "/url/1", nil)))
+	assert.Nil(t, logger.TrailFrom(Source{}))
+}
@@ -0,0 +1,95 @@
+package blocklist
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+/*
+List домены назначения, переход на которые идёт через страницу предупреждения. Домен из списка
+совпадает сам и со всеми своими поддоменами, регистр и точка в конце не учитываются
+*/
+type List struct {
+	hosts map[string]struct{}
+}
+
+/*
+New список по доменам, пустые строки пропускаются
+*/
+func New(hosts []string) *List {
+	l := &List{hosts: make(map[string]struct{}, len(hosts))}
+	for _, host := range hosts {
+		host = normalize(host)
+		if host == "" {
+			continue
+		}
+		l.hosts[host] = struct{}{}
+	}
+
+	return l
+}
+
+/*
+Load домены из файла: по домену в строке, пустые строки и строки с # пропускаются
+*/
+func Load(path string) ([]string, error) {
+	const op = "lib.blocklist.Load"
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer file.Close()
+
+	var hosts []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		hosts = append(hosts, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return hosts, nil
+}
+
+/*
+Unsafe адрес ведёт на домен из списка или его поддомен. Неразбираемый адрес считается безопасным:
+его уже проверили при сохранении, а решение о переходе остаётся за редиректом
+*/
+func (l *List) Unsafe(rawURL string) bool {
+	if l == nil || len(l.hosts) == 0 {
+		return false
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+
+	host := normalize(u.Hostname())
+	for host != "" {
+		if _, ok := l.hosts[host]; ok {
+			return true
+		}
+
+		_, parent, found := strings.Cut(host, ".")
+		if !found {
+			break
+		}
+		host = parent
+	}
+
+	return false
+}
+
+func normalize(host string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+}
@@ -0,0 +1,43 @@
+package blocklist
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnsafe(t *testing.T) {
+	list := New([]string{"Evil.example.", " phish.test ", ""})
+
+	cases := []struct {
+		url  string
+		want bool
+	}{
+		{"https://evil.example/login", true},
+		{"https://cdn.EVIL.example:8443/x", true},
+		{"http://phish.test", true},
+		{"https://notevil.example", false},
+		{"https://example", false},
+		{"https://google.com/?u=evil.example", false},
+		{"::bad", false},
+	}
+
+	for _, tc := range cases {
+		assert.Equal(t, tc.want, list.Unsafe(tc.url), tc.url)
+	}
+
+	var empty *List
+	assert.False(t, empty.Unsafe("https://evil.example"))
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts.txt")
+	require.NoError(t, os.WriteFile(path, []byte("# фишинг\nevil.example\n\n  phish.test  \n"), 0o600))
+
+	hosts, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"evil.example", "phish.test"}, hosts)
+}
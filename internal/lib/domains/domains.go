@@ -0,0 +1,130 @@
+package domains
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+var ErrDomainNotAllowed = errors.New("domain not allowed")
+
+/*
+Resolver домены коротких ссылок.
+В хранилище домен по умолчанию записывается пустой строкой, чтобы смена домена по умолчанию
+в конфиге не ломала уже выданные ссылки.
+*/
+type Resolver struct {
+	baseURL       string
+	defaultDomain string
+	scheme        string
+	allowed       map[string]struct{}
+}
+
+/*
+New создание резолвера. Если задан публичный baseURL, ссылки домена по умолчанию строятся от него
+(с учётом пути, например https://example.com/s), а его хост считается доменом по умолчанию.
+*/
+func New(baseURL string, defaultDomain string, list []string, scheme string) (*Resolver, error) {
+	allowed := make(map[string]struct{}, len(list))
+	for _, d := range list {
+		allowed[normalize(d)] = struct{}{}
+	}
+
+	if scheme == "" {
+		scheme = "http"
+	}
+
+	if baseURL != "" {
+		u, err := url.Parse(baseURL)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("некорректный base_url %q", baseURL)
+		}
+		defaultDomain = u.Host
+		baseURL = strings.TrimSuffix(baseURL, "/")
+	}
+
+	return &Resolver{
+		baseURL:       baseURL,
+		defaultDomain: normalize(defaultDomain),
+		scheme:        scheme,
+		allowed:       allowed,
+	}, nil
+}
+
+/*
+Key домен для хранилища по домену из запроса на сохранение.
+Пустой домен и домен по умолчанию дают пустую строку, домен не из списка - ErrDomainNotAllowed.
+*/
+func (r *Resolver) Key(domain string) (string, error) {
+	domain = normalize(domain)
+	if domain == "" || domain == r.defaultDomain {
+		return "", nil
+	}
+
+	if _, ok := r.allowed[domain]; !ok {
+		return "", ErrDomainNotAllowed
+	}
+
+	return domain, nil
+}
+
+/*
+FromHost домен для хранилища по заголовку Host редиректа.
+Хост ищется как есть и без порта, неизвестные хосты обслуживаются доменом по умолчанию.
+*/
+func (r *Resolver) FromHost(host string) string {
+	host = normalize(host)
+
+	candidates := []string{host}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		candidates = append(candidates, h)
+	}
+
+	for _, c := range candidates {
+		if c == r.defaultDomain {
+			return ""
+		}
+		if _, ok := r.allowed[c]; ok {
+			return c
+		}
+	}
+
+	return ""
+}
+
+/*
+ShortURL полная короткая ссылка по домену из хранилища и алиасу
+*/
+func (r *Resolver) ShortURL(domain string, alias string) string {
+	if domain == "" {
+		return r.base() + "/" + url.PathEscape(alias)
+	}
+
+	return r.scheme + "://" + domain + "/" + url.PathEscape(alias)
+}
+
+/*
+QRCodeURL ссылка на QR код короткой ссылки, отдаётся API на основном домене
+*/
+func (r *Resolver) QRCodeURL(domain string, alias string) string {
+	qr := r.base() + "/url/" + url.PathEscape(alias) + "/qr"
+	if domain != "" {
+		qr += "?domain=" + url.QueryEscape(domain)
+	}
+
+	return qr
+}
+
+func (r *Resolver) base() string {
+	if r.baseURL != "" {
+		return r.baseURL
+	}
+
+	return r.scheme + "://" + r.defaultDomain
+}
+
+func normalize(domain string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+}
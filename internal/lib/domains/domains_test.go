@@ -0,0 +1,51 @@
+package domains
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolver(t *testing.T) {
+	r, err := New("", "sho.rt", []string{"Brand.io", "go.brand.io:8443"}, "https")
+	assert.NoError(t, err)
+
+	key, err := r.Key("")
+	assert.NoError(t, err)
+	assert.Equal(t, "", key)
+
+	key, err = r.Key("SHO.RT")
+	assert.NoError(t, err)
+	assert.Equal(t, "", key)
+
+	key, err = r.Key("brand.io")
+	assert.NoError(t, err)
+	assert.Equal(t, "brand.io", key)
+
+	_, err = r.Key("evil.com")
+	assert.ErrorIs(t, err, ErrDomainNotAllowed)
+
+	assert.Equal(t, "brand.io", r.FromHost("brand.io:443"))
+	assert.Equal(t, "go.brand.io:8443", r.FromHost("go.brand.io:8443"))
+	assert.Equal(t, "", r.FromHost("sho.rt"))
+	assert.Equal(t, "", r.FromHost("localhost:8082"))
+
+	assert.Equal(t, "https://sho.rt/abc", r.ShortURL("", "abc"))
+	assert.Equal(t, "https://brand.io/a%20b", r.ShortURL("brand.io", "a b"))
+	assert.Equal(t, "https://sho.rt/url/abc/qr?domain=brand.io", r.QRCodeURL("brand.io", "abc"))
+}
+
+func TestResolverBaseURL(t *testing.T) {
+	r, err := New("https://example.com/s/", "sho.rt", nil, "http")
+	assert.NoError(t, err)
+
+	key, err := r.Key("example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "", key)
+
+	assert.Equal(t, "https://example.com/s/abc", r.ShortURL("", "abc"))
+	assert.Equal(t, "https://example.com/s/url/abc/qr", r.QRCodeURL("", "abc"))
+
+	_, err = New("example.com", "", nil, "")
+	assert.Error(t, err)
+}
@@ -0,0 +1,139 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"url-shoter/internal/lib/webhook"
+)
+
+/*
+Типы событий потока. Изменения ссылок пишет в outbox триггер urls_outbox, переходы - RecordClick
+*/
+const (
+	TypeLinkCreated    = webhook.EventLinkCreated
+	TypeLinkUpdated    = webhook.EventLinkUpdated
+	TypeLinkDeleted    = webhook.EventLinkDeleted
+	TypeLinkExpired    = webhook.EventLinkExpired
+	TypeClickMilestone = webhook.EventClickMilestone
+	TypeLinkClicked    = "link.clicked" // в вебхуки не попадает
+)
+
+/*
+Версии схем data по типам событий. Несовместимое изменение схемы - новая версия и новый subject,
+старая версия продолжает публиковаться, пока потребители не перейдут
+*/
+var Versions = map[string]int{
+	TypeLinkCreated:    1,
+	TypeLinkUpdated:    1,
+	TypeLinkDeleted:    1,
+	TypeLinkExpired:    1,
+	TypeClickMilestone: 1,
+	TypeLinkClicked:    1,
+}
+
+/*
+Record запись outbox в том виде, в каком её отдаёт хранилище
+*/
+type Record struct {
+	ID        int64
+	Type      string
+	LinkID    int64
+	Payload   json.RawMessage
+	CreatedAt time.Time
+}
+
+/*
+Event конверт события потока. ID совпадает с id записи outbox и не меняется при повторной публикации,
+по нему потребители отбрасывают дубли
+*/
+type Event struct {
+	ID         int64           `json:"id"`
+	Type       string          `json:"type"`
+	Version    int             `json:"version"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	LinkID     int64           `json:"link_id"`
+	Data       json.RawMessage `json:"data"`
+}
+
+/*
+Subject имя темы события: <prefix>.link.created.v1
+*/
+func (e Event) Subject(prefix string) string {
+	return fmt.Sprintf("%s.%s.v%d", prefix, e.Type, e.Version)
+}
+
+/*
+LinkV1 ссылка в событиях link.*. Новые колонки urls сюда не попадают без новой версии схемы
+*/
+type LinkV1 struct {
+	ID        int64      `json:"id"`
+	Alias     string     `json:"alias"`
+	Domain    string     `json:"domain"`
+	URL       string     `json:"url"`
+	Title     string     `json:"title"`
+	Campaign  string     `json:"campaign"`
+	Clicks    int64      `json:"clicks"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	DeletedAt *time.Time `json:"deleted_at"`
+	DeletedBy string     `json:"deleted_by"`
+}
+
+/*
+LinkEventV1 data событий link.*, Milestone заполнен только у link.clicks_milestone
+*/
+type LinkEventV1 struct {
+	Link      LinkV1 `json:"link"`
+	Milestone int64  `json:"milestone,omitempty"`
+}
+
+/*
+ClickV1 data события link.clicked, Variant -1 у ссылок без A/B теста
+*/
+type ClickV1 struct {
+	LinkID  int64  `json:"link_id"`
+	Alias   string `json:"alias"`
+	Domain  string `json:"domain"`
+	Variant int    `json:"variant"`
+}
+
+/*
+FromRecord событие потока из записи outbox. Payload приводится к схеме своей версии,
+поэтому лишние поля из строки таблицы наружу не уходят
+*/
+func FromRecord(rec Record) (Event, error) {
+	const op = "lib.events.FromRecord"
+
+	version, ok := Versions[rec.Type]
+	if !ok {
+		return Event{}, fmt.Errorf("%s: неизвестный тип события %q", op, rec.Type)
+	}
+
+	var data any
+	switch rec.Type {
+	case TypeLinkClicked:
+		data = &ClickV1{}
+	default:
+		data = &LinkEventV1{}
+	}
+
+	if err := json.Unmarshal(rec.Payload, data); err != nil {
+		return Event{}, fmt.Errorf("%s: событие %d: %w", op, rec.ID, err)
+	}
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, fmt.Errorf("%s: событие %d: %w", op, rec.ID, err)
+	}
+
+	return Event{
+		ID:         rec.ID,
+		Type:       rec.Type,
+		Version:    version,
+		OccurredAt: rec.CreatedAt,
+		LinkID:     rec.LinkID,
+		Data:       raw,
+	}, nil
+}
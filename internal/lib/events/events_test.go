@@ -0,0 +1,152 @@
+package events
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"url-shoter/internal/lib/logger/handlers/slogdiscard"
+)
+
+func TestFromRecord(t *testing.T) {
+	at := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	event, err := FromRecord(Record{
+		ID:     7,
+		Type:   TypeLinkCreated,
+		LinkID: 3,
+		// лишние колонки таблицы в схему v1 не входят
+		Payload:   json.RawMessage(`{"link":{"id":3,"alias":"go","domain":"","url":"https://go.dev","created_at":"2024-05-01T10:00:00.5+00:00","rules":[],"sticky":""}}`),
+		CreatedAt: at,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(7), event.ID)
+	assert.Equal(t, 1, event.Version)
+	assert.Equal(t, at, event.OccurredAt)
+	assert.Equal(t, "url_shortener.link.created.v1", event.Subject("url_shortener"))
+	assert.NotContains(t, string(event.Data), "rules")
+	assert.NotContains(t, string(event.Data), "milestone")
+	assert.Contains(t, string(event.Data), `"alias":"go"`)
+
+	click, err := FromRecord(Record{ID: 8, Type: TypeLinkClicked, Payload: json.RawMessage(`{"link_id":3,"alias":"go","domain":"","variant":-1}`)})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"link_id":3,"alias":"go","domain":"","variant":-1}`, string(click.Data))
+
+	_, err = FromRecord(Record{ID: 9, Type: "link.viewed", Payload: json.RawMessage(`{}`)})
+	assert.Error(t, err)
+
+	_, err = FromRecord(Record{ID: 10, Type: TypeLinkDeleted, Payload: json.RawMessage(`not json`)})
+	assert.Error(t, err)
+}
+
+func TestWriterPublisher(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewWriterPublisher(&buf)
+
+	require.NoError(t, p.Publish(context.Background(), []Event{
+		{ID: 1, Type: TypeLinkCreated, Version: 1, Data: json.RawMessage(`{}`)},
+		{ID: 2, Type: TypeLinkClicked, Version: 1, Data: json.RawMessage(`{}`)},
+	}))
+	require.NoError(t, p.Close())
+
+	var ids []int64
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var e Event
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &e))
+		ids = append(ids, e.ID)
+	}
+	assert.Equal(t, []int64{1, 2}, ids)
+}
+
+// fakeStore outbox в памяти, отметка как в хранилище - только после успешного handle
+type fakeStore struct {
+	pending []Record
+}
+
+func (f *fakeStore) MarkExpiredLinks() (int64, error) { return 0, nil }
+
+func (f *fakeStore) ConsumeStreamEvents(limit int, handle func([]Record) error) (int, error) {
+	batch := f.pending[:min(limit, len(f.pending))]
+	if len(batch) == 0 {
+		return 0, nil
+	}
+	if err := handle(batch); err != nil {
+		return 0, err
+	}
+	f.pending = f.pending[len(batch):]
+	return len(batch), nil
+}
+
+type fakePublisher struct {
+	fail      bool
+	published []int64
+	events    []Event
+}
+
+func (f *fakePublisher) Publish(_ context.Context, events []Event) error {
+	if f.fail {
+		return errors.New("брокер недоступен")
+	}
+	for _, e := range events {
+		f.published = append(f.published, e.ID)
+	}
+	f.events = append(f.events, events...)
+	return nil
+}
+
+func (f *fakePublisher) Close() error { return nil }
+
+func TestRelayTick(t *testing.T) {
+	link := json.RawMessage(`{"link":{"id":1}}`)
+	records := []Record{
+		{ID: 1, Type: TypeLinkCreated, Payload: link},
+		{ID: 2, Type: "link.unknown", Payload: link},
+		{ID: 3, Type: TypeLinkUpdated, Payload: link},
+		{ID: 4, Type: TypeLinkDeleted, Payload: link},
+	}
+	cfg := RelayConfig{Interval: time.Second, BatchSize: 2, Timeout: time.Second}
+
+	t.Run("Broker down", func(t *testing.T) {
+		store := &fakeStore{pending: records}
+		NewRelay(slogdiscard.NewDiscardLogger(), store, &fakePublisher{fail: true}, cfg).Tick(context.Background())
+
+		assert.Len(t, store.pending, len(records))
+	})
+
+	t.Run("Drains outbox", func(t *testing.T) {
+		store := &fakeStore{pending: records}
+		publisher := &fakePublisher{}
+		NewRelay(slogdiscard.NewDiscardLogger(), store, publisher, cfg).Tick(context.Background())
+
+		assert.Empty(t, store.pending)
+		assert.Equal(t, []int64{1, 3, 4}, publisher.published)
+	})
+
+	t.Run("Purged link", func(t *testing.T) {
+		// запись триггера на удаление строки: ссылка из OLD, уже побывавшая в корзине
+		store := &fakeStore{pending: []Record{{ID: 5, Type: TypeLinkDeleted, LinkID: 9,
+			Payload: json.RawMessage(`{"link":{"id":9,"alias":"old","domain":"","url":"https://go.dev","clicks":3,
+				"deleted_at":"2024-04-01T10:00:00+00:00","deleted_by":"key:ci","rules":null,"variants":null}}`)}}}
+		publisher := &fakePublisher{}
+		NewRelay(slogdiscard.NewDiscardLogger(), store, publisher, cfg).Tick(context.Background())
+
+		assert.Empty(t, store.pending)
+		require.Len(t, publisher.events, 1)
+
+		event := publisher.events[0]
+		assert.Equal(t, TypeLinkDeleted, event.Type)
+		assert.Equal(t, int64(9), event.LinkID)
+		assert.Equal(t, "url_shortener.link.deleted.v1", event.Subject("url_shortener"))
+		assert.Contains(t, string(event.Data), `"deleted_by":"key:ci"`)
+		assert.NotContains(t, string(event.Data), "variants")
+	})
+}
@@ -0,0 +1,98 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+/*
+Заголовки сообщения в брокере, тело - Event целиком
+*/
+const (
+	HeaderType    = "Event-Type"
+	HeaderVersion = "Event-Version"
+)
+
+/*
+NATSConfig Stream - поток JetStream, создаётся или обновляется при подключении на subjects <SubjectPrefix>.>,
+пустой - поток уже настроен снаружи
+*/
+type NATSConfig struct {
+	URL           string
+	Stream        string
+	SubjectPrefix string
+	Timeout       time.Duration
+}
+
+/*
+NATSPublisher публикация в NATS JetStream с подтверждением каждого сообщения. Id события уходит в
+Nats-Msg-Id, поэтому повтор пачки в пределах окна дедупликации потока не создаёт дублей
+*/
+type NATSPublisher struct {
+	nc     *nats.Conn
+	js     jetstream.JetStream
+	prefix string
+}
+
+func NewNATSPublisher(cfg NATSConfig) (*NATSPublisher, error) {
+	const op = "lib.events.NewNATSPublisher"
+
+	nc, err := nats.Connect(cfg.URL, nats.Name("url-shoter-events"), nats.Timeout(cfg.Timeout), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, fmt.Errorf("%s: не удалось подключиться к %s: %w", op, cfg.URL, err)
+	}
+
+	js, err := jetstream.New(nc)
+	if err != nil {
+		nc.Close()
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if cfg.Stream != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
+		defer cancel()
+
+		_, err = js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+			Name:     cfg.Stream,
+			Subjects: []string{cfg.SubjectPrefix + ".>"},
+		})
+		if err != nil {
+			nc.Close()
+			return nil, fmt.Errorf("%s: не удалось настроить поток %s: %w", op, cfg.Stream, err)
+		}
+	}
+
+	return &NATSPublisher{nc: nc, js: js, prefix: cfg.SubjectPrefix}, nil
+}
+
+func (p *NATSPublisher) Publish(ctx context.Context, events []Event) error {
+	const op = "lib.events.NATSPublisher.Publish"
+
+	for _, event := range events {
+		body, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("%s: событие %d: %w", op, event.ID, err)
+		}
+
+		msg := nats.NewMsg(event.Subject(p.prefix))
+		msg.Data = body
+		msg.Header.Set(HeaderType, event.Type)
+		msg.Header.Set(HeaderVersion, strconv.Itoa(event.Version))
+
+		if _, err := p.js.PublishMsg(ctx, msg, jetstream.WithMsgID(strconv.FormatInt(event.ID, 10))); err != nil {
+			return fmt.Errorf("%s: событие %d: %w", op, event.ID, err)
+		}
+	}
+
+	return nil
+}
+
+func (p *NATSPublisher) Close() error {
+	return p.nc.Drain()
+}
@@ -0,0 +1,123 @@
+package events
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"url-shoter/internal/lib/logger/sl"
+)
+
+/*
+Publisher отправка событий в поток. Ошибка означает, что ни одно событие пачки не считается
+опубликованным: пачка будет отправлена ещё раз целиком
+*/
+type Publisher interface {
+	Publish(ctx context.Context, events []Event) error
+	Close() error
+}
+
+type Store interface {
+	MarkExpiredLinks() (int64, error)
+	// ConsumeStreamEvents передаёт handle до limit неопубликованных записей outbox и отмечает их
+	// только если handle вернул nil
+	ConsumeStreamEvents(limit int, handle func([]Record) error) (int, error)
+}
+
+/*
+RelayConfig Interval - период опроса outbox, Timeout - ожидание публикации одной пачки
+*/
+type RelayConfig struct {
+	Interval  time.Duration
+	BatchSize int
+	Timeout   time.Duration
+}
+
+/*
+Relay перенос событий из outbox в Publisher. Доставка "хотя бы один раз": запись outbox отмечается
+после успешной публикации, при падении между ними пачка уйдёт повторно с теми же id
+*/
+type Relay struct {
+	log       *slog.Logger
+	store     Store
+	publisher Publisher
+	cfg       RelayConfig
+}
+
+func NewRelay(log *slog.Logger, store Store, publisher Publisher, cfg RelayConfig) *Relay {
+	return &Relay{
+		log:       log.With(slog.String("component", "events/relay")),
+		store:     store,
+		publisher: publisher,
+		cfg:       cfg,
+	}
+}
+
+/*
+Run обработка каждые Interval до отмены ctx, после отмены Publisher закрывается
+*/
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.cfg.Interval)
+	defer ticker.Stop()
+	defer func() {
+		if err := r.publisher.Close(); err != nil {
+			r.log.Error("не удалось закрыть поток событий", sl.Err(err))
+		}
+	}()
+
+	for {
+		r.Tick(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+/*
+Tick публикация накопившихся событий пачками по BatchSize, пока outbox не опустеет или публикация не откажет
+*/
+func (r *Relay) Tick(ctx context.Context) {
+	if _, err := r.store.MarkExpiredLinks(); err != nil {
+		r.log.Error("не удалось отметить истёкшие ссылки", sl.Err(err))
+	}
+
+	for ctx.Err() == nil {
+		n, err := r.store.ConsumeStreamEvents(r.cfg.BatchSize, func(records []Record) error {
+			return r.publish(ctx, records)
+		})
+		if err != nil {
+			r.log.Error("не удалось опубликовать события", sl.Err(err))
+			return
+		}
+		if n > 0 {
+			r.log.Debug("события опубликованы", slog.Int("count", n))
+		}
+		if n < r.cfg.BatchSize {
+			return
+		}
+	}
+}
+
+func (r *Relay) publish(ctx context.Context, records []Record) error {
+	events := make([]Event, 0, len(records))
+	for _, rec := range records {
+		event, err := FromRecord(rec)
+		if err != nil {
+			// такая запись не станет корректной при повторе и остановила бы весь поток
+			r.log.Error("событие пропущено", slog.Int64("id", rec.ID), sl.Err(err))
+			continue
+		}
+		events = append(events, event)
+	}
+	if len(events) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.cfg.Timeout)
+	defer cancel()
+
+	return r.publisher.Publish(ctx, events)
+}
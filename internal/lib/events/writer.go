@@ -0,0 +1,70 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+/*
+WriterPublisher события построчно в JSON (NDJSON) для локального запуска: в файл или в stdout
+*/
+type WriterPublisher struct {
+	w    io.Writer
+	file *os.File // nil для stdout, файл синхронизируется на диск и закрывается
+}
+
+func NewWriterPublisher(w io.Writer) *WriterPublisher {
+	return &WriterPublisher{w: w}
+}
+
+/*
+NewFilePublisher дозапись событий в файл path, "" или "-" - stdout
+*/
+func NewFilePublisher(path string) (*WriterPublisher, error) {
+	const op = "lib.events.NewFilePublisher"
+
+	if path == "" || path == "-" {
+		return NewWriterPublisher(os.Stdout), nil
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &WriterPublisher{w: file, file: file}, nil
+}
+
+func (p *WriterPublisher) Publish(_ context.Context, events []Event) error {
+	const op = "lib.events.WriterPublisher.Publish"
+
+	buf := bufio.NewWriter(p.w)
+	enc := json.NewEncoder(buf)
+	for _, event := range events {
+		if err := enc.Encode(event); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	if err := buf.Flush(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if p.file != nil {
+		if err := p.file.Sync(); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return nil
+}
+
+func (p *WriterPublisher) Close() error {
+	if p.file != nil {
+		return p.file.Close()
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package geoip
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+/*
+DB офлайн база GeoIP в формате MMDB (GeoLite2-Country, GeoIP2-City и совместимые)
+*/
+type DB struct {
+	reader *maxminddb.Reader
+}
+
+type record struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+}
+
+func Open(path string) (*DB, error) {
+	const op = "lib.geoip.Open"
+
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &DB{reader: reader}, nil
+}
+
+/*
+Country ISO код страны адреса, пустая строка если адреса нет в базе
+*/
+func (d *DB) Country(ip net.IP) (string, error) {
+	var rec record
+	if err := d.reader.Lookup(ip, &rec); err != nil {
+		return "", fmt.Errorf("lib.geoip.Country: %w", err)
+	}
+
+	return rec.Country.ISOCode, nil
+}
+
+func (d *DB) Close() error {
+	return d.reader.Close()
+}
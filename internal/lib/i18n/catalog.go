@@ -0,0 +1,220 @@
+package i18n
+
+/*
+Key ключ сообщения в каталоге
+*/
+type Key string
+
+const (
+	MsgInvalidJSON         Key = "invalid_json"
+	MsgFieldRequired       Key = "field_required"
+	MsgFieldURL            Key = "field_url"
+	MsgFieldInvalid        Key = "field_invalid"
+	MsgExpiryInPast        Key = "expiry_in_past"
+	MsgDomainNotAllowed    Key = "domain_not_allowed"
+	MsgAliasExists         Key = "alias_exists"
+	MsgURLExists           Key = "url_exists"
+	MsgCreateFailed        Key = "create_failed"
+	MsgBatchTooLarge       Key = "batch_too_large"
+	MsgBatchDuplicateAlias Key = "batch_duplicate_alias"
+	MsgBatchExists         Key = "batch_exists"
+	MsgNotFound            Key = "not_found"
+	MsgURLExpired          Key = "url_expired"
+	MsgInternal            Key = "internal"
+	MsgInvalidID           Key = "invalid_id"
+	MsgIDNotFound          Key = "id_not_found"
+	MsgDeleteFailed        Key = "delete_failed"
+	MsgURLDeleted          Key = "url_deleted"
+	MsgURLUnsafe           Key = "url_unsafe"
+	MsgNotInTrash          Key = "not_in_trash"
+	MsgRestoreFailed       Key = "restore_failed"
+	MsgAPIKeyRequired      Key = "api_key_required"
+	MsgAPIKeyInvalid       Key = "api_key_invalid"
+	MsgAuditFilter         Key = "audit_filter"
+	MsgWebhookEvent        Key = "webhook_event"
+	MsgWebhookFailed       Key = "webhook_failed"
+	MsgWebhookNotFound     Key = "webhook_not_found"
+	MsgDeliveryNotDead     Key = "delivery_not_dead"
+	MsgInvalidPageToken    Key = "invalid_page_token"
+	MsgEditAliasFailed     Key = "edit_alias_failed"
+	MsgListFailed          Key = "list_failed"
+	MsgExportFormat        Key = "export_format"
+	MsgImportFormat        Key = "import_format"
+	MsgConflictMode        Key = "conflict_mode"
+	MsgInvalidDryRun       Key = "invalid_dry_run"
+	MsgImportConflict      Key = "import_conflict"
+	MsgImportFailed        Key = "import_failed"
+	MsgQROptions           Key = "qr_options"
+	MsgQRFailed            Key = "qr_failed"
+	MsgStatsFailed         Key = "stats_failed"
+	MsgPasswordRequired    Key = "password_required"
+	MsgPasswordInvalid     Key = "password_invalid"
+	MsgPasswordTooLong     Key = "password_too_long"
+	MsgTooManyAttempts     Key = "too_many_attempts"
+	MsgRateLimited         Key = "rate_limited"
+	MsgInvalidLimit        Key = "invalid_limit"
+	MsgInvalidFirst        Key = "invalid_first"
+	MsgAliasNotAllowed     Key = "alias_not_allowed"
+	MsgAliasLength         Key = "alias_length"
+	MsgAliasCharset        Key = "alias_charset"
+	MsgAliasCase           Key = "alias_case"
+
+	MsgPageNotFoundTitle   Key = "page_not_found_title"
+	MsgPageNotFoundText    Key = "page_not_found_text"
+	MsgPageExpiredTitle    Key = "page_expired_title"
+	MsgPageExpiredText     Key = "page_expired_text"
+	MsgPageDisabledTitle   Key = "page_disabled_title"
+	MsgPageDisabledText    Key = "page_disabled_text"
+	MsgPageMalwareTitle    Key = "page_malware_title"
+	MsgPageMalwareText     Key = "page_malware_text"
+	MsgPageMalwareContinue Key = "page_malware_continue"
+	MsgPagePreviewTitle    Key = "page_preview_title"
+	MsgPagePreviewText     Key = "page_preview_text"
+	MsgPagePreviewContinue Key = "page_preview_continue"
+	MsgPagePasswordTitle   Key = "page_password_title"
+	MsgPagePasswordText    Key = "page_password_text"
+	MsgPagePasswordSubmit  Key = "page_password_submit"
+)
+
+var catalog = map[Lang]map[Key]string{
+	RU: {
+		MsgInvalidJSON:         "не удалось расшифровать запрос",
+		MsgFieldRequired:       "поле %s поле не обнаружено",
+		MsgFieldURL:            "урл %s поле URL не валидно",
+		MsgFieldInvalid:        "поле: %s не валидное поле",
+		MsgExpiryInPast:        "срок жизни ссылки уже истёк",
+		MsgDomainNotAllowed:    "домен не разрешён",
+		MsgAliasExists:         "alias уже существует",
+		MsgURLExists:           "url уже существует",
+		MsgCreateFailed:        "не удалось создать URL",
+		MsgBatchTooLarge:       "превышен максимальный размер пачки: %d",
+		MsgBatchDuplicateAlias: "alias повторяется в пачке",
+		MsgBatchExists:         "alias или id уже существует",
+		MsgNotFound:            "не обнаружено",
+		MsgURLExpired:          "срок жизни ссылки истёк",
+		MsgInternal:            "Другая ошибка",
+		MsgInvalidID:           "id должен быть целым числом",
+		MsgIDNotFound:          "ссылка с таким id не найдена",
+		MsgDeleteFailed:        "не удалось удалить url",
+		MsgURLDeleted:          "ссылка удалена",
+		MsgURLUnsafe:           "ссылка ведёт на сайт из списка опасных",
+		MsgNotInTrash:          "ссылки с таким id нет в корзине",
+		MsgRestoreFailed:       "не удалось восстановить url",
+		MsgAPIKeyRequired:      "нужен API ключ в заголовке X-API-Key",
+		MsgAPIKeyInvalid:       "неизвестный API ключ",
+		MsgAuditFilter:         "некорректный фильтр %s",
+		MsgWebhookEvent:        "неизвестное событие %s",
+		MsgWebhookFailed:       "не удалось сохранить подписку",
+		MsgWebhookNotFound:     "подписка не найдена",
+		MsgDeliveryNotDead:     "доставки с таким id нет среди недоставленных",
+		MsgInvalidPageToken:    "некорректный токен страницы",
+		MsgEditAliasFailed:     "не удалось сменить алиас",
+		MsgListFailed:          "Данные по урлам не обнаружены",
+		MsgExportFormat:        "неизвестный формат, доступны csv, json, ndjson",
+		MsgImportFormat:        "неизвестный формат импорта",
+		MsgConflictMode:        "неизвестный режим конфликта, доступны skip, overwrite, fail",
+		MsgInvalidDryRun:       "некорректное значение dry_run",
+		MsgImportConflict:      "импорт прерван: alias или id уже существует",
+		MsgImportFailed:        "не удалось импортировать URL",
+		MsgQROptions:           "некорректные параметры QR кода, допустимы format (png, svg), size (64-2048), level (L, M, Q, H), margin (0-16), fg, bg",
+		MsgQRFailed:            "не удалось сформировать QR код",
+		MsgStatsFailed:         "не удалось получить статистику",
+		MsgPasswordRequired:    "ссылка защищена паролем",
+		MsgPasswordInvalid:     "неверный пароль",
+		MsgPasswordTooLong:     "пароль длиннее %d байт, символ кириллицы занимает два байта",
+		MsgTooManyAttempts:     "слишком много неверных попыток, повторите позже",
+		MsgRateLimited:         "слишком много запросов, повторите позже",
+		MsgInvalidLimit:        "limit должен быть числом от 1 до %d",
+		MsgInvalidFirst:        "first должен быть числом от 1 до %d",
+		MsgAliasNotAllowed:     "такой alias использовать нельзя",
+		MsgAliasLength:         "длина alias должна быть от %d до %d символов",
+		MsgAliasCharset:        "alias может содержать только символы [%s]",
+		MsgAliasCase:           "alias должен быть в нижнем регистре",
+
+		MsgPageNotFoundTitle:   "Ссылка не найдена",
+		MsgPageNotFoundText:    "Такой короткой ссылки нет. Проверьте адрес или обратитесь к тому, кто её прислал.",
+		MsgPageExpiredTitle:    "Срок действия ссылки истёк",
+		MsgPageExpiredText:     "Эта короткая ссылка больше не работает: её срок действия закончился.",
+		MsgPageDisabledTitle:   "Ссылка отключена",
+		MsgPageDisabledText:    "Эта короткая ссылка отключена и больше не ведёт на сайт.",
+		MsgPageMalwareTitle:    "Опасный сайт",
+		MsgPageMalwareText:     "Сайт, на который ведёт ссылка, может быть опасен: распространять вредоносные программы или выманивать данные.",
+		MsgPageMalwareContinue: "Всё равно перейти",
+		MsgPagePreviewTitle:    "Куда ведёт ссылка",
+		MsgPagePreviewText:     "Короткая ссылка ведёт на этот адрес. Убедитесь, что доверяете ему, прежде чем переходить.",
+		MsgPagePreviewContinue: "Перейти",
+		MsgPagePasswordTitle:   "Ссылка защищена паролем",
+		MsgPagePasswordText:    "Чтобы перейти по ссылке, введите пароль.",
+		MsgPagePasswordSubmit:  "Открыть",
+	},
+	EN: {
+		MsgInvalidJSON:         "failed to decode request",
+		MsgFieldRequired:       "field %s is required",
+		MsgFieldURL:            "field %s is not a valid URL",
+		MsgFieldInvalid:        "field %s is invalid",
+		MsgExpiryInPast:        "expiration time is in the past",
+		MsgDomainNotAllowed:    "domain is not allowed",
+		MsgAliasExists:         "alias already exists",
+		MsgURLExists:           "url already exists",
+		MsgCreateFailed:        "failed to create URL",
+		MsgBatchTooLarge:       "batch exceeds maximum size: %d",
+		MsgBatchDuplicateAlias: "alias is duplicated in batch",
+		MsgBatchExists:         "alias or id already exists",
+		MsgNotFound:            "not found",
+		MsgURLExpired:          "link has expired",
+		MsgInternal:            "internal error",
+		MsgInvalidID:           "id must be an integer",
+		MsgIDNotFound:          "no link with this id",
+		MsgDeleteFailed:        "failed to delete url",
+		MsgURLDeleted:          "link has been deleted",
+		MsgURLUnsafe:           "link leads to a site on the unsafe list",
+		MsgNotInTrash:          "no deleted link with this id",
+		MsgRestoreFailed:       "failed to restore url",
+		MsgAPIKeyRequired:      "API key required in X-API-Key header",
+		MsgAPIKeyInvalid:       "unknown API key",
+		MsgAuditFilter:         "invalid filter %s",
+		MsgWebhookEvent:        "unknown event %s",
+		MsgWebhookFailed:       "failed to save webhook",
+		MsgWebhookNotFound:     "webhook not found",
+		MsgDeliveryNotDead:     "no dead delivery with this id",
+		MsgInvalidPageToken:    "invalid page token",
+		MsgEditAliasFailed:     "failed to change alias",
+		MsgListFailed:          "failed to list urls",
+		MsgExportFormat:        "unknown format, available: csv, json, ndjson",
+		MsgImportFormat:        "unknown import format",
+		MsgConflictMode:        "unknown conflict mode, available: skip, overwrite, fail",
+		MsgInvalidDryRun:       "invalid dry_run value",
+		MsgImportConflict:      "import aborted: alias or id already exists",
+		MsgImportFailed:        "failed to import URLs",
+		MsgQROptions:           "invalid QR code options, allowed: format (png, svg), size (64-2048), level (L, M, Q, H), margin (0-16), fg, bg",
+		MsgQRFailed:            "failed to render QR code",
+		MsgStatsFailed:         "failed to load statistics",
+		MsgPasswordRequired:    "link is password protected",
+		MsgPasswordInvalid:     "wrong password",
+		MsgPasswordTooLong:     "password is longer than %d bytes, non-ASCII characters take several bytes each",
+		MsgTooManyAttempts:     "too many wrong attempts, try again later",
+		MsgRateLimited:         "too many requests, try again later",
+		MsgInvalidLimit:        "limit must be a number from 1 to %d",
+		MsgInvalidFirst:        "first must be a number from 1 to %d",
+		MsgAliasNotAllowed:     "this alias is not allowed",
+		MsgAliasLength:         "alias must be from %d to %d characters long",
+		MsgAliasCharset:        "alias may only contain characters [%s]",
+		MsgAliasCase:           "alias must be lower case",
+
+		MsgPageNotFoundTitle:   "Link not found",
+		MsgPageNotFoundText:    "This short link does not exist. Check the address or ask whoever sent it to you.",
+		MsgPageExpiredTitle:    "Link expired",
+		MsgPageExpiredText:     "This short link no longer works: it has expired.",
+		MsgPageDisabledTitle:   "Link disabled",
+		MsgPageDisabledText:    "This short link has been disabled and no longer leads anywhere.",
+		MsgPageMalwareTitle:    "Dangerous site",
+		MsgPageMalwareText:     "The site this link leads to may be harmful: it may spread malware or try to steal your data.",
+		MsgPageMalwareContinue: "Continue anyway",
+		MsgPagePreviewTitle:    "Where this link goes",
+		MsgPagePreviewText:     "This short link leads to the address below. Make sure you trust it before you continue.",
+		MsgPagePreviewContinue: "Continue",
+		MsgPagePasswordTitle:   "Password protected link",
+		MsgPagePasswordText:    "Enter the password to open this link.",
+		MsgPagePasswordSubmit:  "Open",
+	},
+}
@@ -0,0 +1,109 @@
+package i18n
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+/*
+Lang язык сообщений API
+*/
+type Lang string
+
+const (
+	RU Lang = "ru"
+	EN Lang = "en"
+)
+
+/*
+DefaultLang язык, если ни middleware, ни Accept-Language его не определили
+*/
+const DefaultLang = RU
+
+var ErrUnknownLang = errors.New("unknown language")
+
+// порядок совпадает с тегами matcher
+var supported = []Lang{RU, EN}
+
+var matcher = language.NewMatcher([]language.Tag{language.Russian, language.English})
+
+/*
+ParseLang разбор языка из конфига, пустая строка означает DefaultLang
+*/
+func ParseLang(s string) (Lang, error) {
+	switch Lang(strings.ToLower(s)) {
+	case "":
+		return DefaultLang, nil
+	case RU:
+		return RU, nil
+	case EN:
+		return EN, nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnknownLang, s)
+	}
+}
+
+/*
+Match выбор языка по заголовку Accept-Language, def если подходящего языка нет
+*/
+func Match(acceptLanguage string, def Lang) Lang {
+	tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(tags) == 0 {
+		return def
+	}
+
+	_, idx, confidence := matcher.Match(tags...)
+	if confidence == language.No {
+		return def
+	}
+
+	return supported[idx]
+}
+
+type ctxKey struct{}
+
+func WithLang(ctx context.Context, lang Lang) context.Context {
+	return context.WithValue(ctx, ctxKey{}, lang)
+}
+
+/*
+FromRequest язык запроса: выбранный middleware, иначе по Accept-Language
+*/
+func FromRequest(r *http.Request) Lang {
+	return FromContext(r.Context(), Match(r.Header.Get("Accept-Language"), DefaultLang))
+}
+
+/*
+FromContext язык, сохранённый WithLang, иначе def
+*/
+func FromContext(ctx context.Context, def Lang) Lang {
+	if lang, ok := ctx.Value(ctxKey{}).(Lang); ok {
+		return lang
+	}
+
+	return def
+}
+
+/*
+T сообщение из каталога, при отсутствии перевода берётся русский вариант, затем сам ключ
+*/
+func T(lang Lang, key Key, args ...any) string {
+	msg, ok := catalog[lang][key]
+	if !ok {
+		msg, ok = catalog[DefaultLang][key]
+	}
+	if !ok {
+		msg = string(key)
+	}
+
+	if len(args) > 0 {
+		return fmt.Sprintf(msg, args...)
+	}
+
+	return msg
+}
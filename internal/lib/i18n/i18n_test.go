@@ -0,0 +1,59 @@
+package i18n
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatch(t *testing.T) {
+	cases := []struct {
+		header string
+		def    Lang
+		want   Lang
+	}{
+		{"", RU, RU},
+		{"", EN, EN},
+		{"en-US,en;q=0.9", RU, EN},
+		{"ru-RU", EN, RU},
+		{"de-DE, en;q=0.5", RU, EN},
+		{"fr, ru;q=0.3, en;q=0.8", RU, EN},
+		{"de", EN, EN},
+		{"de", RU, RU},
+		{"not a header;;", EN, EN},
+	}
+
+	for _, tc := range cases {
+		assert.Equal(t, tc.want, Match(tc.header, tc.def), "%q", tc.header)
+	}
+}
+
+func TestParseLang(t *testing.T) {
+	lang, err := ParseLang("")
+	require.NoError(t, err)
+	assert.Equal(t, DefaultLang, lang)
+
+	lang, err = ParseLang("EN")
+	require.NoError(t, err)
+	assert.Equal(t, EN, lang)
+
+	_, err = ParseLang("de")
+	assert.ErrorIs(t, err, ErrUnknownLang)
+}
+
+func TestCatalogComplete(t *testing.T) {
+	for _, lang := range supported {
+		require.Len(t, catalog[lang], len(catalog[DefaultLang]), lang)
+
+		for key := range catalog[DefaultLang] {
+			assert.NotEmpty(t, catalog[lang][key], "%s: нет перевода %s", lang, key)
+		}
+	}
+}
+
+func TestT(t *testing.T) {
+	assert.Equal(t, "batch exceeds maximum size: 5", T(EN, MsgBatchTooLarge, 5))
+	assert.Equal(t, "превышен максимальный размер пачки: 5", T(RU, MsgBatchTooLarge, 5))
+	assert.Equal(t, "unknown_key", T(EN, Key("unknown_key")))
+}
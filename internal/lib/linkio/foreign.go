@@ -0,0 +1,648 @@
+package linkio
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"url-shoter/internal/storage"
+)
+
+/*
+Форматы выгрузок других сокращателей ссылок, только для загрузки
+*/
+const (
+	FormatBitlyCSV   = "bitly-csv"
+	FormatBitlyJSON  = "bitly-json"
+	FormatYOURLSCSV  = "yourls-csv"
+	FormatYOURLSJSON = "yourls-json"
+	FormatYOURLSSQL  = "yourls-sql"
+)
+
+/*
+fieldMapping имена полей чужой выгрузки для каждого поля нашей ссылки, в порядке приоритета.
+Имена сравниваются без учёта регистра.
+*/
+type fieldMapping struct {
+	alias   []string
+	url     []string
+	title   []string
+	clicks  []string
+	created []string
+}
+
+var bitlyFields = fieldMapping{
+	alias:   []string{"keyword", "custom bitlink", "bitlink", "short link", "short_url", "link", "id"},
+	url:     []string{"long url", "long_url", "destination url", "original url", "url"},
+	title:   []string{"title"},
+	clicks:  []string{"clicks", "total clicks", "total_clicks", "user clicks"},
+	created: []string{"created", "created_at", "date created", "creation date", "timestamp"},
+}
+
+var yourlsFields = fieldMapping{
+	alias:   []string{"keyword", "shorturl", "short_url"},
+	url:     []string{"url", "long_url"},
+	title:   []string{"title"},
+	clicks:  []string{"clicks"},
+	created: []string{"timestamp", "created_at"},
+}
+
+/*
+yourlsColumns порядок колонок таблицы yourls_url, если в INSERT не перечислены колонки
+*/
+var yourlsColumns = []string{"keyword", "url", "title", "timestamp", "ip", "clicks"}
+
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05-0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"1/2/2006 15:04:05",
+	"1/2/2006 15:04",
+	"1/2/2006",
+	"Jan 2, 2006",
+}
+
+/*
+newForeignReader читатель выгрузки другого сервиса, nil если формат не из их числа
+*/
+func newForeignReader(format string, r io.Reader) (Reader, error) {
+	switch format {
+	case FormatBitlyCSV:
+		return newForeignCSVReader(r, bitlyFields)
+	case FormatYOURLSCSV:
+		return newForeignCSVReader(r, yourlsFields)
+	case FormatBitlyJSON:
+		return newForeignJSONReader(r, bitlyFields)
+	case FormatYOURLSJSON:
+		return newForeignJSONReader(r, yourlsFields)
+	case FormatYOURLSSQL:
+		return &sqlDumpReader{tok: &sqlTokenizer{r: bufio.NewReader(r)}, mapping: yourlsFields}, nil
+	default:
+		return nil, nil
+	}
+}
+
+/*
+mapRecord перенос полей чужой записи в нашу ссылку, алиас сохраняется в точности как был
+*/
+func mapRecord(m fieldMapping, record map[string]string) (storage.URLData, error) {
+	var data storage.URLData
+
+	data.Alias = aliasFromLink(pick(record, m.alias))
+	data.Url = pick(record, m.url)
+	data.Title = pick(record, m.title)
+
+	if v := pick(record, m.clicks); v != "" {
+		clicks, err := strconv.ParseInt(strings.NewReplacer(",", "", " ", "").Replace(v), 10, 64)
+		if err != nil {
+			return data, fmt.Errorf("некорректное число переходов %q: %w", v, err)
+		}
+		data.Clicks = clicks
+	}
+
+	if v := pick(record, m.created); v != "" {
+		createdAt, err := parseTime(v)
+		if err != nil {
+			return data, err
+		}
+		data.CreatedAt = createdAt
+	}
+
+	return data, nil
+}
+
+func pick(record map[string]string, names []string) string {
+	for _, name := range names {
+		if v := strings.TrimSpace(record[name]); v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
+
+/*
+aliasFromLink из короткой ссылки вида https://bit.ly/3abcDE или bit.ly/3abcDE берётся последний сегмент пути
+*/
+func aliasFromLink(v string) string {
+	v = strings.TrimSuffix(v, "/")
+	if i := strings.LastIndex(v, "/"); i >= 0 {
+		return v[i+1:]
+	}
+
+	return v
+}
+
+func parseTime(v string) (time.Time, error) {
+	if unix, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(unix, 0).UTC(), nil
+	}
+
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, v); err == nil {
+			return t.UTC(), nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("некорректная дата %q", v)
+}
+
+type foreignCSVReader struct {
+	r       *csv.Reader
+	header  []string
+	mapping fieldMapping
+}
+
+func newForeignCSVReader(r io.Reader, mapping fieldMapping) (Reader, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("не удалось прочитать заголовок csv: %w", err)
+	}
+	for i, name := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+	}
+
+	return &foreignCSVReader{r: cr, header: header, mapping: mapping}, nil
+}
+
+func (f *foreignCSVReader) Read() (storage.URLData, error) {
+	row, err := f.r.Read()
+	if err != nil {
+		return storage.URLData{}, err
+	}
+
+	record := make(map[string]string, len(f.header))
+	for i, name := range f.header {
+		if i < len(row) {
+			record[name] = row[i]
+		}
+	}
+
+	return mapRecord(f.mapping, record)
+}
+
+/*
+foreignJSONReader выгрузки в JSON не имеют общего вида, поэтому документ читается целиком
+и записи ищутся внутри: массив объектов, {"links": [...]}, {"links": {"link_1": {...}}} и т.п.
+*/
+type foreignJSONReader struct {
+	records []map[string]string
+	mapping fieldMapping
+}
+
+func newForeignJSONReader(r io.Reader, mapping fieldMapping) (Reader, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	var records []map[string]string
+	for _, obj := range findRecords(doc, mapping) {
+		record := make(map[string]string, len(obj))
+		for k, v := range obj {
+			record[strings.ToLower(k)] = jsonString(v)
+		}
+		records = append(records, record)
+	}
+
+	return &foreignJSONReader{records: records, mapping: mapping}, nil
+}
+
+func (f *foreignJSONReader) Read() (storage.URLData, error) {
+	if len(f.records) == 0 {
+		return storage.URLData{}, io.EOF
+	}
+
+	record := f.records[0]
+	f.records = f.records[1:]
+
+	return mapRecord(f.mapping, record)
+}
+
+func findRecords(v any, mapping fieldMapping) []map[string]any {
+	switch v := v.(type) {
+	case []any:
+		var records []map[string]any
+		for _, item := range v {
+			if obj, ok := item.(map[string]any); ok {
+				records = append(records, obj)
+			}
+		}
+		return records
+	case map[string]any:
+		if isRecord(v, mapping) {
+			return []map[string]any{v}
+		}
+
+		for _, key := range []string{"links", "link_history", "urls", "data"} {
+			if inner, ok := v[key]; ok {
+				return findRecords(inner, mapping)
+			}
+		}
+
+		// {"link_1": {...}, "link_2": {...}} - записи по ключам, порядок по номеру в ключе
+		keys := make([]string, 0, len(v))
+		for k, item := range v {
+			if obj, ok := item.(map[string]any); ok && isRecord(obj, mapping) {
+				keys = append(keys, k)
+			}
+		}
+		sort.Slice(keys, func(i, j int) bool { return naturalLess(keys[i], keys[j]) })
+
+		records := make([]map[string]any, 0, len(keys))
+		for _, k := range keys {
+			records = append(records, v[k].(map[string]any))
+		}
+		return records
+	default:
+		return nil
+	}
+}
+
+func isRecord(obj map[string]any, mapping fieldMapping) bool {
+	for k := range obj {
+		for _, name := range mapping.url {
+			if strings.EqualFold(k, name) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func jsonString(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return ""
+	}
+}
+
+/*
+naturalLess сравнение строк с учётом числового суффикса: link_2 < link_10
+*/
+func naturalLess(a, b string) bool {
+	na, ea := trailingNumber(a)
+	nb, eb := trailingNumber(b)
+	if ea == nil && eb == nil && strings.TrimRight(a, "0123456789") == strings.TrimRight(b, "0123456789") {
+		return na < nb
+	}
+
+	return a < b
+}
+
+func trailingNumber(s string) (int, error) {
+	return strconv.Atoi(s[len(strings.TrimRight(s, "0123456789")):])
+}
+
+/*
+sqlDumpReader чтение INSERT выражений в таблицу *url из SQL дампа (mysqldump, phpMyAdmin).
+Дамп читается потоково, остальные выражения пропускаются.
+*/
+type sqlDumpReader struct {
+	tok     *sqlTokenizer
+	columns []string // колонки текущего INSERT, nil вне VALUES
+	mapping fieldMapping
+}
+
+func (s *sqlDumpReader) Read() (storage.URLData, error) {
+	if s.columns == nil {
+		if err := s.nextInsert(); err != nil {
+			return storage.URLData{}, err
+		}
+	}
+
+	record, err := s.nextTuple()
+	if err != nil {
+		return storage.URLData{}, err
+	}
+
+	return mapRecord(s.mapping, record)
+}
+
+/*
+nextInsert поиск следующего INSERT в таблицу ссылок, по окончании дампа io.EOF
+*/
+func (s *sqlDumpReader) nextInsert() error {
+statements:
+	for {
+		t, err := s.tok.next()
+		if err != nil {
+			return err
+		}
+		if t.kind != tokWord || !strings.EqualFold(t.text, "INSERT") {
+			if err := s.skipStatement(t); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var table string
+		var columns []string
+		for {
+			t, err = s.tok.next()
+			if err != nil {
+				return unexpectedEOF(err)
+			}
+			if t.kind == tokWord && (strings.EqualFold(t.text, "VALUES") || strings.EqualFold(t.text, "VALUE")) {
+				break
+			}
+			if t.kind == tokPunct && t.text == ";" {
+				// INSERT без VALUES, например INSERT ... SET или INSERT ... SELECT
+				continue statements
+			}
+			if t.kind == tokPunct && t.text == "(" {
+				columns, err = s.columnList()
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			if t.kind == tokWord && t.text != "." && !strings.EqualFold(t.text, "INTO") {
+				table = t.text
+			}
+		}
+
+		if !strings.HasSuffix(strings.ToLower(table), "url") {
+			if err := s.skipStatement(t); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if columns == nil {
+			columns = yourlsColumns
+		}
+		s.columns = columns
+
+		return nil
+	}
+}
+
+func (s *sqlDumpReader) columnList() ([]string, error) {
+	var columns []string
+	for {
+		t, err := s.tok.next()
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		switch {
+		case t.kind == tokPunct && t.text == ")":
+			return columns, nil
+		case t.kind == tokPunct && t.text == ",":
+		default:
+			columns = append(columns, strings.ToLower(t.text))
+		}
+	}
+}
+
+/*
+nextTuple чтение одной группы значений (...), после последней группы выражения columns сбрасывается
+*/
+func (s *sqlDumpReader) nextTuple() (map[string]string, error) {
+	t, err := s.tok.next()
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if t.kind != tokPunct || t.text != "(" {
+		return nil, fmt.Errorf("ожидалась '(' вместо %q", t.text)
+	}
+
+	record := make(map[string]string, len(s.columns))
+	for i := 0; ; i++ {
+		t, err = s.tok.next()
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+
+		value := t.text
+		if t.kind == tokWord && strings.EqualFold(value, "NULL") {
+			value = ""
+		}
+		if i < len(s.columns) {
+			record[s.columns[i]] = value
+		}
+
+		t, err = s.tok.next()
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		if t.kind == tokPunct && t.text == ")" {
+			break
+		}
+		if t.kind != tokPunct || t.text != "," {
+			return nil, fmt.Errorf("ожидалась ',' вместо %q", t.text)
+		}
+	}
+
+	t, err = s.tok.next()
+	if errors.Is(err, io.EOF) {
+		s.columns = nil
+		return record, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if t.kind != tokPunct || t.text != "," {
+		// конец выражения: ';' или хвост вроде ON DUPLICATE KEY UPDATE
+		s.columns = nil
+		if err := s.skipStatement(t); err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+	}
+
+	return record, nil
+}
+
+/*
+skipStatement пропуск токенов до ';' включительно, t - уже прочитанный токен выражения
+*/
+func (s *sqlDumpReader) skipStatement(t sqlToken) error {
+	for t.kind != tokPunct || t.text != ";" {
+		var err error
+		t, err = s.tok.next()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
+
+const (
+	tokWord   = 'w' // ключевое слово, идентификатор, число
+	tokString = 's' // строковый литерал
+	tokPunct  = 'p' // ( ) , ;
+)
+
+type sqlToken struct {
+	kind byte
+	text string
+}
+
+type sqlTokenizer struct {
+	r *bufio.Reader
+}
+
+func (t *sqlTokenizer) next() (sqlToken, error) {
+	for {
+		c, _, err := t.r.ReadRune()
+		if err != nil {
+			return sqlToken{}, err
+		}
+
+		switch {
+		case unicode.IsSpace(c):
+			continue
+		case c == '#':
+			if err := t.skipLine(); err != nil {
+				return sqlToken{}, err
+			}
+			continue
+		case c == '-' && t.peek('-'):
+			if err := t.skipLine(); err != nil {
+				return sqlToken{}, err
+			}
+			continue
+		case c == '/' && t.peek('*'):
+			if err := t.skipBlockComment(); err != nil {
+				return sqlToken{}, err
+			}
+			continue
+		case c == '(' || c == ')' || c == ',' || c == ';':
+			return sqlToken{kind: tokPunct, text: string(c)}, nil
+		case c == '`':
+			text, err := t.quoted('`')
+			return sqlToken{kind: tokWord, text: text}, err
+		case c == '\'' || c == '"':
+			text, err := t.quoted(c)
+			return sqlToken{kind: tokString, text: text}, err
+		default:
+			text, err := t.word(c)
+			return sqlToken{kind: tokWord, text: text}, err
+		}
+	}
+}
+
+func (t *sqlTokenizer) peek(c rune) bool {
+	next, _, err := t.r.ReadRune()
+	if err != nil {
+		return false
+	}
+	if next == c {
+		return true
+	}
+	_ = t.r.UnreadRune()
+
+	return false
+}
+
+func (t *sqlTokenizer) skipLine() error {
+	_, err := t.r.ReadString('\n')
+	return err
+}
+
+func (t *sqlTokenizer) skipBlockComment() error {
+	for {
+		c, _, err := t.r.ReadRune()
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+		if c == '*' && t.peek('/') {
+			return nil
+		}
+	}
+}
+
+/*
+quoted чтение литерала до закрывающей кавычки, поддерживаются удвоенные кавычки и экранирование MySQL
+*/
+func (t *sqlTokenizer) quoted(quote rune) (string, error) {
+	var b strings.Builder
+	for {
+		c, _, err := t.r.ReadRune()
+		if err != nil {
+			return "", unexpectedEOF(err)
+		}
+
+		switch {
+		case c == quote:
+			if t.peek(quote) {
+				b.WriteRune(quote)
+				continue
+			}
+			return b.String(), nil
+		case c == '\\' && quote != '`':
+			e, _, err := t.r.ReadRune()
+			if err != nil {
+				return "", unexpectedEOF(err)
+			}
+			switch e {
+			case 'n':
+				b.WriteRune('\n')
+			case 'r':
+				b.WriteRune('\r')
+			case 't':
+				b.WriteRune('\t')
+			case '0':
+				b.WriteRune(0)
+			case 'Z':
+				b.WriteRune(26)
+			default:
+				b.WriteRune(e)
+			}
+		default:
+			b.WriteRune(c)
+		}
+	}
+}
+
+func (t *sqlTokenizer) word(first rune) (string, error) {
+	var b strings.Builder
+	b.WriteRune(first)
+	for {
+		c, _, err := t.r.ReadRune()
+		if errors.Is(err, io.EOF) {
+			return b.String(), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if unicode.IsSpace(c) || strings.ContainsRune("(),;`'\"", c) {
+			_ = t.r.UnreadRune()
+			return b.String(), nil
+		}
+		b.WriteRune(c)
+	}
+}
@@ -0,0 +1,92 @@
+package linkio
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"url-shoter/internal/storage"
+)
+
+func readAll(t *testing.T, format string, input string) []storage.URLData {
+	t.Helper()
+
+	r, err := NewReader(format, strings.NewReader(input))
+	require.NoError(t, err)
+
+	var got []storage.URLData
+	for {
+		data, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return got
+		}
+		require.NoError(t, err)
+		got = append(got, data)
+	}
+}
+
+func TestForeignFormats(t *testing.T) {
+	created := time.Date(2021, 3, 4, 10, 20, 30, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		format string
+		input  string
+		want   []storage.URLData
+	}{
+		{
+			name:   "YOURLS SQL dump",
+			format: FormatYOURLSSQL,
+			input: "-- MySQL dump\n/*!40101 SET NAMES utf8 */;\n" +
+				"CREATE TABLE `yourls_url` (`keyword` varchar(200) NOT NULL, PRIMARY KEY (`keyword`));\n" +
+				"INSERT INTO `yourls_options` VALUES (1,'version','1.9');\n" +
+				"INSERT INTO `yourls_url` (`keyword`, `url`, `title`, `timestamp`, `ip`, `clicks`) VALUES " +
+				"('AbC','https://google.com/?a=1&b=2','It\\'s ''quoted''','2021-03-04 10:20:30','127.0.0.1',5)," +
+				"('x1','https://ya.ru',NULL,'2021-03-04 10:20:30','::1',0);\n" +
+				"INSERT INTO yourls_url VALUES ('def','https://go.dev','Go','2021-03-04 10:20:30','1.1.1.1',7)\n",
+			want: []storage.URLData{
+				{Alias: "AbC", Url: "https://google.com/?a=1&b=2", Title: "It's 'quoted'", Clicks: 5, CreatedAt: created},
+				{Alias: "x1", Url: "https://ya.ru", CreatedAt: created},
+				{Alias: "def", Url: "https://go.dev", Title: "Go", Clicks: 7, CreatedAt: created},
+			},
+		},
+		{
+			name:   "bit.ly CSV",
+			format: FormatBitlyCSV,
+			input: "\ufeffCreated,Title,Bitlink,Long URL,Clicks\n" +
+				"2021-03-04T10:20:30+0000,Google,https://bit.ly/3xYzAb,https://google.com,\"1,204\"\n",
+			want: []storage.URLData{
+				{Alias: "3xYzAb", Url: "https://google.com", Title: "Google", Clicks: 1204, CreatedAt: created},
+			},
+		},
+		{
+			name:   "bit.ly JSON",
+			format: FormatBitlyJSON,
+			input:  `{"links":[{"id":"bit.ly/Qwe","link":"https://bit.ly/Qwe","long_url":"https://go.dev","title":"Go","created_at":"2021-03-04T10:20:30+0000"}],"pagination":{}}`,
+			want: []storage.URLData{
+				{Alias: "Qwe", Url: "https://go.dev", Title: "Go", CreatedAt: created},
+			},
+		},
+		{
+			name:   "YOURLS JSON stats",
+			format: FormatYOURLSJSON,
+			input: `{"links":{"link_10":{"shorturl":"https://sho.rt/b","url":"https://ya.ru","clicks":"2"},` +
+				`"link_2":{"shorturl":"https://sho.rt/a","url":"https://google.com","timestamp":"2021-03-04 10:20:30","clicks":1}}}`,
+			want: []storage.URLData{
+				{Alias: "a", Url: "https://google.com", Clicks: 1, CreatedAt: created},
+				{Alias: "b", Url: "https://ya.ru", Clicks: 2},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, readAll(t, tt.format, tt.input))
+		})
+	}
+}
@@ -0,0 +1,452 @@
+package linkio
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+	"url-shoter/internal/storage"
+)
+
+/*
+Форматы выгрузки и загрузки ссылок
+*/
+const (
+	FormatCSV    = "csv"
+	FormatJSON   = "json"
+	FormatNDJSON = "ndjson"
+)
+
+var (
+	ErrUnknownFormat = errors.New("unknown format")
+	ErrInvalidRecord = storage.ErrInvalidRecord
+)
+
+// csvHeader колонки csv, rules и variants записываются JSON массивом в одной ячейке
+var csvHeader = []string{"id", "alias", "url", "domain", "title", "clicks", "created_at", "expires_at", "redirect_type", "preview",
+	"forward_query", "forward_path", "campaign", "rules", "variants", "sticky"}
+
+/*
+Option настройка писателя и читателя
+*/
+type Option func(*options)
+
+type options struct {
+	passwordHashes bool
+}
+
+/*
+WithPasswordHashes хеши паролей ссылок пишутся в выгрузку (колонка и поле password_hash) и читаются при загрузке.
+Только для переноса данных через url-admin: HTTP выгрузка доступна клиентам API, и хешам в ней не место
+*/
+func WithPasswordHashes() Option {
+	return func(o *options) {
+		o.passwordHashes = true
+	}
+}
+
+func newOptions(opts []Option) options {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+/*
+record ссылка в JSON выгрузке вместе с хешем пароля, который storage.URLData в JSON не отдаёт
+*/
+type record struct {
+	storage.URLData
+	PasswordHash string `json:"password_hash,omitempty"`
+}
+
+func (o options) encode(data storage.URLData) any {
+	if !o.passwordHashes {
+		return data
+	}
+	return record{URLData: data, PasswordHash: data.PasswordHash}
+}
+
+func (o options) decode(rec record) storage.URLData {
+	data := rec.URLData
+	if o.passwordHashes {
+		data.PasswordHash = rec.PasswordHash
+	}
+	return data
+}
+
+/*
+Writer потоковая запись ссылок, Close дописывает хвост формата и сбрасывает буфер
+*/
+type Writer interface {
+	Write(data storage.URLData) error
+	Close() error
+}
+
+/*
+Reader потоковое чтение ссылок, по окончании данных возвращает io.EOF
+*/
+type Reader interface {
+	Read() (storage.URLData, error)
+}
+
+/*
+ContentType MIME тип для формата
+*/
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	default:
+		return "application/json"
+	}
+}
+
+/*
+FormatByContentType формат по MIME типу тела запроса, по умолчанию json
+*/
+func FormatByContentType(mediaType string) string {
+	switch mediaType {
+	case "text/csv":
+		return FormatCSV
+	case "application/x-ndjson", "application/ndjson":
+		return FormatNDJSON
+	default:
+		return FormatJSON
+	}
+}
+
+/*
+NewWriter создание писателя для формата
+*/
+func NewWriter(format string, w io.Writer, opts ...Option) (Writer, error) {
+	o := newOptions(opts)
+
+	switch format {
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		header := csvHeader
+		if o.passwordHashes {
+			header = append(header[:len(header):len(header)], "password_hash")
+		}
+		if err := cw.Write(header); err != nil {
+			return nil, err
+		}
+		return &csvWriter{w: cw, opts: o}, nil
+	case FormatJSON:
+		return &jsonWriter{w: w, enc: json.NewEncoder(w), opts: o}, nil
+	case FormatNDJSON:
+		return &ndjsonWriter{enc: json.NewEncoder(w), opts: o}, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownFormat, format)
+	}
+}
+
+/*
+NewReader создание читателя для формата
+*/
+func NewReader(format string, r io.Reader, opts ...Option) (Reader, error) {
+	o := newOptions(opts)
+
+	foreign, err := newForeignReader(format, r)
+	if err != nil {
+		return nil, err
+	}
+	if foreign != nil {
+		return &checkedReader{foreign}, nil
+	}
+
+	switch format {
+	case FormatCSV:
+		cr := csv.NewReader(r)
+		header, err := cr.Read()
+		if err != nil {
+			return nil, fmt.Errorf("не удалось прочитать заголовок csv: %w", err)
+		}
+		columns := make(map[string]int, len(header))
+		for i, name := range header {
+			columns[name] = i
+		}
+		for _, name := range []string{"alias", "url"} {
+			if _, ok := columns[name]; !ok {
+				return nil, fmt.Errorf("в заголовке csv нет колонки %s", name)
+			}
+		}
+		return &checkedReader{&csvReader{r: cr, columns: columns, opts: o}}, nil
+	case FormatJSON:
+		dec := json.NewDecoder(r)
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+			return nil, errors.New("ожидается JSON массив")
+		}
+		return &checkedReader{&jsonReader{dec: dec, opts: o}}, nil
+	case FormatNDJSON:
+		return &checkedReader{&ndjsonReader{dec: json.NewDecoder(r), opts: o}}, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownFormat, format)
+	}
+}
+
+/*
+checkedReader отбрасывает записи без alias или url, импортировать их бессмысленно
+*/
+type checkedReader struct {
+	r Reader
+}
+
+func (c *checkedReader) Read() (storage.URLData, error) {
+	data, err := c.r.Read()
+	if err != nil {
+		return data, err
+	}
+
+	if data.Alias == "" || data.Url == "" {
+		return data, fmt.Errorf("%w: пустой alias или url", ErrInvalidRecord)
+	}
+
+	return data, nil
+}
+
+type csvWriter struct {
+	w    *csv.Writer
+	opts options
+}
+
+func (c *csvWriter) Write(data storage.URLData) error {
+	var createdAt, expiresAt string
+	if !data.CreatedAt.IsZero() {
+		createdAt = data.CreatedAt.Format(time.RFC3339)
+	}
+	if data.ExpiresAt != nil {
+		expiresAt = data.ExpiresAt.Format(time.RFC3339)
+	}
+
+	rulesJSON, err := jsonCell(data.Rules)
+	if err != nil {
+		return fmt.Errorf("не удалось записать правила ссылки %d: %w", data.Id, err)
+	}
+	variantsJSON, err := jsonCell(data.Variants)
+	if err != nil {
+		return fmt.Errorf("не удалось записать варианты ссылки %d: %w", data.Id, err)
+	}
+
+	row := []string{
+		strconv.FormatInt(data.Id, 10),
+		data.Alias,
+		data.Url,
+		data.Domain,
+		data.Title,
+		strconv.FormatInt(data.Clicks, 10),
+		createdAt,
+		expiresAt,
+		strconv.Itoa(data.RedirectType),
+		strconv.FormatBool(data.Preview),
+		strconv.FormatBool(data.ForwardQuery),
+		strconv.FormatBool(data.ForwardPath),
+		data.Campaign,
+		rulesJSON,
+		variantsJSON,
+		data.Sticky,
+	}
+	if c.opts.passwordHashes {
+		row = append(row, data.PasswordHash)
+	}
+
+	return c.w.Write(row)
+}
+
+// jsonCell список в JSON для ячейки csv, пустой список - пустая ячейка
+func jsonCell[T any](list []T) (string, error) {
+	if len(list) == 0 {
+		return "", nil
+	}
+
+	data, err := json.Marshal(list)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type jsonWriter struct {
+	w     io.Writer
+	enc   *json.Encoder
+	opts  options
+	count int
+}
+
+func (j *jsonWriter) Write(data storage.URLData) error {
+	sep := ","
+	if j.count == 0 {
+		sep = "["
+	}
+	j.count++
+
+	if _, err := io.WriteString(j.w, sep); err != nil {
+		return err
+	}
+
+	return j.enc.Encode(j.opts.encode(data))
+}
+
+func (j *jsonWriter) Close() error {
+	if j.count == 0 {
+		_, err := io.WriteString(j.w, "[]\n")
+		return err
+	}
+
+	_, err := io.WriteString(j.w, "]\n")
+	return err
+}
+
+type ndjsonWriter struct {
+	enc  *json.Encoder
+	opts options
+}
+
+func (n *ndjsonWriter) Write(data storage.URLData) error {
+	return n.enc.Encode(n.opts.encode(data))
+}
+
+func (n *ndjsonWriter) Close() error {
+	return nil
+}
+
+type csvReader struct {
+	r       *csv.Reader
+	columns map[string]int
+	opts    options
+}
+
+func (c *csvReader) Read() (storage.URLData, error) {
+	record, err := c.r.Read()
+	if err != nil {
+		return storage.URLData{}, err
+	}
+
+	data := storage.URLData{
+		Alias: record[c.columns["alias"]],
+		Url:   record[c.columns["url"]],
+	}
+
+	if i, ok := c.columns["id"]; ok && record[i] != "" {
+		data.Id, err = strconv.ParseInt(record[i], 10, 64)
+		if err != nil {
+			return storage.URLData{}, fmt.Errorf("некорректный id %q: %w", record[i], err)
+		}
+	}
+	if i, ok := c.columns["domain"]; ok {
+		data.Domain = record[i]
+	}
+	if i, ok := c.columns["title"]; ok {
+		data.Title = record[i]
+	}
+	if i, ok := c.columns["clicks"]; ok && record[i] != "" {
+		data.Clicks, err = strconv.ParseInt(record[i], 10, 64)
+		if err != nil {
+			return storage.URLData{}, fmt.Errorf("некорректное число переходов %q: %w", record[i], err)
+		}
+	}
+	if i, ok := c.columns["created_at"]; ok && record[i] != "" {
+		data.CreatedAt, err = time.Parse(time.RFC3339, record[i])
+		if err != nil {
+			return storage.URLData{}, fmt.Errorf("некорректная дата создания %q: %w", record[i], err)
+		}
+	}
+	if i, ok := c.columns["expires_at"]; ok && record[i] != "" {
+		expiresAt, err := time.Parse(time.RFC3339, record[i])
+		if err != nil {
+			return storage.URLData{}, fmt.Errorf("некорректный срок жизни %q: %w", record[i], err)
+		}
+		data.ExpiresAt = &expiresAt
+	}
+	if i, ok := c.columns["redirect_type"]; ok && record[i] != "" {
+		data.RedirectType, err = strconv.Atoi(record[i])
+		if err != nil {
+			return storage.URLData{}, fmt.Errorf("некорректный тип редиректа %q: %w", record[i], err)
+		}
+	}
+	if i, ok := c.columns["preview"]; ok && record[i] != "" {
+		data.Preview, err = strconv.ParseBool(record[i])
+		if err != nil {
+			return storage.URLData{}, fmt.Errorf("некорректный флаг preview %q: %w", record[i], err)
+		}
+	}
+	if i, ok := c.columns["forward_query"]; ok && record[i] != "" {
+		data.ForwardQuery, err = strconv.ParseBool(record[i])
+		if err != nil {
+			return storage.URLData{}, fmt.Errorf("некорректный флаг forward_query %q: %w", record[i], err)
+		}
+	}
+	if i, ok := c.columns["forward_path"]; ok && record[i] != "" {
+		data.ForwardPath, err = strconv.ParseBool(record[i])
+		if err != nil {
+			return storage.URLData{}, fmt.Errorf("некорректный флаг forward_path %q: %w", record[i], err)
+		}
+	}
+	if i, ok := c.columns["campaign"]; ok {
+		data.Campaign = record[i]
+	}
+	if i, ok := c.columns["rules"]; ok && record[i] != "" {
+		if err := json.Unmarshal([]byte(record[i]), &data.Rules); err != nil {
+			return storage.URLData{}, fmt.Errorf("некорректные правила %q: %w", record[i], err)
+		}
+	}
+	if i, ok := c.columns["variants"]; ok && record[i] != "" {
+		if err := json.Unmarshal([]byte(record[i]), &data.Variants); err != nil {
+			return storage.URLData{}, fmt.Errorf("некорректные варианты %q: %w", record[i], err)
+		}
+	}
+	if i, ok := c.columns["sticky"]; ok {
+		data.Sticky = record[i]
+	}
+	if i, ok := c.columns["password_hash"]; ok && c.opts.passwordHashes {
+		data.PasswordHash = record[i]
+	}
+
+	return data, nil
+}
+
+type jsonReader struct {
+	dec  *json.Decoder
+	opts options
+}
+
+func (j *jsonReader) Read() (storage.URLData, error) {
+	if !j.dec.More() {
+		if _, err := j.dec.Token(); err != nil {
+			return storage.URLData{}, err
+		}
+		return storage.URLData{}, io.EOF
+	}
+
+	var rec record
+	err := j.dec.Decode(&rec)
+	return j.opts.decode(rec), err
+}
+
+type ndjsonReader struct {
+	dec  *json.Decoder
+	opts options
+}
+
+func (n *ndjsonReader) Read() (storage.URLData, error) {
+	var rec record
+	err := n.dec.Decode(&rec)
+	return n.opts.decode(rec), err
+}
@@ -0,0 +1,122 @@
+package linkio
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"url-shoter/internal/lib/rules"
+	"url-shoter/internal/lib/variants"
+	"url-shoter/internal/storage"
+)
+
+func TestRoundTrip(t *testing.T) {
+	links := []storage.URLData{
+		{Id: 1, Alias: "abc", Url: "https://google.com"},
+		{Id: 7, Alias: "q,\"x\"", Url: "https://ya.ru/?a=1,2", Domain: "brand.io", Title: "Ya", Clicks: 3,
+			Options: storage.Options{RedirectType: 301, Preview: true, ForwardQuery: true, ForwardPath: true}},
+		{Id: 8, Alias: "ab", Url: "https://shop.example.com/?utm_campaign=spring", Campaign: "spring",
+			Options: storage.Options{
+				Rules:    []rules.Rule{{URL: "https://m.example.com", Platforms: []string{"ios", "android"}, Countries: []string{"DE"}}},
+				Variants: []variants.Variant{{URL: "https://a.example.com", Weight: 3}, {URL: "https://b.example.com", Weight: 1}},
+				Sticky:   "cookie",
+			}},
+	}
+
+	for _, format := range []string{FormatCSV, FormatJSON, FormatNDJSON} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			w, err := NewWriter(format, &buf)
+			require.NoError(t, err)
+			for _, l := range links {
+				require.NoError(t, w.Write(l))
+			}
+			require.NoError(t, w.Close())
+
+			r, err := NewReader(format, &buf)
+			require.NoError(t, err)
+
+			var got []storage.URLData
+			for {
+				data, err := r.Read()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				require.NoError(t, err)
+				got = append(got, data)
+			}
+
+			assert.Equal(t, links, got)
+		})
+	}
+}
+
+func TestEmptyJSON(t *testing.T) {
+	var buf bytes.Buffer
+
+	w, err := NewWriter(FormatJSON, &buf)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	assert.Equal(t, "[]\n", buf.String())
+
+	r, err := NewReader(FormatJSON, &buf)
+	require.NoError(t, err)
+	_, err = r.Read()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestInvalidRecord(t *testing.T) {
+	r, err := NewReader(FormatCSV, strings.NewReader("alias,url\nabc,\n"))
+	require.NoError(t, err)
+
+	_, err = r.Read()
+	assert.ErrorIs(t, err, ErrInvalidRecord)
+
+	_, err = NewReader(FormatCSV, strings.NewReader("id,url\n1,https://google.com\n"))
+	assert.Error(t, err)
+
+	_, err = NewWriter("xml", io.Discard)
+	assert.ErrorIs(t, err, ErrUnknownFormat)
+}
+
+func TestPasswordHashes(t *testing.T) {
+	link := storage.URLData{Id: 1, Alias: "secret", Url: "https://example.com",
+		Options: storage.Options{PasswordHash: "$2a$10$abcdefghijklmnopqrstuv"}}
+
+	for _, format := range []string{FormatCSV, FormatJSON, FormatNDJSON} {
+		t.Run(format, func(t *testing.T) {
+			var public bytes.Buffer
+			w, err := NewWriter(format, &public)
+			require.NoError(t, err)
+			require.NoError(t, w.Write(link))
+			require.NoError(t, w.Close())
+			assert.NotContains(t, public.String(), link.PasswordHash)
+
+			var archive bytes.Buffer
+			w, err = NewWriter(format, &archive, WithPasswordHashes())
+			require.NoError(t, err)
+			require.NoError(t, w.Write(link))
+			require.NoError(t, w.Close())
+			assert.Contains(t, archive.String(), link.PasswordHash)
+
+			r, err := NewReader(format, bytes.NewReader(archive.Bytes()), WithPasswordHashes())
+			require.NoError(t, err)
+			got, err := r.Read()
+			require.NoError(t, err)
+			assert.Equal(t, link.PasswordHash, got.PasswordHash)
+
+			// без опции хеш из файла не принимается
+			r, err = NewReader(format, bytes.NewReader(archive.Bytes()))
+			require.NoError(t, err)
+			got, err = r.Read()
+			require.NoError(t, err)
+			assert.Empty(t, got.PasswordHash)
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package outbox
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"url-shoter/internal/lib/logger/sl"
+)
+
+type Pruner interface {
+	PruneOutbox(before time.Time, consumers []string) (int64, int64, error)
+}
+
+/*
+Once удаление событий outbox старше retention, которые забрали все включённые потребители consumers,
+и завершённых доставок вебхуков старше retention. События для выключенного потребителя его не ждут
+*/
+func Once(log *slog.Logger, pruner Pruner, consumers []string, retention time.Duration, now time.Time) {
+	const op = "lib.outbox.Once"
+
+	events, deliveries, err := pruner.PruneOutbox(now.Add(-retention), consumers)
+	if err != nil {
+		log.Error("не удалось очистить outbox", slog.String("op", op), sl.Err(err))
+		return
+	}
+	if events > 0 || deliveries > 0 {
+		log.Info("outbox очищен", slog.String("op", op), slog.Int64("events", events), slog.Int64("deliveries", deliveries))
+	}
+}
+
+/*
+Run очистка outbox сразу и затем каждые interval до отмены ctx
+*/
+func Run(ctx context.Context, log *slog.Logger, pruner Pruner, consumers []string, retention time.Duration, interval time.Duration) {
+	Once(log, pruner, consumers, retention, time.Now())
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			Once(log, pruner, consumers, retention, now)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"url-shoter/internal/lib/logger/handlers/slogdiscard"
+)
+
+type fakePruner struct {
+	mu        sync.Mutex
+	cutoffs   []time.Time
+	consumers [][]string
+	err       error
+}
+
+func (f *fakePruner) PruneOutbox(before time.Time, consumers []string) (int64, int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.cutoffs = append(f.cutoffs, before)
+	f.consumers = append(f.consumers, consumers)
+	return 2, 1, f.err
+}
+
+func (f *fakePruner) calls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.cutoffs)
+}
+
+func TestOnce(t *testing.T) {
+	pruner := &fakePruner{}
+	now := time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC)
+
+	Once(slogdiscard.NewDiscardLogger(), pruner, []string{"webhooks", "stream"}, 7*24*time.Hour, now)
+
+	require.Len(t, pruner.cutoffs, 1)
+	assert.Equal(t, time.Date(2024, 5, 3, 12, 0, 0, 0, time.UTC), pruner.cutoffs[0])
+	assert.Equal(t, []string{"webhooks", "stream"}, pruner.consumers[0])
+
+	pruner.err = errors.New("boom")
+	Once(slogdiscard.NewDiscardLogger(), pruner, nil, time.Hour, now)
+	assert.Len(t, pruner.cutoffs, 2)
+}
+
+func TestRun(t *testing.T) {
+	pruner := &fakePruner{}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan struct{})
+	go func() {
+		Run(ctx, slogdiscard.NewDiscardLogger(), pruner, []string{"webhooks"}, time.Hour, 10*time.Millisecond)
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool { return pruner.calls() >= 2 }, time.Second, 5*time.Millisecond)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run не остановился после отмены контекста")
+	}
+}
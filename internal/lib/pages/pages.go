@@ -0,0 +1,226 @@
+package pages
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	"url-shoter/internal/lib/i18n"
+)
+
+/*
+State состояние короткой ссылки, для которого показывается страница
+*/
+type State string
+
+const (
+	StateNotFound State = "not-found"
+	StateExpired  State = "expired"
+	StateDisabled State = "disabled"
+	StateMalware  State = "malware-warning"
+	StatePreview  State = "preview"
+	StatePassword State = "password"
+)
+
+var states = []State{StateNotFound, StateExpired, StateDisabled, StateMalware, StatePreview, StatePassword}
+
+const layoutFile = "layout.html"
+
+//go:embed templates/*.html
+var defaults embed.FS
+
+/*
+Data данные страницы, заголовок и текст подставляются Renderer на языке запроса
+*/
+type Data struct {
+	Alias    string
+	ShortURL string
+	URL      string   // адрес назначения, показывается на страницах malware-warning и preview
+	Notice   i18n.Key // дополнительное сообщение, например о неверном пароле
+}
+
+type view struct {
+	Data
+	Lang      i18n.Lang
+	State     State
+	Status    int
+	Title     string
+	Message   string
+	Continue  string
+	Notice    string
+	RequestID string
+}
+
+/*
+Renderer HTML страницы ошибок для браузеров
+*/
+type Renderer struct {
+	templates map[State]*template.Template
+}
+
+/*
+New загрузка шаблонов: файлы <state>.html и layout.html из dir заменяют встроенные,
+пустой dir означает только встроенные шаблоны
+*/
+func New(dir string) (*Renderer, error) {
+	const op = "lib.pages.New"
+
+	layout, err := readTemplate(dir, layoutFile)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	r := &Renderer{templates: make(map[State]*template.Template, len(states))}
+	for _, state := range states {
+		page, err := readTemplate(dir, string(state)+".html")
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		t, err := template.New(layoutFile).Parse(layout)
+		if err == nil {
+			t, err = t.New(string(state)).Parse(page)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: шаблон %s: %w", op, state, err)
+		}
+
+		r.templates[state] = t
+	}
+
+	return r, nil
+}
+
+// readTemplate файл из каталога шаблонов, если его там нет - встроенный
+func readTemplate(dir string, name string) (string, error) {
+	if dir != "" {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err == nil {
+			return string(data), nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+	}
+
+	data, err := defaults.ReadFile("templates/" + name)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+/*
+Render страница состояния state с HTTP статусом status на языке запроса
+*/
+func (p *Renderer) Render(w http.ResponseWriter, r *http.Request, status int, state State, data Data) error {
+	t, ok := p.templates[state]
+	if !ok {
+		return fmt.Errorf("lib.pages.Render: неизвестное состояние %s", state)
+	}
+
+	lang := i18n.FromRequest(r)
+	title, message := texts(state)
+
+	var buf bytes.Buffer
+	err := t.ExecuteTemplate(&buf, string(state), view{
+		Data:      data,
+		Lang:      lang,
+		State:     state,
+		Status:    status,
+		Title:     i18n.T(lang, title),
+		Message:   i18n.T(lang, message),
+		Continue:  i18n.T(lang, continueText(state)),
+		Notice:    notice(lang, data.Notice),
+		RequestID: middleware.GetReqID(r.Context()),
+	})
+	if err != nil {
+		return fmt.Errorf("lib.pages.Render: %w", err)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Add("Vary", "Accept")
+	w.WriteHeader(status)
+	_, err = w.Write(buf.Bytes())
+
+	return err
+}
+
+func texts(state State) (i18n.Key, i18n.Key) {
+	switch state {
+	case StateExpired:
+		return i18n.MsgPageExpiredTitle, i18n.MsgPageExpiredText
+	case StateDisabled:
+		return i18n.MsgPageDisabledTitle, i18n.MsgPageDisabledText
+	case StateMalware:
+		return i18n.MsgPageMalwareTitle, i18n.MsgPageMalwareText
+	case StatePreview:
+		return i18n.MsgPagePreviewTitle, i18n.MsgPagePreviewText
+	case StatePassword:
+		return i18n.MsgPagePasswordTitle, i18n.MsgPagePasswordText
+	default:
+		return i18n.MsgPageNotFoundTitle, i18n.MsgPageNotFoundText
+	}
+}
+
+func continueText(state State) i18n.Key {
+	switch state {
+	case StatePreview:
+		return i18n.MsgPagePreviewContinue
+	case StatePassword:
+		return i18n.MsgPagePasswordSubmit
+	default:
+		return i18n.MsgPageMalwareContinue
+	}
+}
+
+func notice(lang i18n.Lang, key i18n.Key) string {
+	if key == "" {
+		return ""
+	}
+	return i18n.T(lang, key)
+}
+
+/*
+WantsHTML клиент предпочитает HTML, а не JSON: браузеры явно указывают text/html в Accept,
+API клиенты обычно передают application/json, любой тип или ничего
+*/
+func WantsHTML(r *http.Request) bool {
+	var htmlQ, jsonQ float64
+
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+
+		switch mediaType {
+		case "text/html", "application/xhtml+xml":
+			htmlQ = max(htmlQ, q)
+		case "application/json", "application/problem+json":
+			jsonQ = max(jsonQ, q)
+		}
+	}
+
+	return htmlQ > 0 && htmlQ >= jsonQ
+}
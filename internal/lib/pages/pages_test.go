@@ -0,0 +1,93 @@
+package pages
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderDefaults(t *testing.T) {
+	p, err := New("")
+	require.NoError(t, err)
+
+	cases := []struct {
+		state  State
+		status int
+		lang   string
+		want   string
+	}{
+		{StateNotFound, http.StatusNotFound, "ru", "Ссылка не найдена"},
+		{StateNotFound, http.StatusNotFound, "en", "Link not found"},
+		{StateExpired, http.StatusGone, "en", "Link expired"},
+		{StateDisabled, http.StatusGone, "ru", "Ссылка отключена"},
+		{StateMalware, http.StatusForbidden, "en", "Continue anyway"},
+	}
+
+	for _, tc := range cases {
+		t.Run(string(tc.state)+"/"+tc.lang, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/abc", nil)
+			req.Header.Set("Accept-Language", tc.lang)
+			rr := httptest.NewRecorder()
+
+			require.NoError(t, p.Render(rr, req, tc.status, tc.state, Data{
+				Alias:    "abc",
+				ShortURL: "https://sho.rt/abc",
+				URL:      "https://evil.example/<script>",
+			}))
+
+			assert.Equal(t, tc.status, rr.Code)
+			assert.Equal(t, "text/html; charset=utf-8", rr.Header().Get("Content-Type"))
+			assert.Contains(t, rr.Body.String(), tc.want)
+			assert.Contains(t, rr.Body.String(), `lang="`+tc.lang+`"`)
+			assert.NotContains(t, rr.Body.String(), "<script>")
+		})
+	}
+}
+
+func TestTemplateDirOverride(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "expired.html"),
+		[]byte(`{{template "layout" .}}{{define "content"}}<p>brand: {{.Alias}}</p>{{end}}`), 0o644))
+
+	p, err := New(dir)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/abc", nil)
+	rr := httptest.NewRecorder()
+	require.NoError(t, p.Render(rr, req, http.StatusGone, StateExpired, Data{Alias: "abc"}))
+	assert.Contains(t, rr.Body.String(), "brand: abc")
+
+	rr = httptest.NewRecorder()
+	require.NoError(t, p.Render(rr, req, http.StatusNotFound, StateNotFound, Data{}))
+	assert.Contains(t, rr.Body.String(), "Ссылка не найдена")
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "layout.html"), []byte(`{{define "layout"}`), 0o644))
+	_, err = New(dir)
+	assert.Error(t, err)
+}
+
+func TestWantsHTML(t *testing.T) {
+	cases := []struct {
+		accept string
+		want   bool
+	}{
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", true},
+		{"application/json", false},
+		{"*/*", false},
+		{"", false},
+		{"application/json, text/html;q=0.5", false},
+		{"text/html;q=0", false},
+		{"application/problem+json", false},
+	}
+
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/abc", nil)
+		req.Header.Set("Accept", tc.accept)
+		assert.Equal(t, tc.want, WantsHTML(req), tc.accept)
+	}
+}
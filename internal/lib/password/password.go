@@ -0,0 +1,197 @@
+package password
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+/*
+HeaderName заголовок с паролем ссылки для API клиентов, браузеры отправляют пароль формой
+*/
+const HeaderName = "X-Link-Password"
+
+/*
+MaxBytes предел длины пароля bcrypt в байтах. Валидатор считает символы, а кириллица занимает два байта
+*/
+const MaxBytes = 72
+
+/*
+TooLong пароль не помещается в bcrypt
+*/
+func TooLong(plain string) bool {
+	return len(plain) > MaxBytes
+}
+
+/*
+Hash bcrypt хеш пароля для хранения в базе
+*/
+func Hash(plain string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(plain), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+/*
+Verify проверка пароля по хешу
+*/
+func Verify(hash string, plain string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(plain)) == nil
+}
+
+/*
+Guard доступ к ссылкам с паролем: подписанная cookie после верного пароля
+и ограничение неверных попыток по ключу (алиас и IP)
+*/
+type Guard struct {
+	secret      []byte
+	ttl         time.Duration
+	maxAttempts int
+	window      time.Duration
+	now         func() time.Time
+
+	mu       sync.Mutex
+	attempts map[string]*attempt
+}
+
+type attempt struct {
+	count int
+	reset time.Time
+}
+
+/*
+NewGuard cookie живёт ttl, после maxAttempts неверных паролей за window ключ блокируется до конца окна
+*/
+func NewGuard(secret []byte, ttl time.Duration, maxAttempts int, window time.Duration) *Guard {
+	return &Guard{
+		secret:      secret,
+		ttl:         ttl,
+		maxAttempts: maxAttempts,
+		window:      window,
+		now:         time.Now,
+		attempts:    make(map[string]*attempt),
+	}
+}
+
+/*
+Cookie подписанная cookie доступа к ссылке. В подпись входит хеш пароля,
+поэтому смена пароля сразу отзывает выданные cookie
+*/
+func (g *Guard) Cookie(id int64, hash string) *http.Cookie {
+	expires := g.now().Add(g.ttl)
+
+	return &http.Cookie{
+		Name:     cookieName(id),
+		Value:    strconv.FormatInt(expires.Unix(), 10) + "." + g.sign(id, hash, expires.Unix()),
+		Path:     "/",
+		Expires:  expires,
+		MaxAge:   int(g.ttl.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+/*
+Valid в запросе есть действующая cookie доступа к ссылке
+*/
+func (g *Guard) Valid(r *http.Request, id int64, hash string) bool {
+	cookie, err := r.Cookie(cookieName(id))
+	if err != nil {
+		return false
+	}
+
+	expiresRaw, signature, ok := strings.Cut(cookie.Value, ".")
+	if !ok {
+		return false
+	}
+
+	expires, err := strconv.ParseInt(expiresRaw, 10, 64)
+	if err != nil || g.now().Unix() >= expires {
+		return false
+	}
+
+	return hmac.Equal([]byte(signature), []byte(g.sign(id, hash, expires)))
+}
+
+/*
+Blocked ключ исчерпал попытки, возвращает время до разблокировки
+*/
+func (g *Guard) Blocked(key string) (time.Duration, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	a, ok := g.attempts[key]
+	if !ok {
+		return 0, false
+	}
+
+	now := g.now()
+	if !now.Before(a.reset) {
+		delete(g.attempts, key)
+		return 0, false
+	}
+
+	if a.count < g.maxAttempts {
+		return 0, false
+	}
+
+	return a.reset.Sub(now), true
+}
+
+/*
+Fail учёт неверного пароля, окно отсчитывается от первой неудачной попытки
+*/
+func (g *Guard) Fail(key string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	a, ok := g.attempts[key]
+	if !ok || !now.Before(a.reset) {
+		g.sweep(now)
+		a = &attempt{reset: now.Add(g.window)}
+		g.attempts[key] = a
+	}
+
+	a.count++
+}
+
+/*
+Reset сброс счётчика после верного пароля
+*/
+func (g *Guard) Reset(key string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	delete(g.attempts, key)
+}
+
+// sweep удаление истёкших окон, чтобы перебор с разных IP не раздувал память
+func (g *Guard) sweep(now time.Time) {
+	for key, a := range g.attempts {
+		if !now.Before(a.reset) {
+			delete(g.attempts, key)
+		}
+	}
+}
+
+func (g *Guard) sign(id int64, hash string, expires int64) string {
+	mac := hmac.New(sha256.New, g.secret)
+	mac.Write([]byte(strconv.FormatInt(id, 10) + "|" + strconv.FormatInt(expires, 10) + "|" + hash))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func cookieName(id int64) string {
+	return "pw_" + strconv.FormatInt(id, 10)
+}
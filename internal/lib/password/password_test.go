@@ -0,0 +1,66 @@
+package password
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHash(t *testing.T) {
+	hash, err := Hash("secret")
+	require.NoError(t, err)
+
+	assert.True(t, Verify(hash, "secret"))
+	assert.False(t, Verify(hash, "Secret"))
+	assert.False(t, Verify("", "secret"))
+
+	assert.False(t, TooLong(strings.Repeat("a", MaxBytes)))
+	assert.True(t, TooLong(strings.Repeat("я", MaxBytes/2+1)), "длина считается в байтах")
+}
+
+func TestCookie(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	g := NewGuard([]byte("key"), time.Hour, 3, time.Minute)
+	g.now = func() time.Time { return now }
+
+	request := func(c *http.Cookie) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/doc", nil)
+		r.AddCookie(c)
+		return r
+	}
+
+	cookie := g.Cookie(7, "hash")
+	assert.True(t, g.Valid(request(cookie), 7, "hash"))
+	assert.False(t, g.Valid(request(cookie), 7, "new-hash"), "смена пароля отзывает cookie")
+	assert.False(t, g.Valid(request(&http.Cookie{Name: cookie.Name, Value: "9999999999.forged"}), 7, "hash"))
+
+	now = now.Add(2 * time.Hour)
+	assert.False(t, g.Valid(request(cookie), 7, "hash"), "cookie истекла")
+}
+
+func TestAttempts(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	g := NewGuard([]byte("key"), time.Hour, 2, time.Minute)
+	g.now = func() time.Time { return now }
+
+	g.Fail("doc|203.0.113.7")
+	_, blocked := g.Blocked("doc|203.0.113.7")
+	assert.False(t, blocked)
+
+	g.Fail("doc|203.0.113.7")
+	retry, blocked := g.Blocked("doc|203.0.113.7")
+	assert.True(t, blocked)
+	assert.Equal(t, time.Minute, retry)
+
+	_, blocked = g.Blocked("doc|198.51.100.1")
+	assert.False(t, blocked, "другой IP не заблокирован")
+
+	now = now.Add(time.Minute)
+	_, blocked = g.Blocked("doc|203.0.113.7")
+	assert.False(t, blocked, "окно истекло")
+}
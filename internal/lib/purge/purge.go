@@ -0,0 +1,55 @@
+package purge
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"url-shoter/internal/lib/audit"
+	"url-shoter/internal/lib/logger/sl"
+)
+
+/*
+Actor от чьего имени очистка пишет в журнал аудита
+*/
+const Actor = "system:purge"
+
+type Purger interface {
+	PurgeDeleted(before time.Time, trail *audit.Trail) (int64, error)
+}
+
+/*
+Once окончательное удаление ссылок, пролежавших в корзине дольше retention.
+Каждая удалённая ссылка записывается в журнал аудита auditor от имени Actor
+*/
+func Once(log *slog.Logger, purger Purger, auditor *audit.Logger, retention time.Duration, now time.Time) {
+	const op = "lib.purge.Once"
+
+	n, err := purger.PurgeDeleted(now.Add(-retention), auditor.TrailFrom(audit.Source{Actor: Actor}))
+	if err != nil {
+		log.Error("не удалось очистить корзину", slog.String("op", op), sl.Err(err))
+		return
+	}
+	if n > 0 {
+		log.Info("корзина очищена", slog.String("op", op), slog.Int64("purged", n))
+	}
+}
+
+/*
+Run очистка корзины сразу и затем каждые interval до отмены ctx
+*/
+func Run(ctx context.Context, log *slog.Logger, purger Purger, auditor *audit.Logger, retention time.Duration, interval time.Duration) {
+	Once(log, purger, auditor, retention, time.Now())
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			Once(log, purger, auditor, retention, now)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package purge
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"url-shoter/internal/lib/audit"
+	"url-shoter/internal/lib/logger/handlers/slogdiscard"
+	"url-shoter/internal/storage"
+)
+
+type fakePurger struct {
+	mu      sync.Mutex
+	cutoffs []time.Time
+	trails  []*audit.Trail
+	err     error
+}
+
+func (f *fakePurger) PurgeDeleted(before time.Time, trail *audit.Trail) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.cutoffs = append(f.cutoffs, before)
+	f.trails = append(f.trails, trail)
+	return 1, f.err
+}
+
+func (f *fakePurger) calls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.cutoffs)
+}
+
+func TestOnce(t *testing.T) {
+	purger := &fakePurger{}
+	now := time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC)
+
+	Once(slogdiscard.NewDiscardLogger(), purger, audit.New(nil), 30*24*time.Hour, now)
+
+	require.Len(t, purger.cutoffs, 1)
+	assert.Equal(t, time.Date(2024, 4, 10, 12, 0, 0, 0, time.UTC), purger.cutoffs[0])
+
+	entry, err := purger.trails[0].Link(audit.ActionPurge, &storage.URLData{Id: 1}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, Actor, entry.Actor)
+
+	purger.err = errors.New("boom")
+	Once(slogdiscard.NewDiscardLogger(), purger, nil, time.Hour, now)
+	assert.Len(t, purger.cutoffs, 2)
+}
+
+func TestRun(t *testing.T) {
+	purger := &fakePurger{}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan struct{})
+	go func() {
+		Run(ctx, slogdiscard.NewDiscardLogger(), purger, nil, time.Hour, 10*time.Millisecond)
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool { return purger.calls() >= 2 }, time.Second, 5*time.Millisecond)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run не остановился после отмены контекста")
+	}
+}
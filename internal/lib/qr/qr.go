@@ -0,0 +1,238 @@
+package qr
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/skip2/go-qrcode"
+)
+
+const (
+	FormatPNG = "png"
+	FormatSVG = "svg"
+
+	minSize   = 64
+	maxSize   = 2048
+	maxMargin = 16
+)
+
+var ErrInvalidOptions = errors.New("invalid qr options")
+
+/*
+Options параметры QR кода, Size - сторона картинки в пикселях, Margin - поле в модулях
+*/
+type Options struct {
+	Format     string
+	Size       int
+	Level      qrcode.RecoveryLevel
+	Margin     int
+	Foreground color.RGBA
+	Background color.RGBA
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Format:     FormatPNG,
+		Size:       256,
+		Level:      qrcode.Medium,
+		Margin:     4,
+		Foreground: color.RGBA{A: 0xff},
+		Background: color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff},
+	}
+}
+
+/*
+ParseOptions параметры из query: format, size, level (L, M, Q, H), margin, fg, bg (hex цвет: 000, 000000, 000000ff)
+*/
+func ParseOptions(q url.Values) (Options, error) {
+	opts := DefaultOptions()
+
+	if v := q.Get("format"); v != "" {
+		opts.Format = strings.ToLower(v)
+	}
+	if opts.Format != FormatPNG && opts.Format != FormatSVG {
+		return opts, fmt.Errorf("%w: формат %q", ErrInvalidOptions, opts.Format)
+	}
+
+	if v := q.Get("size"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil || size < minSize || size > maxSize {
+			return opts, fmt.Errorf("%w: размер должен быть от %d до %d", ErrInvalidOptions, minSize, maxSize)
+		}
+		opts.Size = size
+	}
+
+	if v := q.Get("margin"); v != "" {
+		margin, err := strconv.Atoi(v)
+		if err != nil || margin < 0 || margin > maxMargin {
+			return opts, fmt.Errorf("%w: поле должно быть от 0 до %d", ErrInvalidOptions, maxMargin)
+		}
+		opts.Margin = margin
+	}
+
+	if v := q.Get("level"); v != "" {
+		switch strings.ToUpper(v) {
+		case "L":
+			opts.Level = qrcode.Low
+		case "M":
+			opts.Level = qrcode.Medium
+		case "Q":
+			opts.Level = qrcode.High
+		case "H":
+			opts.Level = qrcode.Highest
+		default:
+			return opts, fmt.Errorf("%w: уровень коррекции %q", ErrInvalidOptions, v)
+		}
+	}
+
+	var err error
+	if v := q.Get("fg"); v != "" {
+		if opts.Foreground, err = parseColor(v); err != nil {
+			return opts, err
+		}
+	}
+	if v := q.Get("bg"); v != "" {
+		if opts.Background, err = parseColor(v); err != nil {
+			return opts, err
+		}
+	}
+
+	return opts, nil
+}
+
+/*
+Key строка, однозначно описывающая картинку, для ETag
+*/
+func (o Options) Key() string {
+	return fmt.Sprintf("%s|%d|%d|%d|%v|%v", o.Format, o.Size, o.Level, o.Margin, o.Foreground, o.Background)
+}
+
+/*
+ContentType MIME тип картинки
+*/
+func (o Options) ContentType() string {
+	if o.Format == FormatSVG {
+		return "image/svg+xml"
+	}
+
+	return "image/png"
+}
+
+/*
+Encode QR код с содержимым content в формате из opts
+*/
+func Encode(content string, opts Options) ([]byte, error) {
+	code, err := qrcode.New(content, opts.Level)
+	if err != nil {
+		return nil, err
+	}
+	// поле рисуем сами, чтобы его ширина настраивалась
+	code.DisableBorder = true
+
+	bitmap := code.Bitmap()
+
+	if opts.Format == FormatSVG {
+		return encodeSVG(bitmap, opts), nil
+	}
+
+	return encodePNG(bitmap, opts)
+}
+
+func encodePNG(bitmap [][]bool, opts Options) ([]byte, error) {
+	modules := len(bitmap) + 2*opts.Margin
+	scale := opts.Size / modules
+	if scale < 1 {
+		scale = 1
+	}
+	// картинка не меньше запрошенной, модули остаются целыми, остаток уходит в поле
+	side := modules * scale
+	if side < opts.Size {
+		side = opts.Size
+	}
+	offset := (side-modules*scale)/2 + opts.Margin*scale
+
+	img := image.NewPaletted(image.Rect(0, 0, side, side), color.Palette{opts.Background, opts.Foreground})
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if !dark {
+				continue
+			}
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					img.SetColorIndex(offset+x*scale+dx, offset+y*scale+dy, 1)
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func encodeSVG(bitmap [][]bool, opts Options) []byte {
+	modules := len(bitmap) + 2*opts.Margin
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		opts.Size, opts.Size, modules, modules)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="%s"%s/>`, modules, modules, hex(opts.Background), opacity(opts.Background))
+	fmt.Fprintf(&b, `<path fill="%s"%s d="`, hex(opts.Foreground), opacity(opts.Foreground))
+
+	// соседние тёмные модули строки объединяются в один прямоугольник
+	for y, row := range bitmap {
+		for x := 0; x < len(row); x++ {
+			if !row[x] {
+				continue
+			}
+			start := x
+			for x < len(row) && row[x] {
+				x++
+			}
+			fmt.Fprintf(&b, "M%d %dh%dv1h-%dz", start+opts.Margin, y+opts.Margin, x-start, x-start)
+		}
+	}
+
+	b.WriteString(`"/></svg>`)
+
+	return b.Bytes()
+}
+
+func parseColor(v string) (color.RGBA, error) {
+	v = strings.TrimPrefix(v, "#")
+	if len(v) == 3 {
+		v = string([]byte{v[0], v[0], v[1], v[1], v[2], v[2]})
+	}
+	if len(v) == 6 {
+		v += "ff"
+	}
+
+	n, err := strconv.ParseUint(v, 16, 32)
+	if err != nil || len(v) != 8 {
+		return color.RGBA{}, fmt.Errorf("%w: цвет %q", ErrInvalidOptions, v)
+	}
+
+	return color.RGBA{R: uint8(n >> 24), G: uint8(n >> 16), B: uint8(n >> 8), A: uint8(n)}, nil
+}
+
+func hex(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+func opacity(c color.RGBA) string {
+	if c.A == 0xff {
+		return ""
+	}
+
+	return fmt.Sprintf(` fill-opacity="%.3f"`, float64(c.A)/0xff)
+}
@@ -0,0 +1,57 @@
+package qr
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseOptions(t *testing.T) {
+	opts, err := ParseOptions(url.Values{"format": {"SVG"}, "size": {"512"}, "level": {"h"}, "margin": {"0"}, "fg": {"#f00"}, "bg": {"00000000"}})
+	require.NoError(t, err)
+	assert.Equal(t, FormatSVG, opts.Format)
+	assert.Equal(t, 512, opts.Size)
+	assert.Equal(t, 0, opts.Margin)
+	assert.Equal(t, color.RGBA{R: 0xff, A: 0xff}, opts.Foreground)
+	assert.Equal(t, color.RGBA{}, opts.Background)
+
+	for _, q := range []url.Values{
+		{"format": {"gif"}},
+		{"size": {"10"}},
+		{"margin": {"-1"}},
+		{"level": {"X"}},
+		{"fg": {"zzz"}},
+	} {
+		_, err := ParseOptions(q)
+		assert.ErrorIs(t, err, ErrInvalidOptions, q.Encode())
+	}
+}
+
+func TestEncode(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Size = 300
+
+	data, err := Encode("https://sho.rt/abc", opts)
+	require.NoError(t, err)
+
+	img, err := png.Decode(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, 300, img.Bounds().Dx())
+	assert.Equal(t, 300, img.Bounds().Dy())
+
+	// угол попадает в поле, а поисковый узор начинается сразу за ним
+	r, g, b, _ := img.At(0, 0).RGBA()
+	assert.Equal(t, uint32(0xffff), r&g&b)
+
+	opts.Format = FormatSVG
+	data, err = Encode("https://sho.rt/abc", opts)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(data), "<svg"))
+	assert.Contains(t, string(data), `<path fill="#000000" d="M4 4h7v1h-7z`)
+}
@@ -6,9 +6,25 @@ import (
 	"time"
 )
 
+/*
+Алфавиты алиасов: Alphabet по умолчанию, LowerAlphabet для режима без учёта регистра,
+чтобы сгенерированный алиас одинаково читался и набирался
+*/
+const (
+	Alphabet      = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+	LowerAlphabet = "abcdefghijklmnopqrstuvwxyz0123456789"
+)
+
 func NewRandomString(length int64) string {
+	return NewRandomStringFrom(length, Alphabet)
+}
+
+/*
+NewRandomStringFrom случайная строка из символов alphabet
+*/
+func NewRandomStringFrom(length int64, alphabet string) string {
 	rand.Seed(uint64(time.Now().UnixNano()))
-	chars := []rune("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789")
+	chars := []rune(alphabet)
 
 	var b strings.Builder
 
@@ -1,6 +1,7 @@
 package random
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -47,3 +48,13 @@ func TestNewRandomString(t *testing.T) {
 		})
 	}
 }
+
+func TestNewRandomStringFrom(t *testing.T) {
+	str := NewRandomStringFrom(200, LowerAlphabet)
+
+	assert.Len(t, str, 200)
+	assert.Equal(t, strings.ToLower(str), str)
+	for _, c := range str {
+		assert.Contains(t, LowerAlphabet, string(c))
+	}
+}
@@ -0,0 +1,129 @@
+package rules
+
+import (
+	"strings"
+	"time"
+
+	"golang.org/x/text/language"
+)
+
+/*
+Платформы, определяемые по User-Agent
+*/
+const (
+	PlatformIOS     = "ios"
+	PlatformAndroid = "android"
+	PlatformDesktop = "desktop"
+)
+
+/*
+Rule условие перехода на отдельный адрес. Все заданные условия должны выполниться,
+пустое условие подходит любому запросу
+*/
+type Rule struct {
+	URL       string     `json:"url" validate:"required,http_url"`
+	Platforms []string   `json:"platforms,omitempty" validate:"dive,oneof=ios android desktop"`
+	Languages []string   `json:"languages,omitempty" validate:"dive,required"`        // базовые языки, например en, ru
+	Countries []string   `json:"countries,omitempty" validate:"dive,len=2,uppercase"` // ISO 3166-1 alpha-2
+	After     *time.Time `json:"after,omitempty"`                                     // правило действует начиная с этого момента
+	Before    *time.Time `json:"before,omitempty"`                                    // и до этого момента
+}
+
+/*
+Request признаки запроса для проверки правил
+*/
+type Request struct {
+	Platform  string
+	Languages []string // базовые языки из Accept-Language в порядке предпочтения
+	Country   string   // пустая строка если страна неизвестна
+	Now       time.Time
+}
+
+/*
+Match адрес первого подходящего правила, false если ни одно не подошло и нужен адрес ссылки по умолчанию
+*/
+func Match(rules []Rule, req Request) (string, bool) {
+	for _, rule := range rules {
+		if rule.matches(req) {
+			return rule.URL, true
+		}
+	}
+
+	return "", false
+}
+
+func (r Rule) matches(req Request) bool {
+	if len(r.Platforms) > 0 && !contains(r.Platforms, req.Platform) {
+		return false
+	}
+
+	if len(r.Languages) > 0 && !containsAny(r.Languages, req.Languages) {
+		return false
+	}
+
+	// страна неизвестна, например не подключена база GeoIP: правило со страной не подходит
+	if len(r.Countries) > 0 && (req.Country == "" || !contains(r.Countries, req.Country)) {
+		return false
+	}
+
+	if r.After != nil && req.Now.Before(*r.After) {
+		return false
+	}
+	if r.Before != nil && !req.Now.Before(*r.Before) {
+		return false
+	}
+
+	return true
+}
+
+/*
+Platform платформа по заголовку User-Agent, всё что не iOS и не Android считается desktop
+*/
+func Platform(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+
+	switch {
+	case strings.Contains(ua, "iphone"), strings.Contains(ua, "ipad"), strings.Contains(ua, "ipod"):
+		return PlatformIOS
+	case strings.Contains(ua, "android"):
+		return PlatformAndroid
+	default:
+		return PlatformDesktop
+	}
+}
+
+/*
+Languages базовые языки из заголовка Accept-Language в порядке предпочтения
+*/
+func Languages(acceptLanguage string) []string {
+	tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil {
+		return nil
+	}
+
+	languages := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		base, _ := tag.Base()
+		languages = append(languages, base.String())
+	}
+
+	return languages
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAny(list []string, values []string) bool {
+	for _, value := range values {
+		if contains(list, value) {
+			return true
+		}
+	}
+	return false
+}
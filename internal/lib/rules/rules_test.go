@@ -0,0 +1,57 @@
+package rules
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatch(t *testing.T) {
+	now := time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC)
+	before := now.Add(-time.Hour)
+	after := now.Add(time.Hour)
+
+	rules := []Rule{
+		{URL: "https://apps.apple.com/app", Platforms: []string{PlatformIOS}},
+		{URL: "https://play.google.com/app", Platforms: []string{PlatformAndroid}},
+		{URL: "https://example.de", Countries: []string{"DE", "AT"}},
+		{URL: "https://example.com/fr", Languages: []string{"fr"}},
+		{URL: "https://example.com/sale", After: &before, Before: &after},
+	}
+
+	cases := []struct {
+		name string
+		req  Request
+		want string
+		ok   bool
+	}{
+		{"ios", Request{Platform: PlatformIOS, Now: now}, "https://apps.apple.com/app", true},
+		{"android in germany", Request{Platform: PlatformAndroid, Country: "DE", Now: now}, "https://play.google.com/app", true},
+		{"desktop in austria", Request{Platform: PlatformDesktop, Country: "AT", Now: now}, "https://example.de", true},
+		{"french speaker", Request{Platform: PlatformDesktop, Languages: []string{"de", "fr"}, Now: before.Add(-time.Minute)}, "https://example.com/fr", true},
+		{"sale window", Request{Platform: PlatformDesktop, Now: now}, "https://example.com/sale", true},
+		{"sale ended", Request{Platform: PlatformDesktop, Now: after}, "", false},
+		{"unknown country", Request{Platform: PlatformDesktop, Now: after.Add(time.Hour)}, "", false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := Match(rules, tc.req)
+			assert.Equal(t, tc.ok, ok)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestPlatform(t *testing.T) {
+	assert.Equal(t, PlatformIOS, Platform("Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15"))
+	assert.Equal(t, PlatformAndroid, Platform("Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 Chrome/120.0 Mobile"))
+	assert.Equal(t, PlatformDesktop, Platform("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 Chrome/120.0"))
+	assert.Equal(t, PlatformDesktop, Platform(""))
+}
+
+func TestLanguages(t *testing.T) {
+	assert.Equal(t, []string{"en", "de", "ru"}, Languages("en-US,ru;q=0.5,de;q=0.7"))
+	assert.Empty(t, Languages(""))
+}
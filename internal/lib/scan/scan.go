@@ -0,0 +1,149 @@
+package scan
+
+import (
+	"sync"
+	"time"
+)
+
+/*
+Config порог обнаружения перебора алиасов: за Window не меньше MinRequests переходов,
+из которых доля ненайденных не меньше NotFoundRatio
+*/
+type Config struct {
+	Window        time.Duration
+	MinRequests   int
+	NotFoundRatio float64
+	BaseBlock     time.Duration // первая блокировка, каждая следующая вдвое длиннее
+	MaxBlock      time.Duration
+	ResetAfter    time.Duration // после стольких спокойных часов эскалация начинается заново
+}
+
+/*
+Block событие блокировки клиента
+*/
+type Block struct {
+	Client    string    `json:"client"`
+	Level     int       `json:"level"` // номер блокировки подряд, от него зависит длительность
+	Total     int       `json:"total"`
+	NotFound  int       `json:"not_found"`
+	BlockedAt time.Time `json:"blocked_at"`
+	Until     time.Time `json:"until"`
+}
+
+type client struct {
+	windowStart  time.Time
+	total        int
+	notFound     int
+	level        int
+	blockedUntil time.Time
+	lastBlock    time.Time
+}
+
+/*
+Detector счётчики переходов по клиентам в памяти процесса
+*/
+type Detector struct {
+	cfg Config
+	now func() time.Time
+
+	mu      sync.Mutex
+	clients map[string]*client
+}
+
+func New(cfg Config) *Detector {
+	return &Detector{
+		cfg:     cfg,
+		now:     time.Now,
+		clients: make(map[string]*client),
+	}
+}
+
+/*
+Blocked клиент заблокирован, возвращает время до разблокировки
+*/
+func (d *Detector) Blocked(key string) (time.Duration, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	c, ok := d.clients[key]
+	if !ok {
+		return 0, false
+	}
+
+	now := d.now()
+	if !now.Before(c.blockedUntil) {
+		return 0, false
+	}
+
+	return c.blockedUntil.Sub(now), true
+}
+
+/*
+Observe учёт перехода клиента, возвращает блокировку, если переход превысил порог
+*/
+func (d *Detector) Observe(key string, notFound bool) (Block, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	c, ok := d.clients[key]
+	if !ok {
+		d.sweep(now)
+		c = &client{windowStart: now}
+		d.clients[key] = c
+	}
+
+	if now.Sub(c.windowStart) >= d.cfg.Window {
+		c.windowStart, c.total, c.notFound = now, 0, 0
+	}
+
+	c.total++
+	if notFound {
+		c.notFound++
+	}
+
+	if c.total < d.cfg.MinRequests || float64(c.notFound) < d.cfg.NotFoundRatio*float64(c.total) {
+		return Block{}, false
+	}
+
+	if !c.lastBlock.IsZero() && now.Sub(c.lastBlock) >= d.cfg.ResetAfter {
+		c.level = 0
+	}
+	c.level++
+	c.lastBlock = now
+	c.blockedUntil = now.Add(d.duration(c.level))
+
+	block := Block{
+		Client:    key,
+		Level:     c.level,
+		Total:     c.total,
+		NotFound:  c.notFound,
+		BlockedAt: now,
+		Until:     c.blockedUntil,
+	}
+
+	// после блокировки счёт начинается заново, иначе следующий же запрос продлил бы её
+	c.windowStart, c.total, c.notFound = c.blockedUntil, 0, 0
+
+	return block, true
+}
+
+// duration длительность блокировки уровня level: BaseBlock * 2^(level-1), но не больше MaxBlock
+func (d *Detector) duration(level int) time.Duration {
+	block := d.cfg.BaseBlock
+	for i := 1; i < level && block < d.cfg.MaxBlock; i++ {
+		block *= 2
+	}
+
+	return min(block, d.cfg.MaxBlock)
+}
+
+// sweep удаление клиентов без активного окна, блокировки и истории эскалации
+func (d *Detector) sweep(now time.Time) {
+	for key, c := range d.clients {
+		if now.Sub(c.windowStart) >= d.cfg.Window && !now.Before(c.blockedUntil) &&
+			(c.lastBlock.IsZero() || now.Sub(c.lastBlock) >= d.cfg.ResetAfter) {
+			delete(d.clients, key)
+		}
+	}
+}
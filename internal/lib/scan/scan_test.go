@@ -0,0 +1,60 @@
+package scan
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetector(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	d := New(Config{
+		Window:        time.Minute,
+		MinRequests:   4,
+		NotFoundRatio: 0.5,
+		BaseBlock:     time.Minute,
+		MaxBlock:      3 * time.Minute,
+		ResetAfter:    time.Hour,
+	})
+	d.now = func() time.Time { return now }
+
+	scan := func() (Block, bool) {
+		var block Block
+		var blocked bool
+		for i := 0; i < 4; i++ {
+			block, blocked = d.Observe("203.0.113.7", true)
+		}
+		return block, blocked
+	}
+
+	// обычный клиент с редкими промахами не блокируется
+	for i := 0; i < 10; i++ {
+		_, blocked := d.Observe("198.51.100.1", i%5 == 0)
+		assert.False(t, blocked)
+	}
+
+	block, blocked := scan()
+	require.True(t, blocked)
+	assert.Equal(t, 1, block.Level)
+	assert.Equal(t, 4, block.NotFound)
+
+	retry, blocked := d.Blocked("203.0.113.7")
+	assert.True(t, blocked)
+	assert.Equal(t, time.Minute, retry)
+
+	// повторный перебор после разблокировки блокирует вдвое дольше, но не дольше MaxBlock
+	now = now.Add(time.Minute)
+	block, _ = scan()
+	assert.Equal(t, 2*time.Minute, block.Until.Sub(now))
+
+	now = now.Add(2 * time.Minute)
+	block, _ = scan()
+	assert.Equal(t, 3*time.Minute, block.Until.Sub(now))
+
+	// после спокойного периода эскалация сбрасывается
+	now = now.Add(2 * time.Hour)
+	block, _ = scan()
+	assert.Equal(t, 1, block.Level)
+}
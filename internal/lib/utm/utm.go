@@ -0,0 +1,63 @@
+package utm
+
+import (
+	"net/url"
+	"strings"
+)
+
+/*
+Params UTM метки кампании, пустые поля не меняют адрес
+*/
+type Params struct {
+	Source   string `json:"source,omitempty"`
+	Medium   string `json:"medium,omitempty"`
+	Campaign string `json:"campaign,omitempty"`
+	Term     string `json:"term,omitempty"`
+	Content  string `json:"content,omitempty"`
+}
+
+func (p Params) IsZero() bool {
+	return p == Params{}
+}
+
+/*
+Apply добавление меток к адресу, заданные метки заменяют уже имеющиеся в адресе
+*/
+func Apply(rawURL string, p Params) (string, error) {
+	if p.IsZero() {
+		return rawURL, nil
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	query := u.Query()
+	for key, value := range map[string]string{
+		"utm_source":   p.Source,
+		"utm_medium":   p.Medium,
+		"utm_campaign": p.Campaign,
+		"utm_term":     p.Term,
+		"utm_content":  p.Content,
+	} {
+		if value = strings.TrimSpace(value); value != "" {
+			query.Set(key, value)
+		}
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
+
+/*
+Campaign значение utm_campaign из адреса, пустая строка если метки нет или адрес некорректен
+*/
+func Campaign(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+
+	return u.Query().Get("utm_campaign")
+}
@@ -0,0 +1,49 @@
+package utm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApply(t *testing.T) {
+	cases := []struct {
+		name string
+		url  string
+		p    Params
+		want string
+	}{
+		{
+			name: "empty params",
+			url:  "https://google.com/?b=2&a=1",
+			want: "https://google.com/?b=2&a=1",
+		},
+		{
+			name: "all fields",
+			url:  "https://google.com/page",
+			p:    Params{Source: "newsletter", Medium: "email", Campaign: "spring sale", Term: "shoes", Content: "top"},
+			want: "https://google.com/page?utm_campaign=spring+sale&utm_content=top&utm_medium=email&utm_source=newsletter&utm_term=shoes",
+		},
+		{
+			name: "overrides existing",
+			url:  "https://google.com/?utm_source=old&ref=x#frag",
+			p:    Params{Source: "new"},
+			want: "https://google.com/?ref=x&utm_source=new#frag",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Apply(tc.url, tc.p)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestCampaign(t *testing.T) {
+	assert.Equal(t, "spring sale", Campaign("https://google.com/?utm_campaign=spring+sale"))
+	assert.Equal(t, "", Campaign("https://google.com/"))
+	assert.Equal(t, "", Campaign("://bad"))
+}
@@ -0,0 +1,63 @@
+package variants
+
+import (
+	"hash/fnv"
+	"math/rand"
+)
+
+/*
+Способы закрепления варианта за посетителем
+*/
+const (
+	StickyNone   = ""       // каждый переход выбирается заново
+	StickyCookie = "cookie" // выбранный вариант запоминается в cookie
+	StickyIP     = "ip"     // вариант вычисляется по хешу IP адреса
+)
+
+/*
+Variant адрес назначения A/B теста, доля переходов пропорциональна весу
+*/
+type Variant struct {
+	URL    string `json:"url" validate:"required,http_url"`
+	Weight int    `json:"weight" validate:"min=1,max=1000"`
+}
+
+/*
+Pick номер варианта: по ключу выбор детерминирован, пустой ключ - случайный выбор по весам.
+Для пустого списка возвращает -1
+*/
+func Pick(variants []Variant, key string) int {
+	total := 0
+	for _, v := range variants {
+		total += weight(v)
+	}
+	if total == 0 {
+		return -1
+	}
+
+	var n int
+	if key == "" {
+		n = rand.Intn(total)
+	} else {
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(key))
+		n = int(h.Sum32() % uint32(total))
+	}
+
+	for i, v := range variants {
+		n -= weight(v)
+		if n < 0 {
+			return i
+		}
+	}
+
+	return len(variants) - 1
+}
+
+// weight вес варианта, нулевой и отрицательный считаются единицей, чтобы вариант не пропадал из ротации
+func weight(v Variant) int {
+	if v.Weight < 1 {
+		return 1
+	}
+	return v.Weight
+}
@@ -0,0 +1,31 @@
+package variants
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPick(t *testing.T) {
+	list := []Variant{
+		{URL: "https://a.example.com", Weight: 1},
+		{URL: "https://b.example.com", Weight: 3},
+	}
+
+	assert.Equal(t, -1, Pick(nil, ""))
+	assert.Equal(t, 0, Pick(list[:1], "anything"))
+
+	// выбор по ключу стабилен
+	first := Pick(list, "203.0.113.7")
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, first, Pick(list, "203.0.113.7"))
+	}
+
+	// случайный выбор примерно следует весам
+	counts := make([]int, len(list))
+	for i := 0; i < 4000; i++ {
+		counts[Pick(list, "")]++
+	}
+	assert.InDelta(t, 1000, counts[0], 200)
+	assert.InDelta(t, 3000, counts[1], 200)
+}
@@ -0,0 +1,184 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"url-shoter/internal/lib/logger/sl"
+)
+
+type Store interface {
+	MarkExpiredLinks() (int64, error)
+	FanOutWebhookEvents(limit int) (int, error)
+	ClaimDeliveries(limit int, lease time.Duration) ([]Delivery, error)
+	FinishDelivery(delivery Delivery) error
+}
+
+/*
+Config параметры отправки: Interval - период опроса outbox, MaxAttempts - попыток до списка недоставленных
+*/
+type Config struct {
+	Interval    time.Duration
+	BatchSize   int
+	Timeout     time.Duration
+	MaxAttempts int
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+}
+
+// maxErrorLength длина сохраняемого текста ошибки доставки
+const maxErrorLength = 500
+
+/*
+Dispatcher отправка событий из outbox подписчикам. Доставка "хотя бы один раз": событие считается
+доставленным только после ответа 2xx, поэтому получатель должен отбрасывать дубли по id события
+*/
+type Dispatcher struct {
+	log    *slog.Logger
+	store  Store
+	client *http.Client
+	cfg    Config
+	now    func() time.Time
+}
+
+func NewDispatcher(log *slog.Logger, store Store, cfg Config) *Dispatcher {
+	return &Dispatcher{
+		log:    log.With(slog.String("component", "webhook/dispatcher")),
+		store:  store,
+		client: &http.Client{Timeout: cfg.Timeout},
+		cfg:    cfg,
+		now:    time.Now,
+	}
+}
+
+/*
+Run обработка каждые Interval до отмены ctx
+*/
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		d.Tick(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+/*
+Tick один проход: отметка истёкших ссылок, раскладка новых событий по подпискам и отправка
+доставок, время которых пришло
+*/
+func (d *Dispatcher) Tick(ctx context.Context) {
+	if n, err := d.store.MarkExpiredLinks(); err != nil {
+		d.log.Error("не удалось отметить истёкшие ссылки", sl.Err(err))
+	} else if n > 0 {
+		d.log.Info("ссылки истекли", slog.Int64("count", n))
+	}
+
+	if _, err := d.store.FanOutWebhookEvents(d.cfg.BatchSize); err != nil {
+		d.log.Error("не удалось разложить события по подпискам", sl.Err(err))
+	}
+
+	// доставка занимается на время двух таймаутов, чтобы другая реплика не отправила её параллельно
+	deliveries, err := d.store.ClaimDeliveries(d.cfg.BatchSize, 2*d.cfg.Timeout)
+	if err != nil {
+		d.log.Error("не удалось получить доставки", sl.Err(err))
+		return
+	}
+
+	for _, delivery := range deliveries {
+		if ctx.Err() != nil {
+			return
+		}
+
+		delivery = d.deliver(ctx, delivery)
+		if err := d.store.FinishDelivery(delivery); err != nil {
+			d.log.Error("не удалось сохранить результат доставки", slog.Int64("delivery", delivery.ID), sl.Err(err))
+		}
+	}
+}
+
+// deliver одна попытка отправки, возвращает доставку с новым статусом
+func (d *Dispatcher) deliver(ctx context.Context, delivery Delivery) Delivery {
+	now := d.now()
+	delivery.Attempts++
+	delivery.ResponseCode = 0
+	delivery.LastError = ""
+
+	err := d.send(ctx, &delivery, now)
+	if err == nil {
+		delivery.Status = StatusDelivered
+		delivery.DeliveredAt = &now
+		delivery.NextAttemptAt = nil
+
+		return delivery
+	}
+
+	delivery.LastError = err.Error()
+	if len(delivery.LastError) > maxErrorLength {
+		delivery.LastError = delivery.LastError[:maxErrorLength]
+	}
+
+	if delivery.Attempts >= d.cfg.MaxAttempts {
+		d.log.Warn("доставка не удалась, попытки исчерпаны",
+			slog.Int64("delivery", delivery.ID), slog.String("url", delivery.URL), sl.Err(err))
+
+		delivery.Status = StatusDead
+		delivery.NextAttemptAt = nil
+
+		return delivery
+	}
+
+	next := now.Add(Backoff(delivery.Attempts, d.cfg.BaseBackoff, d.cfg.MaxBackoff))
+	delivery.Status = StatusPending
+	delivery.NextAttemptAt = &next
+
+	return delivery
+}
+
+func (d *Dispatcher) send(ctx context.Context, delivery *Delivery, now time.Time) error {
+	body, err := json.Marshal(Envelope{
+		ID:        delivery.EventID,
+		Event:     delivery.Event,
+		CreatedAt: delivery.EventAt,
+		Data:      delivery.Payload,
+	})
+	if err != nil {
+		return fmt.Errorf("не удалось собрать тело: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "url-shoter-webhooks")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, fmt.Sprint(delivery.ID))
+	req.Header.Set(HeaderSignature, Sign(delivery.Secret, now, body))
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+
+	delivery.ResponseCode = res.StatusCode
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("получатель ответил %d", res.StatusCode)
+	}
+
+	return nil
+}
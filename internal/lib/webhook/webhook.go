@@ -0,0 +1,134 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+/*
+События ссылок. Записи в outbox создаёт триггер urls_outbox, названия должны совпадать
+*/
+const (
+	EventLinkCreated    = "link.created"
+	EventLinkUpdated    = "link.updated"
+	EventLinkDeleted    = "link.deleted"
+	EventLinkExpired    = "link.expired"
+	EventClickMilestone = "link.clicks_milestone" // переходов стало 10, 100, 1000 и т.д.
+)
+
+/*
+Events все события, на которые можно подписаться
+*/
+var Events = []string{EventLinkCreated, EventLinkUpdated, EventLinkDeleted, EventLinkExpired, EventClickMilestone}
+
+/*
+Статусы доставки
+*/
+const (
+	StatusPending   = "pending"   // ждёт первой или повторной попытки
+	StatusDelivered = "delivered" // получатель ответил 2xx
+	StatusDead      = "dead"      // попытки исчерпаны, доставка в списке недоставленных
+)
+
+/*
+Заголовки запроса к подписчику
+*/
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+/*
+Webhook подписка на события, пустой Events - все события. Secret отдаётся только при создании
+*/
+type Webhook struct {
+	ID        int64     `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+/*
+Delivery доставка одного события одному подписчику, она же запись журнала доставок
+*/
+type Delivery struct {
+	ID            int64           `json:"id"`
+	WebhookID     int64           `json:"webhook_id"`
+	URL           string          `json:"url,omitempty"`
+	Secret        string          `json:"-"`
+	EventID       int64           `json:"event_id"`
+	Event         string          `json:"event"`
+	Payload       json.RawMessage `json:"payload"`
+	EventAt       time.Time       `json:"event_at"`
+	Status        string          `json:"status"`
+	Attempts      int             `json:"attempts"`
+	ResponseCode  int             `json:"response_code,omitempty"`
+	LastError     string          `json:"last_error,omitempty"`
+	CreatedAt     time.Time       `json:"created_at"`
+	NextAttemptAt *time.Time      `json:"next_attempt_at,omitempty"`
+	DeliveredAt   *time.Time      `json:"delivered_at,omitempty"`
+}
+
+/*
+DeliveryFilter отбор доставок для журнала, пустые поля не ограничивают выборку
+*/
+type DeliveryFilter struct {
+	WebhookID int64
+	Status    string
+	Limit     int
+}
+
+/*
+Envelope тело запроса к подписчику
+*/
+type Envelope struct {
+	ID        int64           `json:"id"` // id события, одинаковый во всех повторах: по нему получатель отбрасывает дубли
+	Event     string          `json:"event"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+/*
+Sign значение заголовка X-Webhook-Signature: t=<unix время>,v1=<hex HMAC-SHA256 от "<t>.<тело>">.
+Время в подписи не даёт повторить перехваченный запрос позже
+*/
+func Sign(secret string, at time.Time, body []byte) string {
+	ts := strconv.FormatInt(at.Unix(), 10)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+/*
+Backoff пауза перед попыткой attempt+1 после attempt неудачных: base, 2*base, 4*base... не больше max
+*/
+func Backoff(attempt int, base time.Duration, max time.Duration) time.Duration {
+	d := base
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+
+	return min(d, max)
+}
+
+/*
+ValidEvent событие есть в Events
+*/
+func ValidEvent(event string) bool {
+	for _, e := range Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"url-shoter/internal/lib/logger/handlers/slogdiscard"
+)
+
+func TestSign(t *testing.T) {
+	at := time.Unix(1700000000, 0)
+	body := []byte(`{"id":1}`)
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte("1700000000." + string(body)))
+
+	assert.Equal(t, "t=1700000000,v1="+hex.EncodeToString(mac.Sum(nil)), Sign("secret", at, body))
+	assert.NotEqual(t, Sign("secret", at, body), Sign("other", at, body))
+}
+
+func TestBackoff(t *testing.T) {
+	base, max := 10*time.Second, time.Minute
+
+	assert.Equal(t, 10*time.Second, Backoff(1, base, max))
+	assert.Equal(t, 20*time.Second, Backoff(2, base, max))
+	assert.Equal(t, 40*time.Second, Backoff(3, base, max))
+	assert.Equal(t, time.Minute, Backoff(4, base, max))
+	assert.Equal(t, time.Minute, Backoff(50, base, max))
+}
+
+type fakeStore struct {
+	deliveries []Delivery
+	finished   []Delivery
+}
+
+func (f *fakeStore) MarkExpiredLinks() (int64, error)     { return 0, nil }
+func (f *fakeStore) FanOutWebhookEvents(int) (int, error) { return 0, nil }
+
+func (f *fakeStore) ClaimDeliveries(int, time.Duration) ([]Delivery, error) {
+	claimed := f.deliveries
+	f.deliveries = nil
+	return claimed, nil
+}
+
+func (f *fakeStore) FinishDelivery(delivery Delivery) error {
+	f.finished = append(f.finished, delivery)
+	return nil
+}
+
+func TestDispatcherTick(t *testing.T) {
+	var gotHeaders http.Header
+	var gotBody []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/fail") {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		gotHeaders = r.Header.Clone()
+		gotBody, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	payload := json.RawMessage(`{"link":{"id":7,"alias":"spring"}}`)
+	store := &fakeStore{deliveries: []Delivery{
+		{ID: 1, URL: srv.URL + "/ok", Secret: "s1", EventID: 42, Event: EventLinkCreated, Payload: payload, EventAt: now},
+		{ID: 2, URL: srv.URL + "/fail", Secret: "s2", EventID: 43, Event: EventLinkDeleted, Payload: payload, Attempts: 1},
+		{ID: 3, URL: srv.URL + "/fail", Secret: "s3", EventID: 44, Event: EventLinkDeleted, Payload: payload, Attempts: 2},
+	}}
+
+	d := NewDispatcher(slogdiscard.NewDiscardLogger(), store, Config{
+		BatchSize: 10, Timeout: time.Second, MaxAttempts: 3, BaseBackoff: 10 * time.Second, MaxBackoff: time.Hour,
+	})
+	d.now = func() time.Time { return now }
+
+	d.Tick(context.Background())
+	require.Len(t, store.finished, 3)
+
+	ok := store.finished[0]
+	assert.Equal(t, StatusDelivered, ok.Status)
+	assert.Equal(t, 1, ok.Attempts)
+	assert.Equal(t, http.StatusOK, ok.ResponseCode)
+	assert.Equal(t, EventLinkCreated, gotHeaders.Get(HeaderEvent))
+	assert.Equal(t, "1", gotHeaders.Get(HeaderDelivery))
+	assert.Equal(t, Sign("s1", now, gotBody), gotHeaders.Get(HeaderSignature))
+
+	var envelope Envelope
+	require.NoError(t, json.Unmarshal(gotBody, &envelope))
+	assert.Equal(t, int64(42), envelope.ID)
+	assert.JSONEq(t, string(payload), string(envelope.Data))
+
+	retry := store.finished[1]
+	assert.Equal(t, StatusPending, retry.Status)
+	assert.Equal(t, 2, retry.Attempts)
+	assert.Equal(t, http.StatusInternalServerError, retry.ResponseCode)
+	require.NotNil(t, retry.NextAttemptAt)
+	assert.Equal(t, now.Add(20*time.Second), *retry.NextAttemptAt)
+
+	dead := store.finished[2]
+	assert.Equal(t, StatusDead, dead.Status)
+	assert.Equal(t, 3, dead.Attempts)
+	assert.Nil(t, dead.NextAttemptAt)
+	assert.NotEmpty(t, dead.LastError)
+}
@@ -0,0 +1,86 @@
+package pgsql
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+
+	"url-shoter/internal/lib/events"
+)
+
+/*
+StreamConsumer имя потребителя outbox, совпадает с условием индекса outbox_stream_pending_idx
+*/
+const StreamConsumer = "stream"
+
+/*
+SetClickEvents запись события link.clicked в outbox при каждом переходе. Включается вместе с потоком событий,
+иначе записи копились бы без потребителя
+*/
+func (s *Storage) SetClickEvents(on bool) {
+	s.clickEvents = on
+}
+
+/*
+ConsumeStreamEvents до limit ещё не опубликованных событий outbox по порядку id передаются handle.
+Записи заблокированы на время handle, другая реплика берёт следующие. Отметка ставится только если
+handle вернул nil, иначе события останутся в очереди
+*/
+func (s *Storage) ConsumeStreamEvents(limit int, handle func([]events.Record) error) (int, error) {
+	const op = "storage.pgsql.ConsumeStreamEvents"
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer func(tx *sql.Tx) {
+		err := tx.Rollback()
+		if err != nil && err != sql.ErrTxDone {
+			LogErrorCloseDb(op, err)
+		}
+	}(tx)
+
+	rows, err := tx.Query(`SELECT id, event, link_id, payload, created_at FROM outbox
+		WHERE NOT ('`+StreamConsumer+`' = ANY(consumed_by)) ORDER BY id LIMIT $1 FOR UPDATE SKIP LOCKED`, limit)
+	if err != nil {
+		return 0, fmt.Errorf("%s: не удалось получить события: %w", op, err)
+	}
+
+	var records []events.Record
+	for rows.Next() {
+		var rec events.Record
+		if err := rows.Scan(&rec.ID, &rec.Type, &rec.LinkID, &rec.Payload, &rec.CreatedAt); err != nil {
+			_ = rows.Close()
+			return 0, fmt.Errorf("%s: не удалось прочитать событие: %w", op, err)
+		}
+		records = append(records, rec)
+	}
+	if err = rows.Close(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if len(records) == 0 {
+		return 0, nil
+	}
+
+	if err = handle(records); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	ids := make([]int64, 0, len(records))
+	for _, rec := range records {
+		ids = append(ids, rec.ID)
+	}
+
+	_, err = tx.Exec("UPDATE outbox SET consumed_by = array_append(consumed_by, $1) WHERE id = ANY($2)",
+		StreamConsumer, pq.Array(ids))
+	if err != nil {
+		return 0, fmt.Errorf("%s: не удалось отметить события: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return len(records), nil
+}
@@ -0,0 +1,183 @@
+package pgsql
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+
+	"url-shoter/internal/lib/audit"
+	"url-shoter/internal/storage"
+)
+
+/*
+Чтение сразу для нескольких ссылок, чтобы список ссылок с вложенными данными читался
+фиксированным числом запросов, а не запросом на каждую ссылку
+*/
+
+/*
+GetUrlsByIds записи с указанными id, включая ссылки в корзине. Порядок не гарантируется, несуществующих id в ответе нет
+*/
+func (s *Storage) GetUrlsByIds(ids []int64) ([]storage.URLData, error) {
+	const op = "storage.pgsql.GetUrlsByIds"
+
+	rows, err := s.db.Query("SELECT "+urlColumns+" FROM urls WHERE id = ANY($1)", pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer func(rows *sql.Rows) {
+		var err = rows.Close()
+		if err != nil {
+			LogErrorCloseDb(op, err)
+		}
+	}(rows)
+
+	var list []storage.URLData
+	for rows.Next() {
+		data, err := scanURLData(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		list = append(list, data)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return list, nil
+}
+
+/*
+VariantClicksByIds переходы по вариантам A/B теста: id ссылки -> номер варианта -> переходы.
+Ссылок без переходов по вариантам в ответе нет
+*/
+func (s *Storage) VariantClicksByIds(ids []int64) (map[int64]map[int]int64, error) {
+	const op = "storage.pgsql.VariantClicksByIds"
+
+	rows, err := s.db.Query("SELECT url_id, variant, clicks FROM url_variant_clicks WHERE url_id = ANY($1)", pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer func(rows *sql.Rows) {
+		var err = rows.Close()
+		if err != nil {
+			LogErrorCloseDb(op, err)
+		}
+	}(rows)
+
+	clicks := make(map[int64]map[int]int64)
+	for rows.Next() {
+		var id, count int64
+		var variant int
+		if err := rows.Scan(&id, &variant, &count); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if clicks[id] == nil {
+			clicks[id] = make(map[int]int64)
+		}
+		clicks[id][variant] = count
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return clicks, nil
+}
+
+/*
+AuditByLinks записи журнала аудита по ссылкам в порядке возрастания id записи
+*/
+func (s *Storage) AuditByLinks(ids []int64) (map[int64][]audit.Entry, error) {
+	const op = "storage.pgsql.AuditByLinks"
+
+	rows, err := s.db.Query(`SELECT `+auditColumns+` FROM audit_log WHERE link_id = ANY($1) ORDER BY id`, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer func(rows *sql.Rows) {
+		var err = rows.Close()
+		if err != nil {
+			LogErrorCloseDb(op, err)
+		}
+	}(rows)
+
+	entries := make(map[int64][]audit.Entry)
+	for rows.Next() {
+		entry, err := scanAuditEntry(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		entries[entry.LinkID] = append(entries[entry.LinkID], entry)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return entries, nil
+}
+
+/*
+Owners владельцы ссылок по алфавиту. Импортированные ссылки владельца не имеют
+*/
+func (s *Storage) Owners() ([]storage.OwnerStat, error) {
+	const op = "storage.pgsql.Owners"
+
+	rows, err := s.db.Query(`SELECT actor, COUNT(DISTINCT link_id) FROM audit_log
+		WHERE action = $1 AND link_id <> 0 GROUP BY actor ORDER BY actor`, audit.ActionCreate)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer func(rows *sql.Rows) {
+		var err = rows.Close()
+		if err != nil {
+			LogErrorCloseDb(op, err)
+		}
+	}(rows)
+
+	var owners []storage.OwnerStat
+	for rows.Next() {
+		var owner storage.OwnerStat
+		if err := rows.Scan(&owner.Actor, &owner.Links); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		owners = append(owners, owner)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return owners, nil
+}
+
+/*
+OwnerLinkIDs id ссылок, созданных actor, по возрастанию: больше afterID, не больше limit
+*/
+func (s *Storage) OwnerLinkIDs(actor string, afterID int64, limit int) ([]int64, error) {
+	const op = "storage.pgsql.OwnerLinkIDs"
+
+	rows, err := s.db.Query(`SELECT DISTINCT link_id FROM audit_log
+		WHERE action = $1 AND actor = $2 AND link_id > $3 ORDER BY link_id LIMIT $4`, audit.ActionCreate, actor, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer func(rows *sql.Rows) {
+		var err = rows.Close()
+		if err != nil {
+			LogErrorCloseDb(op, err)
+		}
+	}(rows)
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		ids = append(ids, id)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,177 @@
+package pgsql
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+/*
+migrations изменения схемы поверх исходной таблицы urls.
+Выполняются при каждом подключении по порядку, поэтому каждая должна быть идемпотентной.
+Новые изменения дописываются в конец списка.
+*/
+var migrations = []string{
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS title TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS clicks BIGINT NOT NULL DEFAULT 0`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT now()`,
+	// алиас уникален в пределах домена, пустой домен - домен по умолчанию
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS domain TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE urls DROP CONSTRAINT IF EXISTS urls_alias_key`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS urls_domain_alias_key ON urls (domain, alias)`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS redirect_type SMALLINT NOT NULL DEFAULT 302`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS preview BOOLEAN NOT NULL DEFAULT false`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS forward_query BOOLEAN NOT NULL DEFAULT false`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS forward_path BOOLEAN NOT NULL DEFAULT false`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS campaign TEXT NOT NULL DEFAULT ''`,
+	`CREATE INDEX IF NOT EXISTS urls_campaign_idx ON urls (campaign)`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS rules JSONB NOT NULL DEFAULT '[]'`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS variants JSONB NOT NULL DEFAULT '[]'`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS sticky TEXT NOT NULL DEFAULT ''`,
+	// переходы по вариантам A/B теста, номер варианта - индекс в urls.variants
+	`CREATE TABLE IF NOT EXISTS url_variant_clicks (
+		url_id BIGINT NOT NULL REFERENCES urls (id) ON DELETE CASCADE,
+		variant INTEGER NOT NULL,
+		clicks BIGINT NOT NULL DEFAULT 0,
+		PRIMARY KEY (url_id, variant)
+	)`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS password_hash TEXT NOT NULL DEFAULT ''`,
+	// журнал блокировок за перебор алиасов
+	`CREATE TABLE IF NOT EXISTS blocked_clients (
+		id BIGSERIAL PRIMARY KEY,
+		client TEXT NOT NULL,
+		level INTEGER NOT NULL,
+		total INTEGER NOT NULL,
+		not_found INTEGER NOT NULL,
+		blocked_at TIMESTAMPTZ NOT NULL,
+		until TIMESTAMPTZ NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS blocked_clients_blocked_at_idx ON blocked_clients (blocked_at DESC)`,
+	// корзина: удалённые ссылки хранятся до очистки по сроку
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS deleted_by TEXT NOT NULL DEFAULT ''`,
+	`CREATE INDEX IF NOT EXISTS urls_deleted_at_idx ON urls (deleted_at) WHERE deleted_at IS NOT NULL`,
+	// журнал аудита, link_id без внешнего ключа: записи переживают очистку корзины
+	`CREATE TABLE IF NOT EXISTS audit_log (
+		id BIGSERIAL PRIMARY KEY,
+		link_id BIGINT NOT NULL DEFAULT 0,
+		actor TEXT NOT NULL,
+		action TEXT NOT NULL,
+		before JSONB,
+		after JSONB,
+		request_id TEXT NOT NULL DEFAULT '',
+		ip TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`,
+	`CREATE INDEX IF NOT EXISTS audit_log_link_id_idx ON audit_log (link_id, id DESC)`,
+	`CREATE INDEX IF NOT EXISTS audit_log_actor_idx ON audit_log (actor, id DESC)`,
+	`CREATE INDEX IF NOT EXISTS audit_log_created_at_idx ON audit_log (created_at)`,
+	// журнал только дополняется: изменение и удаление записей запрещены на уровне базы
+	`CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+	BEGIN
+		RAISE EXCEPTION 'audit_log is append-only';
+	END;
+	$$ LANGUAGE plpgsql`,
+	`DROP TRIGGER IF EXISTS audit_log_append_only ON audit_log`,
+	`CREATE TRIGGER audit_log_append_only BEFORE UPDATE OR DELETE ON audit_log
+		FOR EACH ROW EXECUTE FUNCTION audit_log_append_only()`,
+	// outbox событий ссылок: пишется триггером в той же транзакции, что и изменение ссылки.
+	// consumed_by - потребители, уже забравшие событие
+	`CREATE TABLE IF NOT EXISTS outbox (
+		id BIGSERIAL PRIMARY KEY,
+		event TEXT NOT NULL,
+		link_id BIGINT NOT NULL DEFAULT 0,
+		payload JSONB NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		consumed_by TEXT[] NOT NULL DEFAULT '{}'
+	)`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS expired_notified BOOLEAN NOT NULL DEFAULT false`,
+	// события: link.created, link.deleted при переносе в корзину и при удалении строки (очистка корзины, перезапись
+	// при импорте), link.expired (по expired_notified), link.updated при изменении чего угодно кроме счётчика
+	// переходов, link.clicks_milestone при достижении 10, 100, 1000... переходов
+	`CREATE OR REPLACE FUNCTION urls_outbox() RETURNS trigger AS $$
+	DECLARE
+		link JSONB;
+		milestone BIGINT := 10;
+	BEGIN
+		IF TG_OP = 'DELETE' THEN
+			link := to_jsonb(OLD) - 'password_hash' - 'expired_notified';
+			INSERT INTO outbox (event, link_id, payload) VALUES ('link.deleted', OLD.id, jsonb_build_object('link', link));
+			RETURN OLD;
+		END IF;
+
+		link := to_jsonb(NEW) - 'password_hash' - 'expired_notified';
+
+		IF TG_OP = 'INSERT' THEN
+			INSERT INTO outbox (event, link_id, payload) VALUES ('link.created', NEW.id, jsonb_build_object('link', link));
+			RETURN NULL;
+		END IF;
+
+		IF NEW.deleted_at IS NOT NULL AND OLD.deleted_at IS NULL THEN
+			INSERT INTO outbox (event, link_id, payload) VALUES ('link.deleted', NEW.id, jsonb_build_object('link', link));
+		ELSIF NEW.expired_notified AND NOT OLD.expired_notified THEN
+			INSERT INTO outbox (event, link_id, payload) VALUES ('link.expired', NEW.id, jsonb_build_object('link', link));
+		ELSIF to_jsonb(NEW) - 'clicks' - 'expired_notified' <> to_jsonb(OLD) - 'clicks' - 'expired_notified' THEN
+			INSERT INTO outbox (event, link_id, payload) VALUES ('link.updated', NEW.id, jsonb_build_object('link', link));
+		END IF;
+
+		WHILE milestone <= NEW.clicks LOOP
+			IF milestone > OLD.clicks THEN
+				INSERT INTO outbox (event, link_id, payload)
+				VALUES ('link.clicks_milestone', NEW.id, jsonb_build_object('link', link, 'milestone', milestone));
+			END IF;
+			milestone := milestone * 10;
+		END LOOP;
+
+		RETURN NULL;
+	END;
+	$$ LANGUAGE plpgsql`,
+	`DROP TRIGGER IF EXISTS urls_outbox ON urls`,
+	`CREATE TRIGGER urls_outbox AFTER INSERT OR UPDATE OR DELETE ON urls FOR EACH ROW EXECUTE FUNCTION urls_outbox()`,
+	// подписки и доставки вебхуков
+	`CREATE TABLE IF NOT EXISTS webhooks (
+		id BIGSERIAL PRIMARY KEY,
+		url TEXT NOT NULL,
+		events TEXT[] NOT NULL DEFAULT '{}',
+		secret TEXT NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`,
+	`CREATE INDEX IF NOT EXISTS outbox_webhooks_pending_idx ON outbox (id) WHERE NOT ('webhooks' = ANY(consumed_by))`,
+	`CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		id BIGSERIAL PRIMARY KEY,
+		webhook_id BIGINT NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+		event_id BIGINT NOT NULL,
+		event TEXT NOT NULL,
+		payload JSONB NOT NULL,
+		event_at TIMESTAMPTZ NOT NULL,
+		status TEXT NOT NULL DEFAULT 'pending',
+		attempts INTEGER NOT NULL DEFAULT 0,
+		response_code INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		next_attempt_at TIMESTAMPTZ DEFAULT now(),
+		delivered_at TIMESTAMPTZ
+	)`,
+	`CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'pending'`,
+	`CREATE INDEX IF NOT EXISTS webhook_deliveries_webhook_idx ON webhook_deliveries (webhook_id, id DESC)`,
+	// очередь потока событий для брокера
+	`CREATE INDEX IF NOT EXISTS outbox_stream_pending_idx ON outbox (id) WHERE NOT ('stream' = ANY(consumed_by))`,
+	// очистка разобранных событий и завершённых доставок по сроку
+	`CREATE INDEX IF NOT EXISTS outbox_created_idx ON outbox (created_at)`,
+	`CREATE INDEX IF NOT EXISTS webhook_deliveries_finished_idx ON webhook_deliveries (created_at) WHERE status <> 'pending'`,
+}
+
+/*
+Migrate применение миграций схемы
+*/
+func Migrate(db *sql.DB) error {
+	const op = "storage.pgsql.Migrate"
+
+	for i, query := range migrations {
+		if _, err := db.Exec(query); err != nil {
+			return fmt.Errorf("%s: миграция %d не выполнена: %w", op, i+1, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package pgsql
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+/*
+PruneOutbox удаление событий outbox, созданных раньше before и уже забранных всеми потребителями consumers,
+и завершённых (delivered, dead) доставок вебхуков, созданных раньше before. Пустой consumers - потребителей нет,
+удаляются все старые события. Возвращает количество удалённых событий и доставок
+*/
+func (s *Storage) PruneOutbox(before time.Time, consumers []string) (int64, int64, error) {
+	const op = "storage.pgsql.PruneOutbox"
+
+	if consumers == nil {
+		consumers = []string{}
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s: не удалось открыть транзакцию: %w", op, err)
+	}
+	defer func(tx *sql.Tx) {
+		err := tx.Rollback()
+		if err != nil && !errors.Is(err, sql.ErrTxDone) {
+			LogErrorCloseDb(op, err)
+		}
+	}(tx)
+
+	res, err := tx.Exec("DELETE FROM outbox WHERE created_at < $1 AND consumed_by @> $2::text[]", before, pq.Array(consumers))
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s: не удалось удалить события: %w", op, err)
+	}
+	events, err := res.RowsAffected()
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err = tx.Exec("DELETE FROM webhook_deliveries WHERE status <> 'pending' AND created_at < $1", before)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s: не удалось удалить доставки: %w", op, err)
+	}
+	deliveries, err := res.RowsAffected()
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, 0, fmt.Errorf("%s: не удалось зафиксировать транзакцию: %w", op, err)
+	}
+
+	return events, deliveries, nil
+}
@@ -2,22 +2,138 @@ package pgsql
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/lib/pq"
 	_ "github.com/lib/pq"
+	"io"
 	"log"
+	"strings"
+	"time"
+	"url-shoter/internal/lib/audit"
+	"url-shoter/internal/lib/events"
+	"url-shoter/internal/lib/scan"
+	"url-shoter/internal/lib/utm"
 	"url-shoter/internal/storage"
 )
 
 type Storage struct {
-	db *sql.DB
+	db              *sql.DB
+	caseInsensitive bool // алиасы ищутся по lower(alias), включается SetCaseInsensitive
+	clickEvents     bool // переходы пишутся в outbox, включается SetClickEvents
 }
 
-type URLData struct {
-	Id    int64  `json:"id"`
-	Alias string `json:"alias"`
-	Url   string `json:"url"`
+/*
+urlColumns колонки для чтения storage.URLData, порядок совпадает со scanURLData
+*/
+const urlColumns = "id, alias, url, domain, title, clicks, created_at, expires_at, campaign, redirect_type, preview, forward_query, forward_path, rules, variants, sticky, password_hash, deleted_at, deleted_by"
+
+/*
+insertColumns колонки новой записи, порядок совпадает с insertValues, id при явном указании добавляется последним
+*/
+var insertColumns = []string{"url", "domain", "alias", "title", "clicks", "created_at", "expires_at", "campaign",
+	"redirect_type", "preview", "forward_query", "forward_path", "rules", "variants", "sticky", "password_hash", "deleted_at", "deleted_by"}
+
+/*
+insertQuery INSERT по insertColumns, suffix дописывается в конец запроса (ON CONFLICT, RETURNING)
+*/
+func insertQuery(withID bool, suffix string) string {
+	columns := insertColumns
+	if withID {
+		columns = append(columns[:len(columns):len(columns)], "id")
+	}
+
+	placeholders := make([]string, len(columns))
+	for i, column := range columns {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		if column == "created_at" {
+			placeholders[i] = fmt.Sprintf("COALESCE($%d, now())", i+1)
+		}
+	}
+
+	query := "INSERT INTO urls(" + strings.Join(columns, ", ") + ") VALUES (" + strings.Join(placeholders, ", ") + ")"
+	if suffix != "" {
+		query += " " + suffix
+	}
+
+	return query
+}
+
+/*
+insertValues значения для insertQuery, кампания берётся из адреса назначения
+*/
+func insertValues(data storage.URLData) ([]any, error) {
+	opts := data.Options.Normalize()
+
+	rulesJSON, err := jsonArray(opts.Rules)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось сохранить правила: %w", err)
+	}
+	variantsJSON, err := jsonArray(opts.Variants)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось сохранить варианты: %w", err)
+	}
+
+	values := []any{data.Url, data.Domain, data.Alias, data.Title, data.Clicks, nullTime(data.CreatedAt), data.ExpiresAt,
+		utm.Campaign(data.Url), opts.RedirectType, opts.Preview, opts.ForwardQuery, opts.ForwardPath, rulesJSON, variantsJSON, opts.Sticky, opts.PasswordHash,
+		data.DeletedAt, data.DeletedBy}
+	if data.Id != 0 {
+		values = append(values, data.Id)
+	}
+
+	return values, nil
+}
+
+// jsonArray значение для колонки JSONB со списком, nil сохраняется пустым массивом.
+// JSONB передаётся строкой: []byte драйвер отправил бы как bytea
+func jsonArray[T any](list []T) (string, error) {
+	if list == nil {
+		list = []T{}
+	}
+
+	data, err := json.Marshal(list)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+/*
+scanURLData чтение строки выбранной по urlColumns
+*/
+func scanURLData(row rowScanner) (storage.URLData, error) {
+	var urlData storage.URLData
+	var expiresAt, deletedAt sql.NullTime
+	var rulesJSON, variantsJSON []byte
+	err := row.Scan(&urlData.Id, &urlData.Alias, &urlData.Url, &urlData.Domain, &urlData.Title, &urlData.Clicks, &urlData.CreatedAt, &expiresAt,
+		&urlData.Campaign, &urlData.RedirectType, &urlData.Preview, &urlData.ForwardQuery, &urlData.ForwardPath, &rulesJSON,
+		&variantsJSON, &urlData.Sticky, &urlData.PasswordHash, &deletedAt, &urlData.DeletedBy)
+	if err != nil {
+		return urlData, err
+	}
+	if expiresAt.Valid {
+		urlData.ExpiresAt = &expiresAt.Time
+	}
+	if deletedAt.Valid {
+		urlData.DeletedAt = &deletedAt.Time
+	}
+	if len(rulesJSON) > 0 {
+		if err := json.Unmarshal(rulesJSON, &urlData.Rules); err != nil {
+			return urlData, fmt.Errorf("некорректные правила ссылки %d: %w", urlData.Id, err)
+		}
+	}
+	if len(variantsJSON) > 0 {
+		if err := json.Unmarshal(variantsJSON, &urlData.Variants); err != nil {
+			return urlData, fmt.Errorf("некорректные варианты ссылки %d: %w", urlData.Id, err)
+		}
+	}
+	return urlData, nil
 }
 
 type DBConfig struct {
@@ -38,14 +154,18 @@ func ConnectDB(configDB DBConfig) (*Storage, error) {
 	psqlInfo := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s", configDB.Host, configDB.Port, configDB.User, configDB.Password, configDB.DBName, configDB.SSLMode)
 	db, err := sql.Open("postgres", psqlInfo)
 	if err != nil {
-		log.Fatalf("%w :Hе удалось подключиться к бд с данными: %w", psqlInfo, op)
+		log.Fatalf("%s :Hе удалось подключиться к бд: %v", op, err)
 	}
 
 	log.Println("Подключение к бд прошло успешно")
 
 	_, err = CheckTableExist(db)
 	if err != nil {
-		log.Fatalf("%w :Hе удалось подключиться к таблице urls", op)
+		log.Fatalf("%s :Hе удалось подключиться к таблице urls: %v", op, err)
+	}
+
+	if err = Migrate(db); err != nil {
+		log.Fatalf("%s :Hе удалось обновить схему таблицы urls: %v", op, err)
 	}
 
 	return &Storage{db: db}, nil
@@ -66,7 +186,7 @@ func CheckTableExist(db *sql.DB) (bool, error) {
 	if !tableExists {
 		_, err = db.Exec(`CREATE TABLE urls (id SERIAL PRIMARY KEY, alias TEXT NOT NULL UNIQUE, url TEXT NOT NULL)`)
 		if err != nil {
-			return tableExists, fmt.Errorf("%w :Ошибка, таблицы 'urls' не удаётся её создать: %v", op, err)
+			return tableExists, fmt.Errorf("%s :Ошибка, таблицы 'urls' не удаётся её создать: %w", op, err)
 		}
 		log.Println("Таблица 'urls' успешно создана")
 		return !tableExists, nil
@@ -76,26 +196,86 @@ func CheckTableExist(db *sql.DB) (bool, error) {
 }
 
 /*
-SaveUrl Сохранение нового url с алиасом и id не обязательный параметр
+SaveUrl Сохранение нового url с алиасом в домене, id и срок жизни не обязательные параметры.
+Пустой домен означает домен по умолчанию. Созданная ссылка записывается в журнал аудита по trail той же транзакцией
 */
-func (s *Storage) SaveUrl(urlToSave string, alias string, id *int64) (int64, error) {
+func (s *Storage) SaveUrl(urlToSave string, domain string, alias string, id *int64, expiresAt *time.Time, opts storage.Options,
+	trail *audit.Trail) (int64, error) {
 	const op = "storage.pgsql.SaveUrl"
 
-	var stmt *sql.Stmt
-	var err error
-
 	if id != nil {
 		isUrl, err := s.ExistUrlById(*id)
-		if isUrl || err != nil {
-			return 0, fmt.Errorf("%s: %w\n", op, err)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
 		}
-		stmt, err = s.db.Prepare("INSERT INTO urls(url, alias, id) VALUES ($1, $2, $3) RETURNING id")
-	} else {
-		stmt, err = s.db.Prepare("INSERT INTO urls(url, alias) VALUES ($1, $2) RETURNING id")
+		if isUrl {
+			return 0, fmt.Errorf("%s: %w", op, storage.ErrIDExists)
+		}
+	}
+
+	data := storage.URLData{Url: urlToSave, Domain: domain, Alias: alias, ExpiresAt: expiresAt, Options: opts}
+	if id != nil {
+		data.Id = *id
+	}
+	values, err := insertValues(data)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("%s: не удалось открыть транзакцию: %w", op, err)
+	}
+	defer func(tx *sql.Tx) {
+		err := tx.Rollback()
+		if err != nil && !errors.Is(err, sql.ErrTxDone) {
+			LogErrorCloseDb(op, err)
+		}
+	}(tx)
+
+	saved, err := scanURLData(tx.QueryRow(insertQuery(id != nil, "RETURNING "+urlColumns), values...))
+	if err != nil {
+		pgErr, isPGErr := err.(*pq.Error)
+		if isPGErr && pgErr.Code == "23505" {
+			return 0, fmt.Errorf("%s: %w", op, uniqueViolation(pgErr))
+		}
+		return 0, fmt.Errorf("%s : Неудалось записать значение %w", op, err)
+	}
+
+	if err := recordLink(tx, trail, audit.ActionCreate, nil, &saved); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: не удалось зафиксировать транзакцию: %w", op, err)
+	}
+
+	return saved.Id, nil
+}
+
+/*
+SaveUrlBatch Сохранение пачки url одной транзакцией.
+Результаты возвращаются в том же порядке, что и входные данные.
+Занятый alias или id не прерывает транзакцию, а попадает в ошибку элемента (storage.ErrURLExists),
+любая другая ошибка откатывает всю пачку. Созданные ссылки записываются в журнал аудита по trail в той же транзакции.
+*/
+func (s *Storage) SaveUrlBatch(items []storage.URLData, trail *audit.Trail) ([]storage.SaveResult, error) {
+	const op = "storage.pgsql.SaveUrlBatch"
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("%s: не удалось открыть транзакцию: %w", op, err)
 	}
+	defer func(tx *sql.Tx) {
+		err := tx.Rollback()
+		if err != nil && !errors.Is(err, sql.ErrTxDone) {
+			LogErrorCloseDb(op, err)
+		}
+	}(tx)
 
+	stmt, err := tx.Prepare(insertQuery(false, "ON CONFLICT DO NOTHING RETURNING "+urlColumns))
 	if err != nil {
-		return 0, fmt.Errorf("%s : Неудалось записать значение %w\n", op, err)
+		return nil, fmt.Errorf("%s: prepare statement: %w", op, err)
 	}
 	defer func(stmt *sql.Stmt) {
 		err := stmt.Close()
@@ -104,35 +284,75 @@ func (s *Storage) SaveUrl(urlToSave string, alias string, id *int64) (int64, err
 		}
 	}(stmt)
 
-	var newID int64
-	if id != nil {
-		err = stmt.QueryRow(urlToSave, alias, id).Scan(&newID)
-	} else {
-		err = stmt.QueryRow(urlToSave, alias).Scan(&newID)
-	}
+	stmtWithID, err := tx.Prepare(insertQuery(true, "ON CONFLICT DO NOTHING RETURNING "+urlColumns))
 	if err != nil {
-		pgErr, isPGErr := err.(*pq.Error)
-		if isPGErr && pgErr.Code == "23505" {
-			return 0, fmt.Errorf("%s", op, err)
+		return nil, fmt.Errorf("%s: prepare statement: %w", op, err)
+	}
+	defer func(stmt *sql.Stmt) {
+		err := stmt.Close()
+		if err != nil {
+			LogErrorCloseDb(op, err)
+		}
+	}(stmtWithID)
+
+	results := make([]storage.SaveResult, len(items))
+
+	for i, item := range items {
+		values, err := insertValues(item)
+		if err != nil {
+			return nil, fmt.Errorf("%s: url %s: %w", op, item.Alias, err)
+		}
+
+		var saved storage.URLData
+		if item.Id != 0 {
+			saved, err = scanURLData(stmtWithID.QueryRow(values...))
+		} else {
+			saved, err = scanURLData(stmt.QueryRow(values...))
+		}
+
+		if errors.Is(err, sql.ErrNoRows) {
+			// ON CONFLICT DO NOTHING ничего не вернул: alias или id уже заняты
+			results[i].Err = storage.ErrURLExists
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: не удалось сохранить url %s: %w", op, item.Alias, err)
+		}
+
+		if err := recordLink(tx, trail, audit.ActionCreate, nil, &saved); err != nil {
+			return nil, fmt.Errorf("%s: url %s: %w", op, item.Alias, err)
 		}
-		return 0, fmt.Errorf("%s", op, err)
+
+		results[i].Id = saved.Id
 	}
 
-	return newID, nil
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("%s: не удалось зафиксировать транзакцию: %w", op, err)
+	}
+
+	return results, nil
 }
 
 /*
-GetURL Получение url
+GetURL Получение url по алиасу в домене, для истёкшей ссылки storage.ErrURLExpired,
+для удалённой storage.ErrURLDeleted
 */
-func (s *Storage) GetURL(alias string) (string, error) {
+func (s *Storage) GetURL(domain string, alias string) (string, error) {
 	const op = "storage.pgsql.GetUrl"
-	stmt, err := s.db.Prepare("SELECT url FROM urls WHERE alias = $1")
+	stmt, err := s.db.Prepare("SELECT url, expires_at, deleted_at FROM urls WHERE domain = $1 AND " + s.aliasMatch("$2"))
 	if err != nil {
 		return "", fmt.Errorf("%s: prepare statement: %w", op, err)
 	}
+	defer func(stmt *sql.Stmt) {
+		err := stmt.Close()
+		if err != nil {
+			LogErrorCloseDb(op, err)
+		}
+	}(stmt)
 
 	var resURL string
-	err = stmt.QueryRow(alias).Scan(&resURL)
+	var expiresAt, deletedAt sql.NullTime
+	err = stmt.QueryRow(domain, alias).Scan(&resURL, &expiresAt, &deletedAt)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return "", storage.ErrURLNotFound
@@ -140,9 +360,82 @@ func (s *Storage) GetURL(alias string) (string, error) {
 		return "", fmt.Errorf("%s: execute statemeny %w", op, err)
 	}
 
+	if deletedAt.Valid {
+		return "", storage.ErrURLDeleted
+	}
+
+	if expiresAt.Valid && !expiresAt.Time.After(time.Now()) {
+		return "", storage.ErrURLExpired
+	}
+
 	return resURL, nil
 }
 
+/*
+GetRedirect Получение записи целиком по алиасу в домене для перехода по ссылке,
+для истёкшей ссылки storage.ErrURLExpired, для удалённой storage.ErrURLDeleted
+*/
+func (s *Storage) GetRedirect(domain string, alias string) (storage.URLData, error) {
+	const op = "storage.pgsql.GetRedirect"
+
+	stmt, err := s.db.Prepare("SELECT " + urlColumns + " FROM urls WHERE domain = $1 AND " + s.aliasMatch("$2"))
+	if err != nil {
+		return storage.URLData{}, fmt.Errorf("%s: prepare statement: %w", op, err)
+	}
+	defer func(stmt *sql.Stmt) {
+		err := stmt.Close()
+		if err != nil {
+			LogErrorCloseDb(op, err)
+		}
+	}(stmt)
+
+	urlData, err := scanURLData(stmt.QueryRow(domain, alias))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return storage.URLData{}, storage.ErrURLNotFound
+		}
+		return storage.URLData{}, fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	if urlData.DeletedAt != nil {
+		return storage.URLData{}, storage.ErrURLDeleted
+	}
+
+	if urlData.ExpiresAt != nil && !urlData.ExpiresAt.After(time.Now()) {
+		return storage.URLData{}, storage.ErrURLExpired
+	}
+
+	return urlData, nil
+}
+
+/*
+GetUrlDataById Получение записи целиком по id
+*/
+func (s *Storage) GetUrlDataById(id int64) (storage.URLData, error) {
+	const op = "storage.pgsql.GetUrlDataById"
+
+	stmt, err := s.db.Prepare("SELECT " + urlColumns + " FROM urls WHERE id = $1")
+	if err != nil {
+		return storage.URLData{}, fmt.Errorf("%s: prepare statement: %w", op, err)
+	}
+	defer func(stmt *sql.Stmt) {
+		err := stmt.Close()
+		if err != nil {
+			LogErrorCloseDb(op, err)
+		}
+	}(stmt)
+
+	urlData, err := scanURLData(stmt.QueryRow(id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return storage.URLData{}, storage.ErrURLNotFound
+		}
+		return storage.URLData{}, fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	return urlData, nil
+}
+
 /*
 GetUrlById Получение url  по id
 */
@@ -167,31 +460,126 @@ func (s *Storage) GetUrlById(id int64) (string, error) {
 }
 
 /*
-DeleteById удаление урла из таблицы по id
+DeleteById перенос урла в корзину по id: запись остаётся в таблице с временем удаления и тем, кто удалил,
+алиас не освобождается до очистки корзины. Уже удалённая ссылка - storage.ErrURLNotFound.
+Ссылка до удаления записывается в журнал аудита по trail той же транзакцией
 */
-func (s *Storage) DeleteById(id int64) error {
+func (s *Storage) DeleteById(id int64, actor string, trail *audit.Trail) error {
 	const op = "storage.pgsql.DeleteById"
 
-	stmt, err := s.db.Prepare("DELETE FROM urls WHERE id=$1")
+	tx, err := s.db.Begin()
 	if err != nil {
-		return fmt.Errorf("%s: не удалоcь удалить url по id: %w", op, id, err)
+		return fmt.Errorf("%s: не удалось открыть транзакцию: %w", op, err)
 	}
-	defer func(stmt *sql.Stmt) {
-		err := stmt.Close()
-		if err != nil {
+	defer func(tx *sql.Tx) {
+		err := tx.Rollback()
+		if err != nil && !errors.Is(err, sql.ErrTxDone) {
 			LogErrorCloseDb(op, err)
 		}
-	}(stmt)
+	}(tx)
+
+	before, err := lockURL(tx, id)
+	if err == nil && before.DeletedAt != nil {
+		err = storage.ErrURLNotFound
+	}
+	if errors.Is(err, storage.ErrURLNotFound) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("%s: не удалоcь удалить url по id %d: %w", op, id, err)
+	}
+
+	_, err = tx.Exec("UPDATE urls SET deleted_at = now(), deleted_by = $2 WHERE id = $1", id, actor)
+	if err != nil {
+		return fmt.Errorf("%s: не удалось выполнить запрос на удаление URL по ID %d: %w", op, id, err)
+	}
+
+	if err := recordLink(tx, trail, audit.ActionDelete, &before, nil); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
 
-	_, err = stmt.Exec(id)
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%s: не удалось зафиксировать транзакцию: %w", op, err)
+	}
+
+	log.Printf("Удаление url по id :%d прошло успешно", id)
+	return nil
+}
+
+/*
+RestoreById возврат ссылки из корзины, ссылка не в корзине - storage.ErrURLNotFound.
+Восстановленная ссылка записывается в журнал аудита по trail той же транзакцией
+*/
+func (s *Storage) RestoreById(id int64, trail *audit.Trail) error {
+	const op = "storage.pgsql.RestoreById"
+
+	tx, err := s.db.Begin()
 	if err != nil {
-		return fmt.Errorf("%s: не удалось выполнить запрос на удаление URL по ID: %w", op, id, err)
+		return fmt.Errorf("%s: не удалось открыть транзакцию: %w", op, err)
+	}
+	defer func(tx *sql.Tx) {
+		err := tx.Rollback()
+		if err != nil && !errors.Is(err, sql.ErrTxDone) {
+			LogErrorCloseDb(op, err)
+		}
+	}(tx)
+
+	after, err := scanURLData(tx.QueryRow("UPDATE urls SET deleted_at = NULL, deleted_by = '' "+
+		"WHERE id = $1 AND deleted_at IS NOT NULL RETURNING "+urlColumns, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.ErrURLNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("%s: не удалось восстановить URL по ID %d: %w", op, id, err)
+	}
+
+	if err := recordLink(tx, trail, audit.ActionRestore, nil, &after); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%s: не удалось зафиксировать транзакцию: %w", op, err)
 	}
 
-	log.Printf("Удаление url по id :%s прошло успешно", id)
 	return nil
 }
 
+/*
+PurgeDeleted окончательное удаление ссылок, лежащих в корзине с момента раньше before,
+возвращает количество удалённых. Каждая удалённая ссылка записывается в журнал аудита по trail той же транзакцией
+*/
+func (s *Storage) PurgeDeleted(before time.Time, trail *audit.Trail) (int64, error) {
+	const op = "storage.pgsql.PurgeDeleted"
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("%s: не удалось открыть транзакцию: %w", op, err)
+	}
+	defer func(tx *sql.Tx) {
+		err := tx.Rollback()
+		if err != nil && !errors.Is(err, sql.ErrTxDone) {
+			LogErrorCloseDb(op, err)
+		}
+	}(tx)
+
+	purged, err := queryURLData(tx, "DELETE FROM urls WHERE deleted_at IS NOT NULL AND deleted_at < $1 RETURNING "+urlColumns, before)
+	if err != nil {
+		return 0, fmt.Errorf("%s: не удалось очистить корзину: %w", op, err)
+	}
+
+	for i := range purged {
+		if err := recordLink(tx, trail, audit.ActionPurge, &purged[i], nil); err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: не удалось зафиксировать транзакцию: %w", op, err)
+	}
+
+	return int64(len(purged)), nil
+}
+
 /*
 ExistUrlById проверяет наличие записи URL по ID.
 Если запись существует, возвращает true и nil.
@@ -201,7 +589,7 @@ func (s *Storage) ExistUrlById(id int64) (bool, error) {
 	const op = "storage.pgsql.ExistUrlById"
 	stmt, err := s.db.Prepare("SELECT COUNT(*) FROM urls WHERE id = $1")
 	if err != nil {
-		return false, fmt.Errorf("%s: не удалось подготовить запрос на поиск URL по ID: %v", op, id, err)
+		return false, fmt.Errorf("%s: не удалось подготовить запрос на поиск URL по ID %d: %v", op, id, err)
 	}
 	defer func(stmt *sql.Stmt) {
 		err := stmt.Close()
@@ -213,7 +601,7 @@ func (s *Storage) ExistUrlById(id int64) (bool, error) {
 	var count int64
 	err = stmt.QueryRow(id).Scan(&count)
 	if err != nil {
-		return false, fmt.Errorf("%s: не удалось выполнить запрос на поиск URL по ID: %v", op, id, err)
+		return false, fmt.Errorf("%s: не удалось выполнить запрос на поиск URL по ID %d: %v", op, id, err)
 	}
 
 	// Если количество записей с указанным ID больше нуля, то URL существует
@@ -221,13 +609,13 @@ func (s *Storage) ExistUrlById(id int64) (bool, error) {
 }
 
 /*
-ExistUrlByAlias проверка наличия урла по алиасу
+ExistUrlByAlias проверка наличия урла по алиасу в домене
 */
-func (s *Storage) ExistUrlByAlias(alias string) (bool, error) {
+func (s *Storage) ExistUrlByAlias(domain string, alias string) (bool, error) {
 	const op = "storage.pgsql.ExistUrlByAlias"
-	stmt, err := s.db.Prepare("SELECT COUNT(*) FROM urls WHERE alias = $1")
+	stmt, err := s.db.Prepare("SELECT COUNT(*) FROM urls WHERE domain = $1 AND " + s.aliasMatch("$2"))
 	if err != nil {
-		return false, fmt.Errorf("%s: не удалось подготовить запрос на поиск URL по Alias: %v", op, alias, err)
+		return false, fmt.Errorf("%s: не удалось подготовить запрос на поиск URL по Alias %s: %v", op, alias, err)
 	}
 	defer func(stmt *sql.Stmt) {
 		err := stmt.Close()
@@ -237,7 +625,7 @@ func (s *Storage) ExistUrlByAlias(alias string) (bool, error) {
 	}(stmt)
 
 	var count int64
-	err = stmt.QueryRow(alias).Scan(&count)
+	err = stmt.QueryRow(domain, alias).Scan(&count)
 	if err != nil {
 		return false, fmt.Errorf("%s: не удалось выполнить запрос на поиск URL по Alias: %v", op, err)
 	}
@@ -248,9 +636,26 @@ func (s *Storage) ExistUrlByAlias(alias string) (bool, error) {
 /*
 CheckAllUrls вывод всех записей из таблицы для дебага
 */
-func (s *Storage) CheckAllUrls() ([]URLData, error) {
-	const op = "storage.pgsql.CheckAllUrls"
-	rows, err := s.db.Query("SELECT * FROM urls")
+func (s *Storage) CheckAllUrls() ([]storage.URLData, error) {
+	return s.ListUrls(storage.ListFilter{})
+}
+
+/*
+ListUrls записи по фильтру: активные в порядке возрастания id, корзина - начиная с последних удалённых.
+Следующая страница активных - AfterID равный id последней записи
+*/
+func (s *Storage) ListUrls(filter storage.ListFilter) ([]storage.URLData, error) {
+	const op = "storage.pgsql.ListUrls"
+
+	// LIMIT NULL в Postgres - без ограничения
+	query := "SELECT " + urlColumns + " FROM urls WHERE ($1 = '' OR campaign = $1) AND deleted_at IS NULL AND ($3 = 0 OR id > $3) ORDER BY id LIMIT NULLIF($2, 0)"
+	args := []any{filter.Campaign, filter.Limit, filter.AfterID}
+	if filter.Deleted {
+		query = "SELECT " + urlColumns + " FROM urls WHERE ($1 = '' OR campaign = $1) AND deleted_at IS NOT NULL ORDER BY deleted_at DESC, id LIMIT NULLIF($2, 0)"
+		args = args[:2]
+	}
+
+	rows, err := s.db.Query(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("%s: не удалось получить все записи из базы данных: %v", op, err)
 	}
@@ -261,11 +666,10 @@ func (s *Storage) CheckAllUrls() ([]URLData, error) {
 		}
 	}(rows)
 
-	var urlsDataList []URLData
+	var urlsDataList []storage.URLData
 
 	for rows.Next() {
-		var urlData URLData
-		err := rows.Scan(&urlData.Id, &urlData.Alias, &urlData.Url)
+		urlData, err := scanURLData(rows)
 		if err != nil {
 			return nil, fmt.Errorf("%s, не удалось выполнить скрипт на вывод всех записей из таблицы: %v", op, err)
 		}
@@ -278,42 +682,628 @@ func (s *Storage) CheckAllUrls() ([]URLData, error) {
 }
 
 /*
-ReplacementAliasByID удаление записи по id и добавление новой записи с новым алиасом
+CampaignStats сводка по кампаниям, пустая campaign - по всем, ссылки без кампании попадают в строку с пустым именем
 */
-func (s *Storage) ReplacementAliasByID(id int64, alias string) (int64, error) {
-	const op = "storage.pgsql.ReplacementAliasByID"
+func (s *Storage) CampaignStats(campaign string) ([]storage.CampaignStat, error) {
+	const op = "storage.pgsql.CampaignStats"
 
-	isUrl, err := s.ExistUrlById(id)
-	if !isUrl || err != nil {
-		return 0, fmt.Errorf("%s, урл по указанному ID: %d был не обнаружен: %v", op, id, err)
+	rows, err := s.db.Query(`SELECT campaign, COUNT(*), COALESCE(SUM(clicks), 0) FROM urls
+		WHERE ($1 = '' OR campaign = $1) AND deleted_at IS NULL GROUP BY campaign ORDER BY campaign`, campaign)
+	if err != nil {
+		return nil, fmt.Errorf("%s: не удалось получить статистику: %w", op, err)
 	}
+	defer func(rows *sql.Rows) {
+		var err = rows.Close()
+		if err != nil {
+			LogErrorCloseDb(op, err)
+		}
+	}(rows)
 
-	url, err := s.GetURL(alias)
-	if url != "" || err == nil {
-		return 0, fmt.Errorf("%s, указанный alias:%v уже занят: %v", op, alias, err)
+	var stats []storage.CampaignStat
+	for rows.Next() {
+		var stat storage.CampaignStat
+		if err := rows.Scan(&stat.Campaign, &stat.Links, &stat.Clicks); err != nil {
+			return nil, fmt.Errorf("%s: не удалось прочитать статистику: %w", op, err)
+		}
+		stats = append(stats, stat)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: ошибка при обходе статистики: %w", op, err)
 	}
 
-	saveUrl, err := s.GetUrlById(id)
+	return stats, nil
+}
+
+/*
+RecordClick учёт перехода по ссылке, variant - номер варианта A/B теста или -1 если ссылка без вариантов
+*/
+func (s *Storage) RecordClick(id int64, variant int) error {
+	const op = "storage.pgsql.RecordClick"
+
+	tx, err := s.db.Begin()
 	if err != nil {
-		return 0, fmt.Errorf("%s, урл по указанному айди был не обнаружен: %v", op, err)
+		return fmt.Errorf("%s: не удалось начать транзакцию: %w", op, err)
 	}
+	defer func() { _ = tx.Rollback() }()
 
-	err = s.DeleteById(id)
-	if err != nil {
-		return 0, fmt.Errorf("%s, не удалось удалить урл по старому айдишнику: %v", op, err)
+	if _, err = tx.Exec("UPDATE urls SET clicks = clicks + 1 WHERE id = $1", id); err != nil {
+		return fmt.Errorf("%s: не удалось учесть переход: %w", op, err)
 	}
 
-	_, err = s.SaveUrl(saveUrl, alias, &id)
-	if err != nil {
-		return 0, fmt.Errorf("%s, не удалось сохранить урл с новым алиасом: %v", op, err)
+	if variant >= 0 {
+		_, err = tx.Exec(`INSERT INTO url_variant_clicks (url_id, variant, clicks) VALUES ($1, $2, 1)
+			ON CONFLICT (url_id, variant) DO UPDATE SET clicks = url_variant_clicks.clicks + 1`, id, variant)
+		if err != nil {
+			return fmt.Errorf("%s: не удалось учесть переход по варианту: %w", op, err)
+		}
 	}
 
-	return id, nil
+	if s.clickEvents {
+		// вебхуки о каждом переходе не уведомляются, поэтому событие сразу отмечено для них
+		_, err = tx.Exec(`INSERT INTO outbox (event, link_id, payload, consumed_by)
+			SELECT $3, id, jsonb_build_object('link_id', id, 'alias', alias, 'domain', domain, 'variant', $2::int),
+				ARRAY['`+WebhookConsumer+`']
+			FROM urls WHERE id = $1`, id, variant, events.TypeLinkClicked)
+		if err != nil {
+			return fmt.Errorf("%s: не удалось записать событие перехода: %w", op, err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%s: не удалось завершить транзакцию: %w", op, err)
+	}
+
+	return nil
 }
 
 /*
-LogErrorCloseDb функция хелпер вывода лога ошибки неудачного закрытия соединения с бд
+VariantStats переходы по вариантам ссылки в порядке вариантов, варианты без переходов тоже попадают в ответ
 */
-func LogErrorCloseDb(op string, err error) {
-	_ = fmt.Errorf("%s, не удалось отключиться от базы данных: %v", op, err)
+func (s *Storage) VariantStats(id int64) ([]storage.VariantStat, error) {
+	const op = "storage.pgsql.VariantStats"
+
+	data, err := s.GetUrlDataById(id)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rows, err := s.db.Query("SELECT variant, clicks FROM url_variant_clicks WHERE url_id = $1", id)
+	if err != nil {
+		return nil, fmt.Errorf("%s: не удалось получить статистику: %w", op, err)
+	}
+	defer func(rows *sql.Rows) {
+		var err = rows.Close()
+		if err != nil {
+			LogErrorCloseDb(op, err)
+		}
+	}(rows)
+
+	clicks := make(map[int]int64)
+	for rows.Next() {
+		var variant int
+		var count int64
+		if err := rows.Scan(&variant, &count); err != nil {
+			return nil, fmt.Errorf("%s: не удалось прочитать статистику: %w", op, err)
+		}
+		clicks[variant] = count
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: ошибка при обходе статистики: %w", op, err)
+	}
+
+	stats := make([]storage.VariantStat, 0, len(data.Variants))
+	for i, v := range data.Variants {
+		stats = append(stats, storage.VariantStat{Variant: i, URL: v.URL, Weight: v.Weight, Clicks: clicks[i]})
+	}
+
+	return stats, nil
+}
+
+/*
+RecordBlock запись блокировки клиента за перебор алиасов
+*/
+func (s *Storage) RecordBlock(block scan.Block) error {
+	const op = "storage.pgsql.RecordBlock"
+
+	_, err := s.db.Exec(`INSERT INTO blocked_clients (client, level, total, not_found, blocked_at, until)
+		VALUES ($1, $2, $3, $4, $5, $6)`, block.Client, block.Level, block.Total, block.NotFound, block.BlockedAt, block.Until)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+/*
+BlockedClients последние limit блокировок, пустой client - по всем клиентам
+*/
+func (s *Storage) BlockedClients(client string, limit int) ([]scan.Block, error) {
+	const op = "storage.pgsql.BlockedClients"
+
+	rows, err := s.db.Query(`SELECT client, level, total, not_found, blocked_at, until FROM blocked_clients
+		WHERE ($1 = '' OR client = $1) ORDER BY blocked_at DESC LIMIT $2`, client, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: не удалось получить блокировки: %w", op, err)
+	}
+	defer func(rows *sql.Rows) {
+		var err = rows.Close()
+		if err != nil {
+			LogErrorCloseDb(op, err)
+		}
+	}(rows)
+
+	var blocks []scan.Block
+	for rows.Next() {
+		var block scan.Block
+		if err := rows.Scan(&block.Client, &block.Level, &block.Total, &block.NotFound, &block.BlockedAt, &block.Until); err != nil {
+			return nil, fmt.Errorf("%s: не удалось прочитать блокировку: %w", op, err)
+		}
+		blocks = append(blocks, block)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: ошибка при обходе блокировок: %w", op, err)
+	}
+
+	return blocks, nil
+}
+
+/*
+recordLink запись действия над ссылкой в журнал аудита в транзакции изменения, nil trail журнал не ведёт
+*/
+func recordLink(tx *sql.Tx, trail *audit.Trail, action string, before *storage.URLData, after *storage.URLData) error {
+	if trail == nil {
+		return nil
+	}
+
+	entry, err := trail.Link(action, before, after)
+	if err != nil {
+		return err
+	}
+
+	return insertAudit(tx, entry)
+}
+
+/*
+insertAudit добавление записи в журнал аудита, время записи берётся из entry
+*/
+func insertAudit(tx *sql.Tx, entry audit.Entry) error {
+	_, err := tx.Exec(`INSERT INTO audit_log (link_id, actor, action, before, after, request_id, ip, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		entry.LinkID, entry.Actor, entry.Action, nullJSON(entry.Before), nullJSON(entry.After), entry.RequestID, entry.IP,
+		nullTime(entry.CreatedAt))
+	if err != nil {
+		return fmt.Errorf("не удалось записать действие %s в журнал аудита: %w", entry.Action, err)
+	}
+
+	return nil
+}
+
+/*
+lockURL запись по id, заблокированная до конца транзакции, нет записи - storage.ErrURLNotFound
+*/
+func lockURL(tx *sql.Tx, id int64) (storage.URLData, error) {
+	data, err := scanURLData(tx.QueryRow("SELECT "+urlColumns+" FROM urls WHERE id = $1 FOR UPDATE", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return data, storage.ErrURLNotFound
+	}
+
+	return data, err
+}
+
+/*
+queryURLData все записи, которые вернул запрос по urlColumns (SELECT или RETURNING)
+*/
+func queryURLData(tx *sql.Tx, query string, args ...any) ([]storage.URLData, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		var err = rows.Close()
+		if err != nil {
+			LogErrorCloseDb("storage.pgsql.queryURLData", err)
+		}
+	}(rows)
+
+	var list []storage.URLData
+	for rows.Next() {
+		data, err := scanURLData(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, data)
+	}
+
+	return list, rows.Err()
+}
+
+/*
+AuditLog записи журнала аудита по фильтру, новые первыми
+*/
+func (s *Storage) AuditLog(filter audit.Filter) ([]audit.Entry, error) {
+	const op = "storage.pgsql.AuditLog"
+
+	rows, err := s.db.Query(`SELECT `+auditColumns+` FROM audit_log
+		WHERE ($1 = 0 OR link_id = $1) AND ($2 = '' OR actor = $2)
+			AND ($3::timestamptz IS NULL OR created_at >= $3) AND ($4::timestamptz IS NULL OR created_at < $4)
+		ORDER BY id DESC LIMIT $5`,
+		filter.LinkID, filter.Actor, nullTime(filter.From), nullTime(filter.To), filter.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: не удалось получить журнал: %w", op, err)
+	}
+	defer func(rows *sql.Rows) {
+		var err = rows.Close()
+		if err != nil {
+			LogErrorCloseDb(op, err)
+		}
+	}(rows)
+
+	var entries []audit.Entry
+	for rows.Next() {
+		entry, err := scanAuditEntry(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: не удалось прочитать запись: %w", op, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: ошибка при обходе журнала: %w", op, err)
+	}
+
+	return entries, nil
+}
+
+// auditColumns колонки для чтения audit.Entry, порядок совпадает со scanAuditEntry
+const auditColumns = "id, link_id, actor, action, before, after, request_id, ip, created_at"
+
+func scanAuditEntry(row rowScanner) (audit.Entry, error) {
+	var entry audit.Entry
+	var before, after []byte
+	err := row.Scan(&entry.ID, &entry.LinkID, &entry.Actor, &entry.Action, &before, &after, &entry.RequestID,
+		&entry.IP, &entry.CreatedAt)
+	entry.Before, entry.After = before, after
+
+	return entry, err
+}
+
+// nullJSON значение для колонки JSONB, пустое сохраняется как NULL
+func nullJSON(data []byte) any {
+	if len(data) == 0 {
+		return nil
+	}
+	return string(data)
+}
+
+/*
+IterateUrls потоковый обход активных записей по возрастанию id без загрузки таблицы в память,
+ошибка из fn прерывает обход и возвращается как есть. Ссылки из корзины не обходятся:
+загруженные обратно, они стали бы активными
+*/
+func (s *Storage) IterateUrls(fn func(storage.URLData) error) error {
+	const op = "storage.pgsql.IterateUrls"
+
+	rows, err := s.db.Query("SELECT " + urlColumns + " FROM urls WHERE deleted_at IS NULL ORDER BY id")
+	if err != nil {
+		return fmt.Errorf("%s: не удалось получить записи из базы данных: %w", op, err)
+	}
+	defer func(rows *sql.Rows) {
+		var err = rows.Close()
+		if err != nil {
+			LogErrorCloseDb(op, err)
+		}
+	}(rows)
+
+	for rows.Next() {
+		urlData, err := scanURLData(rows)
+		if err != nil {
+			return fmt.Errorf("%s: не удалось прочитать запись: %w", op, err)
+		}
+		if err := fn(urlData); err != nil {
+			return err
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("%s: ошибка при обходе записей: %w", op, err)
+	}
+
+	return nil
+}
+
+/*
+ImportUrls загрузка записей с сохранением id и alias одной транзакцией.
+next возвращает очередную запись и io.EOF по окончании данных.
+Записи с ошибкой storage.ErrInvalidRecord пропускаются и попадают в отчёт.
+При совпадении id или alias поведение определяется mode, при dryRun транзакция откатывается,
+а отчёт показывает что было бы сделано. Заменённые записи и итог импорта записываются в журнал аудита по trail
+той же транзакцией.
+*/
+func (s *Storage) ImportUrls(next func() (storage.URLData, error), mode storage.ConflictMode, dryRun bool,
+	trail *audit.Trail) (storage.ImportReport, error) {
+	const op = "storage.pgsql.ImportUrls"
+
+	report := storage.ImportReport{DryRun: dryRun}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return report, fmt.Errorf("%s: не удалось открыть транзакцию: %w", op, err)
+	}
+	defer func(tx *sql.Tx) {
+		err := tx.Rollback()
+		if err != nil && !errors.Is(err, sql.ErrTxDone) {
+			LogErrorCloseDb(op, err)
+		}
+	}(tx)
+
+	conflictCond := "(domain = $1 AND " + s.aliasMatch("$2") + ") OR ($3 <> 0 AND id = $3)"
+
+	statements := map[string]string{
+		"find":         "SELECT COUNT(*) FROM urls WHERE " + conflictCond,
+		"insert":       insertQuery(false, ""),
+		"insertWithID": insertQuery(true, ""),
+	}
+	// заменённые записи нужны целиком для журнала, поэтому удаление возвращает их
+	deleteQuery := "DELETE FROM urls WHERE " + conflictCond + " RETURNING " + urlColumns
+
+	stmts := make(map[string]*sql.Stmt, len(statements))
+	for name, query := range statements {
+		stmt, err := tx.Prepare(query)
+		if err != nil {
+			return report, fmt.Errorf("%s: prepare statement: %w", op, err)
+		}
+		defer func(stmt *sql.Stmt) {
+			err := stmt.Close()
+			if err != nil {
+				LogErrorCloseDb(op, err)
+			}
+		}(stmt)
+		stmts[name] = stmt
+	}
+
+	for line := 1; ; line++ {
+		data, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if errors.Is(err, storage.ErrInvalidRecord) {
+			report.Reject(line, data.Alias, err)
+			continue
+		}
+		if err != nil {
+			return report, fmt.Errorf("%s: запись %d: %w", op, line, err)
+		}
+
+		report.Total++
+
+		var count int64
+		if err := stmts["find"].QueryRow(data.Domain, data.Alias, data.Id).Scan(&count); err != nil {
+			return report, fmt.Errorf("%s: запись %d: не удалось проверить конфликт: %w", op, line, err)
+		}
+
+		if count > 0 {
+			conflict := storage.ImportConflict{Line: line, Id: data.Id, Domain: data.Domain, Alias: data.Alias, Action: string(mode)}
+			report.Conflicts = append(report.Conflicts, conflict)
+
+			switch mode {
+			case storage.ConflictSkip:
+				report.Skipped++
+				continue
+			case storage.ConflictOverwrite:
+				deleted, err := queryURLData(tx, deleteQuery, data.Domain, data.Alias, data.Id)
+				if err != nil {
+					return report, fmt.Errorf("%s: запись %d: не удалось заменить запись: %w", op, line, err)
+				}
+				for i := range deleted {
+					if err := recordLink(tx, trail, audit.ActionOverwrite, &deleted[i], nil); err != nil {
+						return report, fmt.Errorf("%s: запись %d: %w", op, line, err)
+					}
+				}
+				report.Overwritten++
+			default:
+				return report, fmt.Errorf("%s: запись %d, alias %s: %w", op, line, data.Alias, storage.ErrImportConflict)
+			}
+		} else {
+			report.Created++
+		}
+
+		values, err := insertValues(data)
+		if err != nil {
+			return report, fmt.Errorf("%s: запись %d: %w", op, line, err)
+		}
+		if data.Id != 0 {
+			_, err = stmts["insertWithID"].Exec(values...)
+		} else {
+			_, err = stmts["insert"].Exec(values...)
+		}
+		if err != nil {
+			return report, fmt.Errorf("%s: запись %d: не удалось сохранить url: %w", op, line, err)
+		}
+	}
+
+	if dryRun {
+		return report, nil
+	}
+
+	// явные id не двигают последовательность, выравниваем её чтобы новые записи не конфликтовали
+	_, err = tx.Exec("SELECT setval(pg_get_serial_sequence('urls', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM urls")
+	if err != nil {
+		return report, fmt.Errorf("%s: не удалось обновить последовательность id: %w", op, err)
+	}
+
+	if trail != nil {
+		entry, err := trail.Summary(audit.ActionImport, report)
+		if err == nil {
+			err = insertAudit(tx, entry)
+		}
+		if err != nil {
+			return report, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return report, fmt.Errorf("%s: не удалось зафиксировать транзакцию: %w", op, err)
+	}
+
+	return report, nil
+}
+
+/*
+ReplacementAliasByID смена алиаса записи по id, алиас должен быть свободен в домене записи.
+Ссылка в корзине считается ненайденной, как и при удалении.
+Ссылка до и после смены записывается в журнал аудита по trail той же транзакцией
+*/
+func (s *Storage) ReplacementAliasByID(id int64, alias string, trail *audit.Trail) (int64, error) {
+	const op = "storage.pgsql.ReplacementAliasByID"
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("%s: не удалось открыть транзакцию: %w", op, err)
+	}
+	defer func(tx *sql.Tx) {
+		err := tx.Rollback()
+		if err != nil && !errors.Is(err, sql.ErrTxDone) {
+			LogErrorCloseDb(op, err)
+		}
+	}(tx)
+
+	before, err := lockURL(tx, id)
+	if err == nil && before.DeletedAt != nil {
+		err = storage.ErrURLNotFound
+	}
+	if errors.Is(err, storage.ErrURLNotFound) {
+		return 0, fmt.Errorf("%s, урл по указанному ID: %d был не обнаружен: %w", op, id, err)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%s, не удалось сменить алиас: %w", op, err)
+	}
+
+	after, err := scanURLData(tx.QueryRow("UPDATE urls SET alias = $2 WHERE id = $1 RETURNING "+urlColumns, id, alias))
+	if err != nil {
+		pgErr, isPGErr := err.(*pq.Error)
+		if isPGErr && pgErr.Code == "23505" {
+			return 0, fmt.Errorf("%s, указанный alias:%v уже занят: %w", op, alias, storage.ErrAliasExists)
+		}
+		return 0, fmt.Errorf("%s, не удалось сменить алиас: %w", op, err)
+	}
+
+	if err := recordLink(tx, trail, audit.ActionEditAlias, &before, &after); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: не удалось зафиксировать транзакцию: %w", op, err)
+	}
+
+	return id, nil
+}
+
+// lowerAliasIndex уникальный индекс, не дающий сохранить алиасы, различающиеся только регистром
+const lowerAliasIndex = "urls_domain_lower_alias_key"
+
+/*
+aliasMatch условие поиска по алиасу с учётом режима регистра, param - плейсхолдер значения
+*/
+func (s *Storage) aliasMatch(param string) string {
+	if s.caseInsensitive {
+		return "lower(alias) = lower(" + param + ")"
+	}
+	return "alias = " + param
+}
+
+/*
+AliasCollisions алиасы, которые помешают включить режим без учёта регистра
+*/
+func (s *Storage) AliasCollisions() ([]storage.AliasCollision, error) {
+	const op = "storage.pgsql.AliasCollisions"
+
+	rows, err := s.db.Query(`SELECT domain, lower(alias), array_agg(alias ORDER BY id), array_agg(id ORDER BY id)
+		FROM urls GROUP BY domain, lower(alias) HAVING COUNT(*) > 1 ORDER BY domain, lower(alias)`)
+	if err != nil {
+		return nil, fmt.Errorf("%s: не удалось найти совпадающие алиасы: %w", op, err)
+	}
+	defer func(rows *sql.Rows) {
+		var err = rows.Close()
+		if err != nil {
+			LogErrorCloseDb(op, err)
+		}
+	}(rows)
+
+	var collisions []storage.AliasCollision
+	for rows.Next() {
+		var c storage.AliasCollision
+		if err := rows.Scan(&c.Domain, &c.Key, pq.Array(&c.Aliases), pq.Array(&c.IDs)); err != nil {
+			return nil, fmt.Errorf("%s: не удалось прочитать совпадение: %w", op, err)
+		}
+		collisions = append(collisions, c)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: ошибка при обходе совпадений: %w", op, err)
+	}
+
+	return collisions, nil
+}
+
+/*
+SetCaseInsensitive переключение режима алиасов без учёта регистра. При включении сначала
+проверяются совпадения, при их наличии возвращается storage.ErrAliasCollisions и режим не меняется,
+иначе создаётся уникальный индекс по (domain, lower(alias)). При выключении индекс удаляется
+*/
+func (s *Storage) SetCaseInsensitive(on bool) error {
+	const op = "storage.pgsql.SetCaseInsensitive"
+
+	if !on {
+		if _, err := s.db.Exec("DROP INDEX IF EXISTS " + lowerAliasIndex); err != nil {
+			return fmt.Errorf("%s: не удалось удалить индекс: %w", op, err)
+		}
+		s.caseInsensitive = false
+		return nil
+	}
+
+	collisions, err := s.AliasCollisions()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if len(collisions) > 0 {
+		return fmt.Errorf("%s: %w: %d", op, storage.ErrAliasCollisions, len(collisions))
+	}
+
+	_, err = s.db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS " + lowerAliasIndex + " ON urls (domain, lower(alias))")
+	pgErr, isPGErr := err.(*pq.Error)
+	if isPGErr && pgErr.Code == "23505" {
+		// совпадение появилось между проверкой и созданием индекса
+		return fmt.Errorf("%s: %w", op, storage.ErrAliasCollisions)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: не удалось создать индекс: %w", op, err)
+	}
+
+	s.caseInsensitive = true
+	return nil
+}
+
+/*
+nullTime нулевое время пишется в бд как NULL, чтобы сработало значение по умолчанию
+*/
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+/*
+LogErrorCloseDb функция хелпер вывода лога ошибки неудачного закрытия соединения с бд
+*/
+func LogErrorCloseDb(op string, err error) {
+	_ = fmt.Errorf("%s, не удалось отключиться от базы данных: %v", op, err)
+}
+
+/*
+uniqueViolation ошибка хранилища по имени нарушенного уникального ограничения
+*/
+func uniqueViolation(pgErr *pq.Error) error {
+	switch pgErr.Constraint {
+	case "urls_pkey":
+		return storage.ErrIDExists
+	case "urls_domain_alias_key", lowerAliasIndex:
+		return storage.ErrAliasExists
+	default:
+		return storage.ErrURLExists
+	}
 }
@@ -0,0 +1,255 @@
+package pgsql
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+
+	"url-shoter/internal/lib/webhook"
+	"url-shoter/internal/storage"
+)
+
+/*
+WebhookConsumer имя потребителя outbox, совпадает с условием индекса outbox_webhooks_pending_idx
+*/
+const WebhookConsumer = "webhooks"
+
+/*
+CreateWebhook новая подписка, возвращается с id и временем создания
+*/
+func (s *Storage) CreateWebhook(hook webhook.Webhook) (webhook.Webhook, error) {
+	const op = "storage.pgsql.CreateWebhook"
+
+	if hook.Events == nil {
+		hook.Events = []string{}
+	}
+
+	err := s.db.QueryRow("INSERT INTO webhooks (url, events, secret) VALUES ($1, $2, $3) RETURNING id, created_at",
+		hook.URL, pq.Array(hook.Events), hook.Secret).Scan(&hook.ID, &hook.CreatedAt)
+	if err != nil {
+		return hook, fmt.Errorf("%s: не удалось сохранить подписку: %w", op, err)
+	}
+
+	return hook, nil
+}
+
+/*
+Webhooks все подписки без секретов
+*/
+func (s *Storage) Webhooks() ([]webhook.Webhook, error) {
+	const op = "storage.pgsql.Webhooks"
+
+	rows, err := s.db.Query("SELECT id, url, events, created_at FROM webhooks ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("%s: не удалось получить подписки: %w", op, err)
+	}
+	defer func(rows *sql.Rows) {
+		var err = rows.Close()
+		if err != nil {
+			LogErrorCloseDb(op, err)
+		}
+	}(rows)
+
+	var hooks []webhook.Webhook
+	for rows.Next() {
+		var hook webhook.Webhook
+		if err := rows.Scan(&hook.ID, &hook.URL, pq.Array(&hook.Events), &hook.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s: не удалось прочитать подписку: %w", op, err)
+		}
+		hooks = append(hooks, hook)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: ошибка при обходе подписок: %w", op, err)
+	}
+
+	return hooks, nil
+}
+
+/*
+DeleteWebhook удаление подписки вместе с журналом её доставок, нет подписки - storage.ErrNotFound
+*/
+func (s *Storage) DeleteWebhook(id int64) error {
+	const op = "storage.pgsql.DeleteWebhook"
+
+	res, err := s.db.Exec("DELETE FROM webhooks WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("%s: не удалось удалить подписку %d: %w", op, id, err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("%s: подписка %d: %w", op, id, storage.ErrNotFound)
+	}
+
+	return nil
+}
+
+/*
+MarkExpiredLinks отметка истёкших ссылок, для каждой триггер пишет в outbox link.expired
+*/
+func (s *Storage) MarkExpiredLinks() (int64, error) {
+	const op = "storage.pgsql.MarkExpiredLinks"
+
+	res, err := s.db.Exec(`UPDATE urls SET expired_notified = true
+		WHERE expires_at <= now() AND NOT expired_notified AND deleted_at IS NULL`)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return res.RowsAffected()
+}
+
+/*
+FanOutWebhookEvents до limit ещё не разложенных событий outbox превращаются в доставки подходящим подпискам,
+в одной транзакции с отметкой события. Событие без подходящей подписки, в том числе когда подписок нет вовсе,
+тоже отмечается, иначе оно навсегда осталось бы в outbox_webhooks_pending_idx. Возвращает количество обработанных событий
+*/
+func (s *Storage) FanOutWebhookEvents(limit int) (int, error) {
+	const op = "storage.pgsql.FanOutWebhookEvents"
+
+	// один запрос: выбранные события раскладываются по подпискам и отмечаются все, совпала подписка или нет
+	res, err := s.db.Exec(`WITH picked AS (
+			SELECT id, event, payload, created_at FROM outbox
+			WHERE NOT ('`+WebhookConsumer+`' = ANY(consumed_by)) ORDER BY id LIMIT $1 FOR UPDATE SKIP LOCKED
+		), fanout AS (
+			INSERT INTO webhook_deliveries (webhook_id, event_id, event, payload, event_at)
+			SELECT w.id, p.id, p.event, p.payload, p.created_at FROM picked p
+			JOIN webhooks w ON cardinality(w.events) = 0 OR p.event = ANY(w.events)
+		)
+		UPDATE outbox o SET consumed_by = array_append(o.consumed_by, $2) FROM picked p WHERE o.id = p.id`,
+		limit, WebhookConsumer)
+	if err != nil {
+		return 0, fmt.Errorf("%s: не удалось разложить события: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return int(n), nil
+}
+
+/*
+ClaimDeliveries до limit доставок, время которых пришло. Следующая попытка сдвигается на lease,
+чтобы доставку не взяла другая реплика, пока эта её отправляет
+*/
+func (s *Storage) ClaimDeliveries(limit int, lease time.Duration) ([]webhook.Delivery, error) {
+	const op = "storage.pgsql.ClaimDeliveries"
+
+	rows, err := s.db.Query(`WITH due AS (
+			SELECT id FROM webhook_deliveries WHERE status = 'pending' AND next_attempt_at <= now()
+			ORDER BY next_attempt_at LIMIT $1 FOR UPDATE SKIP LOCKED
+		)
+		UPDATE webhook_deliveries d SET next_attempt_at = now() + make_interval(secs => $2)
+		FROM due, webhooks w WHERE d.id = due.id AND w.id = d.webhook_id
+		RETURNING d.id, d.webhook_id, w.url, w.secret, d.event_id, d.event, d.payload, d.event_at, d.status, d.attempts, d.created_at`,
+		limit, lease.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer func(rows *sql.Rows) {
+		var err = rows.Close()
+		if err != nil {
+			LogErrorCloseDb(op, err)
+		}
+	}(rows)
+
+	var deliveries []webhook.Delivery
+	for rows.Next() {
+		var d webhook.Delivery
+		var payload []byte
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.URL, &d.Secret, &d.EventID, &d.Event, &payload, &d.EventAt, &d.Status,
+			&d.Attempts, &d.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s: не удалось прочитать доставку: %w", op, err)
+		}
+		d.Payload = payload
+		deliveries = append(deliveries, d)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return deliveries, nil
+}
+
+/*
+FinishDelivery сохранение результата попытки доставки
+*/
+func (s *Storage) FinishDelivery(d webhook.Delivery) error {
+	const op = "storage.pgsql.FinishDelivery"
+
+	_, err := s.db.Exec(`UPDATE webhook_deliveries SET status = $2, attempts = $3, response_code = $4, last_error = $5,
+		next_attempt_at = $6, delivered_at = $7 WHERE id = $1`,
+		d.ID, d.Status, d.Attempts, d.ResponseCode, d.LastError, d.NextAttemptAt, d.DeliveredAt)
+	if err != nil {
+		return fmt.Errorf("%s: доставка %d: %w", op, d.ID, err)
+	}
+
+	return nil
+}
+
+/*
+WebhookDeliveries журнал доставок по фильтру, новые первыми
+*/
+func (s *Storage) WebhookDeliveries(filter webhook.DeliveryFilter) ([]webhook.Delivery, error) {
+	const op = "storage.pgsql.WebhookDeliveries"
+
+	rows, err := s.db.Query(`SELECT d.id, d.webhook_id, w.url, d.event_id, d.event, d.payload, d.event_at, d.status, d.attempts,
+			d.response_code, d.last_error, d.created_at, d.next_attempt_at, d.delivered_at
+		FROM webhook_deliveries d JOIN webhooks w ON w.id = d.webhook_id
+		WHERE ($1 = 0 OR d.webhook_id = $1) AND ($2 = '' OR d.status = $2)
+		ORDER BY d.id DESC LIMIT $3`, filter.WebhookID, filter.Status, filter.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: не удалось получить доставки: %w", op, err)
+	}
+	defer func(rows *sql.Rows) {
+		var err = rows.Close()
+		if err != nil {
+			LogErrorCloseDb(op, err)
+		}
+	}(rows)
+
+	var deliveries []webhook.Delivery
+	for rows.Next() {
+		var d webhook.Delivery
+		var payload []byte
+		var nextAttemptAt, deliveredAt sql.NullTime
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.URL, &d.EventID, &d.Event, &payload, &d.EventAt, &d.Status, &d.Attempts,
+			&d.ResponseCode, &d.LastError, &d.CreatedAt, &nextAttemptAt, &deliveredAt); err != nil {
+			return nil, fmt.Errorf("%s: не удалось прочитать доставку: %w", op, err)
+		}
+		d.Payload = payload
+		if nextAttemptAt.Valid && d.Status == webhook.StatusPending {
+			d.NextAttemptAt = &nextAttemptAt.Time
+		}
+		if deliveredAt.Valid {
+			d.DeliveredAt = &deliveredAt.Time
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: ошибка при обходе доставок: %w", op, err)
+	}
+
+	return deliveries, nil
+}
+
+/*
+RetryDelivery возврат недоставленного события в очередь с полным набором попыток,
+доставка не в списке недоставленных - storage.ErrNotFound
+*/
+func (s *Storage) RetryDelivery(id int64) error {
+	const op = "storage.pgsql.RetryDelivery"
+
+	res, err := s.db.Exec(`UPDATE webhook_deliveries SET status = 'pending', attempts = 0, last_error = '', next_attempt_at = now()
+		WHERE id = $1 AND status = 'dead'`, id)
+	if err != nil {
+		return fmt.Errorf("%s: доставка %d: %w", op, id, err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("%s: доставка %d: %w", op, id, storage.ErrNotFound)
+	}
+
+	return nil
+}
@@ -1,8 +1,88 @@
 package storage
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var (
-	ErrURLNotFound = errors.New("url not found")
-	ErrURLExists   = errors.New("url not exist")
+	ErrURLNotFound     = errors.New("url not found")
+	ErrURLExists       = errors.New("url exists")
+	ErrAliasExists     = fmt.Errorf("alias exists: %w", ErrURLExists)
+	ErrIDExists        = fmt.Errorf("id exists: %w", ErrURLExists)
+	ErrURLExpired      = errors.New("url expired")
+	ErrURLDeleted      = errors.New("url deleted")
+	ErrImportConflict  = errors.New("import conflict")
+	ErrInvalidRecord   = errors.New("invalid record") // запись импорта не прошла проверку, импорт её пропускает
+	ErrUnknownConflict = errors.New("unknown conflict mode")
+	ErrAliasCollisions = errors.New("aliases differ only by case")
+	ErrNotFound        = errors.New("not found")
 )
+
+/*
+ConflictMode поведение импорта при совпадении id или alias с уже существующей записью
+*/
+type ConflictMode string
+
+const (
+	ConflictSkip      ConflictMode = "skip"      // оставить существующую запись
+	ConflictOverwrite ConflictMode = "overwrite" // заменить существующую запись импортируемой
+	ConflictFail      ConflictMode = "fail"      // прервать импорт и откатить изменения
+)
+
+/*
+ParseConflictMode разбор режима конфликта, пустая строка означает skip
+*/
+func ParseConflictMode(mode string) (ConflictMode, error) {
+	switch ConflictMode(mode) {
+	case "":
+		return ConflictSkip, nil
+	case ConflictSkip, ConflictOverwrite, ConflictFail:
+		return ConflictMode(mode), nil
+	default:
+		return "", ErrUnknownConflict
+	}
+}
+
+/*
+ImportConflict запись импорта, совпавшая с существующими данными
+*/
+type ImportConflict struct {
+	Line   int    `json:"line"`
+	Id     int64  `json:"id,omitempty"`
+	Domain string `json:"domain,omitempty"`
+	Alias  string `json:"alias"`
+	Action string `json:"action"`
+}
+
+/*
+ImportRejection запись импорта, пропущенная из-за ошибки проверки
+*/
+type ImportRejection struct {
+	Line  int    `json:"line"`
+	Alias string `json:"alias,omitempty"`
+	Error string `json:"error"`
+}
+
+/*
+ImportReport отчёт об импорте, при dry run отражает что было бы сделано
+*/
+type ImportReport struct {
+	DryRun      bool              `json:"dry_run"`
+	Total       int               `json:"total"`
+	Created     int               `json:"created"`
+	Overwritten int               `json:"overwritten"`
+	Skipped     int               `json:"skipped"`
+	Invalid     int               `json:"invalid"`
+	Conflicts   []ImportConflict  `json:"conflicts,omitempty"`
+	Rejected    []ImportRejection `json:"rejected,omitempty"`
+}
+
+/*
+Reject учёт записи line, не прошедшей проверку: она не импортируется, причина попадает в отчёт
+*/
+func (r *ImportReport) Reject(line int, alias string, err error) {
+	r.Total++
+	r.Invalid++
+	r.Rejected = append(r.Rejected, ImportRejection{Line: line, Alias: alias, Error: err.Error()})
+}
@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"time"
+	"url-shoter/internal/lib/rules"
+	"url-shoter/internal/lib/variants"
+)
+
+/*
+URLData ссылка как она хранится в базе
+*/
+type URLData struct {
+	Id        int64      `json:"id"`
+	Alias     string     `json:"alias"`
+	Url       string     `json:"url"`
+	Domain    string     `json:"domain,omitempty"`
+	Title     string     `json:"title,omitempty"`
+	Clicks    int64      `json:"clicks,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Campaign  string     `json:"campaign,omitempty"`   // utm_campaign адреса назначения, заполняется при сохранении
+	DeletedAt *time.Time `json:"deleted_at,omitempty"` // время удаления в корзину, nil - ссылка активна
+	DeletedBy string     `json:"deleted_by,omitempty"` // кто удалил ссылку
+	Options
+}
+
+/*
+Options поведение короткой ссылки при переходе
+*/
+type Options struct {
+	RedirectType int  `json:"redirect_type,omitempty"` // 301, 302, 307 или 308, 0 означает DefaultRedirectType
+	Preview      bool `json:"preview,omitempty"`       // показывать страницу с адресом назначения вместо редиректа
+	ForwardQuery bool `json:"forward_query,omitempty"` // добавлять query запроса к адресу назначения
+	ForwardPath  bool `json:"forward_path,omitempty"`  // добавлять путь после алиаса к пути адреса назначения
+
+	Rules []rules.Rule `json:"rules,omitempty"` // условные адреса назначения, проверяются по порядку, url ссылки - адрес по умолчанию
+
+	Variants []variants.Variant `json:"variants,omitempty"` // адреса A/B теста с весами, используются если не сработало правило
+	Sticky   string             `json:"sticky,omitempty"`   // закрепление варианта за посетителем: cookie, ip или пусто
+
+	// bcrypt хеш пароля ссылки, пусто - ссылка открыта. В JSON не попадает, выгрузка с хешами - linkio.WithPasswordHashes
+	PasswordHash string `json:"-"`
+}
+
+const DefaultRedirectType = 302
+
+/*
+Normalize подстановка значений по умолчанию перед записью в базу
+*/
+func (o Options) Normalize() Options {
+	if o.RedirectType == 0 {
+		o.RedirectType = DefaultRedirectType
+	}
+	return o
+}
+
+/*
+SaveResult результат сохранения одного элемента пачки: id новой записи либо ошибка
+*/
+type SaveResult struct {
+	Id  int64
+	Err error
+}
+
+/*
+ListFilter отбор записей для ListUrls, пустые поля не ограничивают выборку
+*/
+type ListFilter struct {
+	Campaign string
+	Deleted  bool  // true - только ссылки в корзине, false - только активные
+	AfterID  int64 // для постраничного чтения активных: только ссылки с id больше
+	Limit    int   // 0 - без ограничения
+}
+
+/*
+CampaignStat сводка по кампании: количество ссылок и сумма переходов
+*/
+type CampaignStat struct {
+	Campaign string `json:"campaign"`
+	Links    int64  `json:"links"`
+	Clicks   int64  `json:"clicks"`
+}
+
+/*
+VariantStat переходы по варианту A/B теста
+*/
+type VariantStat struct {
+	Variant int    `json:"variant"`
+	URL     string `json:"url"`
+	Weight  int    `json:"weight"`
+	Clicks  int64  `json:"clicks"`
+}
+
+/*
+AliasCollision алиасы одного домена, совпадающие без учёта регистра
+*/
+type AliasCollision struct {
+	Domain  string   `json:"domain"`
+	Key     string   `json:"key"` // алиас в нижнем регистре
+	Aliases []string `json:"aliases"`
+	IDs     []int64  `json:"ids"`
+}
+
+/*
+OwnerStat владелец ссылок - тот, кто их создал по журналу аудита, и количество созданных ссылок
+*/
+type OwnerStat struct {
+	Actor string `json:"actor"`
+	Links int64  `json:"links"`
+}